@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// AdminHandler serves the /admin routes used by support staff. Every route
+// is guarded by a permission check in routes.SetUpRoutes.
+type AdminHandler struct {
+	userStore  store.UserStore
+	tokenStore store.TokenStore
+	logger     *slog.Logger
+}
+
+func NewAdminHandler(userStore store.UserStore, tokenStore store.TokenStore, logger *slog.Logger) *AdminHandler {
+	return &AdminHandler{
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		logger:     logger,
+	}
+}
+
+func (h *AdminHandler) HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := utils.ReadIntQuery(r, "limit")
+	if err != nil || (limit != nil && (*limit < 1 || *limit > maxUserPageSize)) {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "limit must be between 1 and 200")
+		return
+	}
+	offset, err := utils.ReadIntQuery(r, "offset")
+	if err != nil || (offset != nil && *offset < 0) {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "offset must be a positive number")
+		return
+	}
+
+	pageSize, skip := defaultUserPageSize, 0
+	if limit != nil {
+		pageSize = *limit
+	}
+	if offset != nil {
+		skip = *offset
+	}
+
+	users, err := h.userStore.ListUsers(r.Context(), pageSize, skip)
+	if err != nil {
+		writeError(h.logger, w, r, "ListUsers", err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"users": users})
+}
+
+// readUser loads the user named by the id URL parameter, writing the error
+// response itself when it returns nil.
+func (h *AdminHandler) readUser(w http.ResponseWriter, r *http.Request) *store.User {
+	userID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "invalid user id")
+		return nil
+	}
+	user, err := h.userStore.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeError(h.logger, w, r, "GetUserByID", err)
+		return nil
+	}
+	return user
+}
+
+func (h *AdminHandler) revokeAllTokens(ctx context.Context, userID int) error {
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh} {
+		if err := h.tokenStore.DeleteAllTokensForUser(ctx, userID, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleSetUserDisabled enables or disables an account. Disabling also
+// signs the user out everywhere.
+func (h *AdminHandler) HandleSetUserDisabled(w http.ResponseWriter, r *http.Request) {
+	user := h.readUser(w, r)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Disabled *bool `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+	if req.Disabled == nil {
+		utils.WriteError(w, r, utils.NewFieldError("disabled", "required", "disabled is required"))
+		return
+	}
+	if *req.Disabled && user.ID == middleware.GetUser(r).ID {
+		utils.WriteError(w, r, utils.NewFieldError("disabled", "self", "you cannot disable your own account"))
+		return
+	}
+
+	err := h.userStore.SetUserDisabled(r.Context(), user.ID, *req.Disabled)
+	if err != nil {
+		writeError(h.logger, w, r, "SetUserDisabled", err)
+		return
+	}
+	if *req.Disabled {
+		if err = h.revokeAllTokens(r.Context(), user.ID); err != nil {
+			writeError(h.logger, w, r, "DeleteAllTokensForUser", err)
+			return
+		}
+	}
+
+	user.Disabled = *req.Disabled
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+func (h *AdminHandler) HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	user := h.readUser(w, r)
+	if user == nil {
+		return
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+	if !roles.Valid(req.Role) {
+		utils.WriteError(w, r, utils.NewFieldError("role", "invalid", "role must be one of user, coach, admin"))
+		return
+	}
+
+	err := h.userStore.SetUserRole(r.Context(), user.ID, req.Role)
+	if err != nil {
+		writeError(h.logger, w, r, "SetUserRole", err)
+		return
+	}
+
+	user.Role = req.Role
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
+// HandleRevokeUserTokens signs a user out of every session.
+func (h *AdminHandler) HandleRevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	user := h.readUser(w, r)
+	if user == nil {
+		return
+	}
+	if err := h.revokeAllTokens(r.Context(), user.ID); err != nil {
+		writeError(h.logger, w, r, "DeleteAllTokensForUser", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/syafae/femProject/internal/metrics"
+	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+// maxAPIKeyExpiresInDays caps the lifetime of an API key, so a leaked key
+// stops working eventually.
+const maxAPIKeyExpiresInDays = 365
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	metrics     metrics.Metrics
+	logger      *slog.Logger
+}
+
+type createAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days"`
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, m metrics.Metrics, logger *slog.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore: apiKeyStore,
+		metrics:     m,
+		logger:      logger,
+	}
+}
+
+func (h *APIKeyHandler) validateCreateRequest(req *createAPIKeyRequest) error {
+	v := &utils.ValidationError{}
+	if req.Name == "" {
+		v.Add("name", "required", "name is required")
+	} else if len(req.Name) > 100 {
+		v.Add("name", "too_long", "name cannot be greater than 100 characters")
+	}
+	if len(req.Scopes) == 0 {
+		v.Add("scopes", "required", "at least one scope is required")
+	}
+	for i, scope := range req.Scopes {
+		if !tokens.ValidAPIScope(scope) {
+			v.Add("scopes", "invalid", "unknown scope "+scope)
+		} else if slices.Contains(req.Scopes[:i], scope) {
+			v.Add("scopes", "duplicate", "scope "+scope+" is listed more than once")
+		}
+	}
+	if req.ExpiresInDays != nil {
+		v.Check(*req.ExpiresInDays >= 1 && *req.ExpiresInDays <= maxAPIKeyExpiresInDays, "expires_in_days", "out_of_range",
+			fmt.Sprintf("expires_in_days must be between 1 and %d", maxAPIKeyExpiresInDays))
+	}
+	return v.Err()
+}
+
+func (h *APIKeyHandler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+	if err := h.validateCreateRequest(&req); err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	user := middleware.GetUser(r)
+	key, err := tokens.GenerateAPIKey(user.ID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		writeError(h.logger, w, r, "GenerateAPIKey", err)
+		return
+	}
+	if err = h.apiKeyStore.CreateAPIKey(r.Context(), key); err != nil {
+		writeError(h.logger, w, r, "CreateAPIKey", err)
+		return
+	}
+	h.metrics.TokenIssued("api_key")
+
+	// the plaintext key is only ever returned here
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"api_key": key})
+}
+
+func (h *APIKeyHandler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	keys, err := h.apiKeyStore.ListAPIKeys(r.Context(), user.ID)
+	if err != nil {
+		writeError(h.logger, w, r, "ListAPIKeys", err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"api_keys": keys})
+}
+
+func (h *APIKeyHandler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "invalid api key id")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	err = h.apiKeyStore.DeleteAPIKey(r.Context(), user.ID, keyID)
+	if err != nil {
+		writeError(h.logger, w, r, "DeleteAPIKey", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
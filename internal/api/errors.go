@@ -0,0 +1,19 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/syafae/femProject/internal/utils"
+)
+
+// writeError answers with the problem err maps to. Only errors that become
+// a server error are logged, as op; a missing row or a taken username is an
+// expected outcome.
+func writeError(logger *slog.Logger, w http.ResponseWriter, r *http.Request, op string, err error) {
+	problem := utils.ProblemFor(err)
+	if problem.Status >= http.StatusInternalServerError {
+		logger.ErrorContext(r.Context(), op, "error", err)
+	}
+	utils.WriteProblem(w, r, problem)
+}
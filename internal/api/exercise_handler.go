@@ -0,0 +1,154 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+const maxExerciseAliases = 20
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *slog.Logger
+}
+
+type createExerciseRequest struct {
+	Name             string   `json:"name"`
+	Aliases          []string `json:"aliases"`
+	Category         string   `json:"category"`
+	PrimaryMuscles   []string `json:"primary_muscles"`
+	SecondaryMuscles []string `json:"secondary_muscles"`
+	Equipment        []string `json:"equipment"`
+	Measurement      string   `json:"measurement"`
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *slog.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore: exerciseStore,
+		logger:        logger,
+	}
+}
+
+// checkVocabulary adds a problem to v for every value of field that is not
+// in vocabulary, which is a list of what noun names, and for values given
+// twice.
+func checkVocabulary(v *utils.ValidationError, field, noun string, values, vocabulary []string) {
+	for i, value := range values {
+		if !slices.Contains(vocabulary, value) {
+			v.Add(field, "invalid", fmt.Sprintf("unknown %s %q", noun, value))
+		} else if slices.Contains(values[:i], value) {
+			v.Add(field, "duplicate", fmt.Sprintf("%q is given twice", value))
+		}
+	}
+}
+
+func (h *ExerciseHandler) validateCreateRequest(req *createExerciseRequest) error {
+	v := &utils.ValidationError{}
+	v.Check(req.Name != "", "name", "required", "name is required")
+	v.Check(utf8.RuneCountInString(req.Name) <= maxExerciseNameLength, "name", "too_long",
+		fmt.Sprintf("name cannot be longer than %d characters", maxExerciseNameLength))
+
+	v.Check(len(req.Aliases) <= maxExerciseAliases, "aliases", "too_many",
+		fmt.Sprintf("an exercise cannot have more than %d aliases", maxExerciseAliases))
+	for i, alias := range req.Aliases {
+		field := fmt.Sprintf("aliases[%d]", i)
+		v.Check(alias != "", field, "required", "aliases cannot be empty")
+		v.Check(utf8.RuneCountInString(alias) <= maxExerciseNameLength, field, "too_long",
+			fmt.Sprintf("aliases cannot be longer than %d characters", maxExerciseNameLength))
+		taken := strings.EqualFold(alias, req.Name) || slices.ContainsFunc(req.Aliases[:i], func(a string) bool {
+			return strings.EqualFold(a, alias)
+		})
+		v.Check(!taken, field, "duplicate", fmt.Sprintf("%q is already a name of this exercise", alias))
+	}
+
+	if req.Category == "" {
+		v.Add("category", "required", "category is required")
+	} else if !slices.Contains(store.ExerciseCategories, req.Category) {
+		v.Add("category", "invalid", "category must be one of "+strings.Join(store.ExerciseCategories, ", "))
+	}
+	if req.Measurement == "" {
+		v.Add("measurement", "required", "measurement is required")
+	} else if !slices.Contains(store.Measurements, req.Measurement) {
+		v.Add("measurement", "invalid", "measurement must be one of "+strings.Join(store.Measurements, ", "))
+	}
+
+	v.Check(len(req.PrimaryMuscles) > 0, "primary_muscles", "required", "at least one primary muscle is required")
+	checkVocabulary(v, "primary_muscles", "muscle", req.PrimaryMuscles, store.MuscleGroups)
+	checkVocabulary(v, "secondary_muscles", "muscle", req.SecondaryMuscles, store.MuscleGroups)
+	for _, muscle := range req.SecondaryMuscles {
+		v.Check(!slices.Contains(req.PrimaryMuscles, muscle), "secondary_muscles", "duplicate",
+			fmt.Sprintf("%q is already a primary muscle", muscle))
+	}
+	checkVocabulary(v, "equipment", "equipment", req.Equipment, store.Equipment)
+	return v.Err()
+}
+
+func (h *ExerciseHandler) HandleListExercises(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.ExerciseFilter{
+		UserID:   middleware.GetUser(r).ID,
+		Query:    strings.TrimSpace(query.Get("q")),
+		Category: query.Get("category"),
+		Muscle:   query.Get("muscle"),
+	}
+	if filter.Category != "" && !slices.Contains(store.ExerciseCategories, filter.Category) {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter,
+			"category must be one of "+strings.Join(store.ExerciseCategories, ", "))
+		return
+	}
+	if filter.Muscle != "" && !slices.Contains(store.MuscleGroups, filter.Muscle) {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "unknown muscle "+filter.Muscle)
+		return
+	}
+
+	exercises, err := h.exerciseStore.ListExercises(r.Context(), filter)
+	if err != nil {
+		writeError(h.logger, w, r, "ListExercises", err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"exercises": exercises})
+}
+
+// HandleCreateExercise adds a custom exercise, visible only to the user who
+// creates it.
+func (h *ExerciseHandler) HandleCreateExercise(w http.ResponseWriter, r *http.Request) {
+	var req createExerciseRequest
+	if err := utils.ReadJSON(w, r, &req); err != nil {
+		h.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteError(w, r, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	for i := range req.Aliases {
+		req.Aliases[i] = strings.TrimSpace(req.Aliases[i])
+	}
+	if err := h.validateCreateRequest(&req); err != nil {
+		utils.WriteError(w, r, err)
+		return
+	}
+
+	user := middleware.GetUser(r)
+	exercise := &store.Exercise{
+		UserID:           &user.ID,
+		Name:             req.Name,
+		Aliases:          req.Aliases,
+		Category:         req.Category,
+		PrimaryMuscles:   req.PrimaryMuscles,
+		SecondaryMuscles: req.SecondaryMuscles,
+		Equipment:        req.Equipment,
+		Measurement:      req.Measurement,
+	}
+	if err := h.exerciseStore.CreateExercise(r.Context(), exercise); err != nil {
+		writeError(h.logger, w, r, "CreateExercise", err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"exercise": exercise})
+}
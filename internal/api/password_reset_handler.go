@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/syafae/femProject/internal/mailer"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+const passwordResetTokenTTL = 45 * time.Minute
+
+type PasswordResetHandler struct {
+	userStore  store.UserStore
+	tokenStore store.TokenStore
+	mailer     mailer.Mailer
+	logger     *slog.Logger
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func NewPasswordResetHandler(userStore store.UserStore, tokenStore store.TokenStore, mailer mailer.Mailer, logger *slog.Logger) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		mailer:     mailer,
+		logger:     logger,
+	}
+}
+
+// HandleRequestPasswordReset emails a reset token to the account with the
+// given address. It answers the same way whether or not the account exists
+// so it cannot be used to discover registered emails.
+func (h *PasswordResetHandler) HandleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		h.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	accepted := utils.Envelope{"message": "if an account with that email exists, a password reset link has been sent"}
+
+	user, err := h.userStore.GetUserByEmail(r.Context(), req.Email)
+	if errors.Is(err, store.ErrNotFound) {
+		utils.WriteJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+	if err != nil {
+		writeError(h.logger, w, r, "GetUserByEmail", err)
+		return
+	}
+
+	// only the most recently requested token stays valid
+	err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		writeError(h.logger, w, r, "DeleteAllTokensForUser", err)
+		return
+	}
+	token, err := h.tokenStore.CreateNewToken(r.Context(), user.ID, passwordResetTokenTTL, tokens.ScopePasswordReset)
+	if err != nil {
+		writeError(h.logger, w, r, "CreateNewToken", err)
+		return
+	}
+
+	err = h.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the token below to choose a new password. It expires in %d minutes.\n\n%s\n\n"+
+			"If you did not ask for a password reset you can ignore this email.\n",
+			user.UserName, int(passwordResetTokenTTL.Minutes()), token.Plaintext),
+	})
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Send", "error", err)
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, accepted)
+}
+
+// HandleConfirmPasswordReset sets a new password using a reset token and
+// signs the user out of every existing session.
+func (h *PasswordResetHandler) HandleConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req passwordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		h.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	if err := validatePassword(req.Password); err != nil {
+		utils.WriteError(w, r, utils.NewFieldError("password", "too_weak", err.Error()))
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(r.Context(), tokens.ScopePasswordReset, req.Token)
+	if errors.Is(err, store.ErrNotFound) {
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid or expired password reset token")
+		return
+	}
+	if err != nil {
+		writeError(h.logger, w, r, "GetUserToken", err)
+		return
+	}
+
+	if _, err = user.PasswordHash.Set(req.Password); err != nil {
+		writeError(h.logger, w, r, "hashing password", err)
+		return
+	}
+	if err = h.userStore.UpdatePassword(r.Context(), user); err != nil {
+		writeError(h.logger, w, r, "UpdatePassword", err)
+		return
+	}
+
+	for _, scope := range []string{tokens.ScopePasswordReset, tokens.ScopeAuth, tokens.ScopeRefresh} {
+		if err = h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, scope); err != nil {
+			writeError(h.logger, w, r, "DeleteAllTokensForUser", err)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "your password was reset successfully"})
+}
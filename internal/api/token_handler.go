@@ -1,63 +1,367 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/syafae/femProject/internal/config"
+	"github.com/syafae/femProject/internal/lockout"
+	"github.com/syafae/femProject/internal/metrics"
+	"github.com/syafae/femProject/internal/middleware"
 	"github.com/syafae/femProject/internal/store"
 	"github.com/syafae/femProject/internal/tokens"
+	"github.com/syafae/femProject/internal/totp"
 	"github.com/syafae/femProject/internal/utils"
 )
 
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *log.Logger
+	tokenStore  store.TokenStore
+	userStore   store.UserStore
+	auditStore  store.LoginAuditStore
+	userTracker lockout.Tracker
+	ipTracker   lockout.Tracker
+	cipher      *totp.Cipher
+	ttls        config.TokenConfig
+	metrics     metrics.Metrics
+	logger      *slog.Logger
 }
 
 type createTokenRequest struct {
-	UserName string `json:"username"`
-	Password string `json:"password"`
+	UserName    string `json:"username"`
+	Password    string `json:"password"`
+	DeviceLabel string `json:"device_label"`
+	// only needed when the user enabled two-factor authentication
+	TOTPCode     string `json:"totp_code"`
+	RecoveryCode string `json:"recovery_code"`
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	DeviceLabel  string `json:"device_label"`
+}
+
+// NewTokenHandler wires the token endpoints. userTracker and ipTracker count
+// failed logins per username and per client IP respectively.
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, auditStore store.LoginAuditStore,
+	userTracker, ipTracker lockout.Tracker, cipher *totp.Cipher, ttls config.TokenConfig, m metrics.Metrics, logger *slog.Logger) *TokenHandler {
 	return &TokenHandler{
-		tokenStore: tokenStore,
-		userStore:  userStore,
-		logger:     logger,
+		tokenStore:  tokenStore,
+		userStore:   userStore,
+		auditStore:  auditStore,
+		userTracker: userTracker,
+		ipTracker:   ipTracker,
+		cipher:      cipher,
+		ttls:        ttls,
+		metrics:     m,
+		logger:      logger,
+	}
+}
+
+// attemptKey is a key of a lockout tracker that attempts are counted under.
+type attemptKey struct {
+	tracker lockout.Tracker
+	key     string
+}
+
+// attemptKeys returns the keys for an attempt, one per username and one per
+// client IP. Usernames are case folded so the limit cannot be sidestepped by
+// changing case.
+func attemptKeys(r *http.Request, userTracker, ipTracker lockout.Tracker, username string) (attemptKey, attemptKey) {
+	return attemptKey{userTracker, "user:" + strings.ToLower(username)},
+		attemptKey{ipTracker, "ip:" + utils.ClientIP(r)}
+}
+
+// reserveAttempt counts an attempt as failed on every key before it is made,
+// see lockout.Tracker.Reserve, and returns zero. When one of the keys has to
+// wait, the reservations made so far are released and the wait is returned.
+func reserveAttempt(ctx context.Context, logger *slog.Logger, keys ...attemptKey) time.Duration {
+	for i, k := range keys {
+		wait, err := k.tracker.Reserve(ctx, k.key)
+		if err != nil {
+			// fail open: an unavailable tracker must not lock everybody out
+			logger.ErrorContext(ctx, "lockout Reserve", "error", err)
+			continue
+		}
+		if wait > 0 {
+			releaseAttempt(ctx, logger, keys[:i]...)
+			return wait
+		}
+	}
+	return 0
+}
+
+// releaseAttempt takes back the reservations of an attempt that succeeded.
+func releaseAttempt(ctx context.Context, logger *slog.Logger, keys ...attemptKey) {
+	for _, k := range keys {
+		if err := k.tracker.Release(ctx, k.key); err != nil {
+			logger.ErrorContext(ctx, "lockout Release", "error", err)
+		}
+	}
+}
+
+// lockoutWait returns how long the next attempt on keys has to wait.
+func lockoutWait(ctx context.Context, logger *slog.Logger, keys ...attemptKey) time.Duration {
+	var wait time.Duration
+	for _, k := range keys {
+		d, err := k.tracker.Check(ctx, k.key)
+		if err != nil {
+			logger.ErrorContext(ctx, "lockout Check", "error", err)
+			continue
+		}
+		wait = max(wait, d)
+	}
+	return wait
+}
+
+// reserveLogin reserves a login attempt for username. It writes a 429
+// response and returns false when the username or the client IP has to wait
+// before trying again.
+func (h *TokenHandler) reserveLogin(w http.ResponseWriter, r *http.Request, username string) bool {
+	userKey, ipKey := attemptKeys(r, h.userTracker, h.ipTracker, username)
+	wait := reserveAttempt(r.Context(), h.logger, userKey, ipKey)
+	if wait == 0 {
+		return true
+	}
+
+	h.recordFailedLogin(r, username, nil, store.LoginFailureLockedOut)
+	writeLockedOut(w, r, wait)
+	return false
+}
+
+// setRetryAfter tells the client how long to wait after a failed attempt.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+func writeLockedOut(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	utils.WriteErrorCode(w, r, http.StatusTooManyRequests, utils.CodeTooManyAttempts,
+		fmt.Sprintf("too many failed attempts, try again in %d seconds", seconds))
+}
+
+func (h *TokenHandler) recordFailedLogin(r *http.Request, username string, userID *int, reason string) {
+	h.metrics.AuthFailure(reason)
+	err := h.auditStore.RecordFailedLogin(r.Context(), &store.FailedLogin{
+		UserName:  username,
+		UserID:    userID,
+		IP:        utils.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Reason:    reason,
+	})
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "RecordFailedLogin", "error", err)
 	}
 }
 
+// failLogin audits a failed attempt, which reserveLogin already counted, and
+// writes the response. Unknown users and wrong passwords get the same answer
+// so the endpoint does not reveal which usernames exist.
+func (h *TokenHandler) failLogin(w http.ResponseWriter, r *http.Request, username string, userID *int, reason string) {
+	h.recordFailedLogin(r, username, userID, reason)
+
+	userKey, ipKey := attemptKeys(r, h.userTracker, h.ipTracker, username)
+	if wait := lockoutWait(r.Context(), h.logger, userKey, ipKey); wait > 0 {
+		setRetryAfter(w, wait)
+	}
+
+	if reason == store.LoginFailureInvalidTOTP {
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidTwoFactorCode, "invalid two-factor code")
+		return
+	}
+	utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidCredentials, "invalid username or password")
+}
+
 func (h *TokenHandler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
 	var req createTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Printf("Error: decoding request body:%v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request body"})
+		h.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
 		return
 	}
 
-	user, err := h.userStore.GetUserByName(req.UserName)
-	if err != nil || user == nil {
-		h.logger.Printf("ERROR: GetUserByName: %v", err)
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "User not found"})
+	if !h.reserveLogin(w, r, req.UserName) {
+		return
+	}
+	// the attempt counts as failed unless it is released below; server
+	// errors leave it counted
+	userKey, ipKey := attemptKeys(r, h.userTracker, h.ipTracker, req.UserName)
+
+	user, err := h.userStore.GetUserByName(r.Context(), req.UserName)
+	if errors.Is(err, store.ErrNotFound) {
+		store.SimulatePasswordCheck(req.Password)
+		h.failLogin(w, r, req.UserName, nil, store.LoginFailureUnknownUser)
+		return
+	}
+	if err != nil {
+		writeError(h.logger, w, r, "GetUserByName", err)
 		return
 	}
 
 	isValid, err := user.PasswordHash.Matches(req.Password)
-	if err != nil || !isValid {
-		h.logger.Printf("ERROR PasswordHash.Matches:%v", err)
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Invalid password"})
+	if err != nil {
+		writeError(h.logger, w, r, "PasswordHash.Matches", err)
+		return
+	}
+	if !isValid {
+		h.failLogin(w, r, req.UserName, &user.ID, store.LoginFailureInvalidPassword)
+		return
+	}
+
+	if user.Disabled {
+		releaseAttempt(r.Context(), h.logger, userKey, ipKey)
+		utils.WriteErrorCode(w, r, http.StatusForbidden, utils.CodeAccountDisabled, "your user account has been disabled")
+		return
+	}
+
+	if user.TwoFactor {
+		if req.TOTPCode == "" && req.RecoveryCode == "" {
+			releaseAttempt(r.Context(), h.logger, userKey, ipKey)
+			utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeTwoFactorRequired, "two-factor code required")
+			return
+		}
+		err = verifySecondFactor(r.Context(), h.userStore, h.cipher, user.ID, req.TOTPCode, req.RecoveryCode)
+		if errors.Is(err, errInvalidSecondFactor) {
+			h.failLogin(w, r, req.UserName, &user.ID, store.LoginFailureInvalidTOTP)
+			return
+		}
+		if err != nil {
+			writeError(h.logger, w, r, "verifySecondFactor", err)
+			return
+		}
+	}
+
+	// only the username is forgiven; the IP keeps its count so an attacker
+	// cannot reset it by logging into an account of their own
+	if err = h.userTracker.Reset(r.Context(), userKey.key); err != nil {
+		h.logger.ErrorContext(r.Context(), "lockout Reset", "error", err)
+	}
+	releaseAttempt(r.Context(), h.logger, ipKey)
+
+	token, refreshToken, err := h.tokenStore.CreateTokenPair(r.Context(), user.ID, h.ttls.AuthTTL, h.ttls.RefreshTTL, middleware.RequestClient(r, req.DeviceLabel))
+	if err != nil {
+		writeError(h.logger, w, r, "CreateTokenPair", err)
+		return
+	}
+	h.metrics.TokenIssued(tokens.ScopeAuth)
+	h.metrics.TokenIssued(tokens.ScopeRefresh)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"token": token, "refresh_token": refreshToken})
+}
+
+func (h *TokenHandler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		h.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	token, refreshToken, err := h.tokenStore.RotateRefreshToken(r.Context(), req.RefreshToken, h.ttls.AuthTTL, h.ttls.RefreshTTL, middleware.RequestClient(r, req.DeviceLabel))
+	if errors.Is(err, store.ErrTokenReused) {
+		h.logger.WarnContext(r.Context(), "RotateRefreshToken", "error", err)
+		h.metrics.AuthFailure("refresh_token_reused")
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid or expired refresh token")
+		return
+	}
+	if errors.Is(err, store.ErrInvalidToken) {
+		h.metrics.AuthFailure("invalid_refresh_token")
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid or expired refresh token")
+		return
+	}
+	if err != nil {
+		writeError(h.logger, w, r, "RotateRefreshToken", err)
+		return
+	}
+	h.metrics.TokenIssued(tokens.ScopeAuth)
+	h.metrics.TokenIssued(tokens.ScopeRefresh)
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"token": token, "refresh_token": refreshToken})
+}
+
+// HandleDeleteCurrentToken logs out the current session by revoking the
+// presented authentication token together with its refresh token family.
+func (h *TokenHandler) HandleDeleteCurrentToken(w http.ResponseWriter, r *http.Request) {
+	token, err := h.tokenStore.GetTokenByHash(r.Context(), tokens.HashPlaintext(middleware.GetToken(r)))
+	if errors.Is(err, store.ErrNotFound) {
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid or expired token")
+		return
+	}
+	if err != nil {
+		writeError(h.logger, w, r, "GetTokenByHash", err)
+		return
+	}
+
+	if token.Family != "" {
+		err = h.tokenStore.DeleteTokenFamily(r.Context(), token.Family)
+	} else {
+		err = h.tokenStore.DeleteToken(r.Context(), token)
+	}
+	if err != nil {
+		writeError(h.logger, w, r, "DeleteToken", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDeleteAllTokens logs the current user out of every session.
+func (h *TokenHandler) HandleDeleteAllTokens(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh} {
+		err := h.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, scope)
+		if err != nil {
+			writeError(h.logger, w, r, "DeleteAllTokensForUser", err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListSessions lists the devices the current user is logged in on.
+func (h *TokenHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	sessions, err := h.tokenStore.ListSessions(r.Context(), user.ID)
+	if err != nil {
+		writeError(h.logger, w, r, "ListSessions", err)
+		return
+	}
+
+	current, err := h.tokenStore.GetTokenByHash(r.Context(), tokens.HashPlaintext(middleware.GetToken(r)))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(h.logger, w, r, "GetTokenByHash", err)
+		return
+	}
+	for _, session := range sessions {
+		session.Current = current != nil && session.ID == current.ID
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"sessions": sessions})
+}
+
+// HandleDeleteSession revokes one of the current user's sessions by id.
+func (h *TokenHandler) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "invalid session id")
 		return
 	}
 
-	token, err := h.tokenStore.CreateNewToken(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	user := middleware.GetUser(r)
+	err = h.tokenStore.DeleteSession(r.Context(), user.ID, sessionID)
 	if err != nil {
-		h.logger.Printf("ERROR CreateNewToken: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Internal server error"})
+		writeError(h.logger, w, r, "DeleteSession", err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"token": token})
+	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/syafae/femProject/internal/lockout"
+	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/totp"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+const (
+	totpIssuer        = "femProject"
+	recoveryCodeCount = 10
+)
+
+var errInvalidSecondFactor = errors.New("invalid two-factor code")
+
+type TwoFactorHandler struct {
+	userStore   store.UserStore
+	userTracker lockout.Tracker
+	ipTracker   lockout.Tracker
+	cipher      *totp.Cipher
+	logger      *slog.Logger
+}
+
+type totpCodeRequest struct {
+	TOTPCode string `json:"totp_code"`
+}
+
+// NewTwoFactorHandler wires the two-factor endpoints. Wrong codes are
+// counted by the same trackers as failed logins, see NewTokenHandler.
+func NewTwoFactorHandler(userStore store.UserStore, userTracker, ipTracker lockout.Tracker, cipher *totp.Cipher, logger *slog.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		userStore:   userStore,
+		userTracker: userTracker,
+		ipTracker:   ipTracker,
+		cipher:      cipher,
+		logger:      logger,
+	}
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code,
+// for a user with two-factor authentication enabled. Both are single use.
+func verifySecondFactor(ctx context.Context, userStore store.UserStore, cipher *totp.Cipher, userID int, totpCode, recoveryCode string) error {
+	if totpCode != "" {
+		encrypted, err := userStore.GetTOTPSecret(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if encrypted == nil {
+			return errInvalidSecondFactor
+		}
+		secret, err := cipher.Decrypt(encrypted)
+		if err != nil {
+			return err
+		}
+		step, ok := totp.Validate(secret, totpCode, time.Now())
+		if !ok {
+			return errInvalidSecondFactor
+		}
+		fresh, err := userStore.AdvanceTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	if recoveryCode != "" {
+		ok, err := userStore.UseRecoveryCode(ctx, userID, totp.HashRecoveryCode(recoveryCode))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidSecondFactor
+		}
+		return nil
+	}
+
+	return errInvalidSecondFactor
+}
+
+// HandleBeginEnrollment creates a TOTP secret and recovery codes for the
+// current user. Two-factor authentication only becomes active once a first
+// code is confirmed through HandleConfirmEnrollment.
+func (h *TwoFactorHandler) HandleBeginEnrollment(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.TwoFactor {
+		utils.WriteErrorCode(w, r, http.StatusConflict, utils.CodeConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		writeError(h.logger, w, r, "GenerateSecret", err)
+		return
+	}
+	encrypted, err := h.cipher.Encrypt(secret)
+	if err != nil {
+		writeError(h.logger, w, r, "Encrypt", err)
+		return
+	}
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		writeError(h.logger, w, r, "GenerateRecoveryCodes", err)
+		return
+	}
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+
+	err = h.userStore.BeginTOTPEnrollment(r.Context(), user.ID, encrypted, hashes)
+	if err != nil {
+		writeError(h.logger, w, r, "BeginTOTPEnrollment", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"otpauth_uri":    totp.URI(totpIssuer, user.UserName, secret),
+		"secret":         secret,
+		"recovery_codes": codes,
+	})
+}
+
+func (h *TwoFactorHandler) HandleConfirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+	if req.TOTPCode == "" {
+		utils.WriteError(w, r, utils.NewFieldError("totp_code", "required", "totp_code is required"))
+		return
+	}
+
+	user := middleware.GetUser(r)
+	if user.TwoFactor {
+		utils.WriteErrorCode(w, r, http.StatusConflict, utils.CodeConflict, "two-factor authentication is already enabled")
+		return
+	}
+	encrypted, err := h.userStore.GetTOTPSecret(r.Context(), user.ID)
+	if err != nil {
+		writeError(h.logger, w, r, "GetTOTPSecret", err)
+		return
+	}
+	if encrypted == nil {
+		utils.WriteErrorCode(w, r, http.StatusConflict, utils.CodeConflict, "two-factor enrollment has not been started")
+		return
+	}
+	secret, err := h.cipher.Decrypt(encrypted)
+	if err != nil {
+		writeError(h.logger, w, r, "Decrypt", err)
+		return
+	}
+	step, ok := totp.Validate(secret, req.TOTPCode, time.Now())
+	if !ok {
+		utils.WriteErrorCode(w, r, http.StatusUnprocessableEntity, utils.CodeInvalidTwoFactorCode, "invalid two-factor code")
+		return
+	}
+
+	if err = h.userStore.EnableTOTP(r.Context(), user.ID, step); err != nil {
+		writeError(h.logger, w, r, "EnableTOTP", err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"two_factor_enabled": true})
+}
+
+// HandleDisable turns two-factor authentication off; it requires a current
+// TOTP code so a stolen session alone cannot remove the second factor. Wrong
+// codes count as failed logins, so they cannot be guessed here either.
+func (h *TwoFactorHandler) HandleDisable(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TOTPCode     string `json:"totp_code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	if !user.TwoFactor {
+		utils.WriteErrorCode(w, r, http.StatusConflict, utils.CodeConflict, "two-factor authentication is not enabled")
+		return
+	}
+	userKey, ipKey := attemptKeys(r, h.userTracker, h.ipTracker, user.UserName)
+	if wait := reserveAttempt(r.Context(), h.logger, userKey, ipKey); wait > 0 {
+		writeLockedOut(w, r, wait)
+		return
+	}
+	err := verifySecondFactor(r.Context(), h.userStore, h.cipher, user.ID, req.TOTPCode, req.RecoveryCode)
+	if errors.Is(err, errInvalidSecondFactor) {
+		if wait := lockoutWait(r.Context(), h.logger, userKey, ipKey); wait > 0 {
+			setRetryAfter(w, wait)
+		}
+		utils.WriteErrorCode(w, r, http.StatusUnprocessableEntity, utils.CodeInvalidTwoFactorCode, "invalid two-factor code")
+		return
+	}
+	if err != nil {
+		writeError(h.logger, w, r, "verifySecondFactor", err)
+		return
+	}
+	releaseAttempt(r.Context(), h.logger, userKey, ipKey)
+
+	if err = h.userStore.DisableTOTP(r.Context(), user.ID); err != nil {
+		writeError(h.logger, w, r, "DisableTOTP", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
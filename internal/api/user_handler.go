@@ -1,14 +1,22 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/syafae/femProject/internal/mailer"
+	"github.com/syafae/femProject/internal/metrics"
+	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/roles"
 	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
 	"github.com/syafae/femProject/internal/utils"
 )
 
@@ -17,69 +25,126 @@ type registeredUserRequest struct {
 	Email    string `json:"email"`
 	Bio      string `json:"bio"`
 	Password string `json:"password"`
+	Timezone string `json:"timezone"`
 }
 
+// updateUserRequest changes the profile of a user. The username in the
+// path picks the user and cannot be changed.
+type updateUserRequest struct {
+	Email    string `json:"email"`
+	Bio      string `json:"bio"`
+	Timezone string `json:"timezone"`
+	// Password is only decoded to be refused: passwords change through the
+	// password reset flow, which also revokes the user's sessions.
+	Password string `json:"password"`
+}
+
+type activateUserRequest struct {
+	Token string `json:"token"`
+}
+
+type resendActivationRequest struct {
+	Email string `json:"email"`
+}
+
+const activationTokenTTL = 3 * 24 * time.Hour
+
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore  store.UserStore
+	tokenStore store.TokenStore
+	mailer     mailer.Mailer
+	metrics    metrics.Metrics
+	logger     *slog.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, mailer mailer.Mailer, m metrics.Metrics, logger *slog.Logger) *UserHandler {
 	return &UserHandler{
-		userStore: userStore,
-		logger:    logger,
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		mailer:     mailer,
+		metrics:    m,
+		logger:     logger,
 	}
 }
 
-func (uh *UserHandler) validateregisterRequest(reg *registeredUserRequest) error {
-	if reg.UserName == "" {
-		return errors.New("username is required")
-	}
-	if len(reg.UserName) > 50 {
-		return errors.New("username cannot be greater than 50 characters")
-	}
-	emailregex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}(?:\.[a-zA-Z]{2,})?$`)
-	if !emailregex.MatchString(reg.Email) {
-		return errors.New("invalid email format")
-	}
-	if len(reg.Password) < 8 {
+func validatePassword(password string) error {
+	if len(password) < 8 {
 		return errors.New("password must be at least 8 characters long")
 	}
-	if !regexp.MustCompile(`[a-z]`).MatchString(reg.Password) {
+	if !regexp.MustCompile(`[a-z]`).MatchString(password) {
 		return errors.New("password must include at least one lowercase letter")
 	}
-	if !regexp.MustCompile(`[A-Z]`).MatchString(reg.Password) {
+	if !regexp.MustCompile(`[A-Z]`).MatchString(password) {
 		return errors.New("password must include at least one uppercase letter")
 	}
-	if !regexp.MustCompile(`\d`).MatchString(reg.Password) {
+	if !regexp.MustCompile(`\d`).MatchString(password) {
 		return errors.New("password must include at least one number")
 	}
-	if !regexp.MustCompile(`[@$!%*?&]`).MatchString(reg.Password) {
+	if !regexp.MustCompile(`[@$!%*?&]`).MatchString(password) {
 		return errors.New("password must include at least one special character")
 	}
-
 	return nil
 }
 
+// validateregisterRequest reports every invalid field of reg in a
+// utils.ValidationError.
+func (uh *UserHandler) validateregisterRequest(reg *registeredUserRequest) error {
+	v := &utils.ValidationError{}
+	if reg.UserName == "" {
+		v.Add("username", "required", "username is required")
+	} else if len(reg.UserName) > 50 {
+		v.Add("username", "too_long", "username cannot be greater than 50 characters")
+	}
+	validateProfile(v, reg.Email, reg.Timezone)
+	if err := validatePassword(reg.Password); err != nil {
+		v.Add("password", "too_weak", err.Error())
+	}
+	return v.Err()
+}
+
+// validateUpdateRequest reports every invalid field of req in a
+// utils.ValidationError.
+func (uh *UserHandler) validateUpdateRequest(req *updateUserRequest) error {
+	v := &utils.ValidationError{}
+	validateProfile(v, req.Email, req.Timezone)
+	v.Check(req.Password == "", "password", "not_allowed", "password cannot be changed here, use the password reset flow")
+	return v.Err()
+}
+
+// validateProfile adds the problems of the fields shared by registration
+// and profile updates to v.
+func validateProfile(v *utils.ValidationError, email, timezone string) {
+	emailregex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}(?:\.[a-zA-Z]{2,})?$`)
+	if !emailregex.MatchString(email) {
+		v.Add("email", "invalid_format", "invalid email format")
+	}
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			v.Add("timezone", "invalid", "timezone must be a valid IANA time zone name")
+		}
+	}
+}
+
 func (uh *UserHandler) HandleRegiserUserRequest(w http.ResponseWriter, r *http.Request) {
 	var req registeredUserRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		uh.logger.Printf("Error decoding request body:%v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		uh.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
 		return
 	}
 
 	err = uh.validateregisterRequest(&req)
 	if err != nil {
-		uh.logger.Printf("Error: validateregisterRequest %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		uh.logger.WarnContext(r.Context(), "validating register request", "error", err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
 	user := &store.User{
 		UserName: req.UserName,
 		Email:    req.Email,
+		Timezone: req.Timezone,
 	}
 	if req.Bio != "" {
 		user.Bio = req.Bio
@@ -87,65 +152,182 @@ func (uh *UserHandler) HandleRegiserUserRequest(w http.ResponseWriter, r *http.R
 
 	_, err = user.PasswordHash.Set(req.Password)
 	if err != nil {
-		uh.logger.Printf("ERROR: hashing password %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "internal server error"})
+		writeError(uh.logger, w, r, "hashing password", err)
 		return
 	}
 
-	err = uh.userStore.CreateUser(user)
+	err = uh.userStore.CreateUser(r.Context(), user)
 	if err != nil {
-		uh.logger.Printf("ERROR: CreateUser %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		writeError(uh.logger, w, r, "CreateUser", err)
 		return
 	}
+	uh.metrics.UserRegistered()
+
+	token, err := uh.tokenStore.CreateNewToken(r.Context(), user.ID, activationTokenTTL, tokens.ScopeActivation)
+	if err != nil {
+		writeError(uh.logger, w, r, "CreateNewToken", err)
+		return
+	}
+	if err := uh.sendActivationEmail(user, token); err != nil {
+		// the account exists either way; the user can ask for a new email
+		// through HandleResendActivation
+		uh.logger.ErrorContext(r.Context(), "Send", "error", err)
+	}
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"user": user})
 }
 
+func (uh *UserHandler) sendActivationEmail(user *store.User, token *tokens.Token) error {
+	return uh.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Activate your account",
+		Body: fmt.Sprintf("Hi %s,\n\nThanks for signing up. Use the token below to activate your account. It expires in %d days.\n\n%s\n",
+			user.UserName, int(activationTokenTTL.Hours()/24), token.Plaintext),
+	})
+}
+
+// HandleResendActivation emails a new activation token to the account with
+// the given address, for users whose first email expired or never arrived.
+// Like a password reset request it answers the same way whether or not an
+// inactive account with that address exists.
+func (uh *UserHandler) HandleResendActivation(w http.ResponseWriter, r *http.Request) {
+	var req resendActivationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		uh.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	accepted := utils.Envelope{"message": "if an inactive account with that email exists, a new activation email has been sent"}
+
+	user, err := uh.userStore.GetUserByEmail(r.Context(), req.Email)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && user.Activated) {
+		utils.WriteJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+	if err != nil {
+		writeError(uh.logger, w, r, "GetUserByEmail", err)
+		return
+	}
+
+	if err := uh.resendActivation(r.Context(), user); err != nil {
+		writeError(uh.logger, w, r, "resendActivation", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, accepted)
+}
+
+// resendActivation replaces the activation tokens of user with a new one
+// and emails it. A failed email is only logged, since the user can ask for
+// another one.
+func (uh *UserHandler) resendActivation(ctx context.Context, user *store.User) error {
+	// only the most recently sent token stays valid
+	err := uh.tokenStore.DeleteAllTokensForUser(ctx, user.ID, tokens.ScopeActivation)
+	if err != nil {
+		return fmt.Errorf("DeleteAllTokensForUser: %w", err)
+	}
+	token, err := uh.tokenStore.CreateNewToken(ctx, user.ID, activationTokenTTL, tokens.ScopeActivation)
+	if err != nil {
+		return fmt.Errorf("CreateNewToken: %w", err)
+	}
+	if err := uh.sendActivationEmail(user, token); err != nil {
+		uh.logger.ErrorContext(ctx, "Send", "error", err)
+	}
+	return nil
+}
+
+func (uh *UserHandler) HandleActivateUser(w http.ResponseWriter, r *http.Request) {
+	var req activateUserRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		uh.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
+		return
+	}
+
+	user, err := uh.userStore.GetUserToken(r.Context(), tokens.ScopeActivation, req.Token)
+	if errors.Is(err, store.ErrNotFound) {
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid or expired activation token")
+		return
+	}
+	if err != nil {
+		writeError(uh.logger, w, r, "GetUserToken", err)
+		return
+	}
+
+	user.Activated = true
+	err = uh.userStore.UpdateUser(r.Context(), user)
+	if err != nil {
+		writeError(uh.logger, w, r, "UpdateUser", err)
+		return
+	}
+
+	err = uh.tokenStore.DeleteAllTokensForUser(r.Context(), user.ID, tokens.ScopeActivation)
+	if err != nil {
+		writeError(uh.logger, w, r, "DeleteAllTokensForUser", err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
+}
+
 func (uh *UserHandler) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	username := chi.URLParam(r, "username")
 	if username == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username is required"})
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "username is required")
 		return
 	}
 
-	var req registeredUserRequest
+	var req updateUserRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		uh.logger.Printf("Error decoding request body:%v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		uh.logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidBody, "invalid request body")
 		return
 	}
 
-	err = uh.validateregisterRequest(&req)
+	err = uh.validateUpdateRequest(&req)
 	if err != nil {
-		uh.logger.Printf("Error: validateregisterRequest %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		uh.logger.WarnContext(r.Context(), "validating update request", "error", err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
-	user := &store.User{
-		UserName: username,
-		Email:    req.Email,
+	user, err := uh.userStore.GetUserByName(r.Context(), username)
+	if err != nil {
+		writeError(uh.logger, w, r, "GetUserByName", err)
+		return
+	}
+	currentUser := middleware.GetUser(r)
+	if currentUser.ID != user.ID && !middleware.Can(r, roles.UsersWrite) {
+		utils.WriteError(w, r, store.ErrForbidden)
+		return
+	}
+	// a new address has to be verified like the first one
+	emailChanged := req.Email != user.Email
+	if emailChanged {
+		user.Activated = false
+	}
+	user.Email = req.Email
+	if req.Timezone != "" {
+		user.Timezone = req.Timezone
 	}
 	if req.Bio != "" {
 		user.Bio = req.Bio
 	}
 
-	if req.Password != "" {
-		_, err = user.PasswordHash.Set(req.Password)
-		if err != nil {
-			uh.logger.Printf("ERROR: hashing password %v", err)
-			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "internal server error"})
-			return
-		}
-	}
-
-	err = uh.userStore.UpdateUser(user)
+	err = uh.userStore.UpdateUser(r.Context(), user)
 	if err != nil {
-		uh.logger.Printf("ERROR: UpdateUser %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		writeError(uh.logger, w, r, "UpdateUser", err)
 		return
 	}
+	if emailChanged {
+		if err := uh.resendActivation(r.Context(), user); err != nil {
+			writeError(uh.logger, w, r, "resendActivation", err)
+			return
+		}
+	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"user": user})
 
 }
@@ -154,19 +336,13 @@ func (uh *UserHandler) HandleGetUserByName(w http.ResponseWriter, r *http.Reques
 
 	username := chi.URLParam(r, "username")
 	if username == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "username is required"})
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "username is required")
 		return
 	}
 
-	user, err := uh.userStore.GetUserByName(username)
+	user, err := uh.userStore.GetUserByName(r.Context(), username)
 	if err != nil {
-		uh.logger.Printf("ERROR: GetUserByName %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
-		return
-	}
-
-	if user == nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		writeError(uh.logger, w, r, "GetUserByName", err)
 		return
 	}
 
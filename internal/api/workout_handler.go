@@ -1,85 +1,214 @@
 package api
 
 import (
-	"database/sql"
-	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/syafae/femProject/internal/metrics"
 	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/roles"
 	"github.com/syafae/femProject/internal/store"
 	"github.com/syafae/femProject/internal/utils"
 )
 
 type WorkoutHandler struct {
-	WorkoutStore store.WorkoutStore // the apis know only about the interface only to decouple the database from thr api
-	Logger       *log.Logger
+	WorkoutStore  store.WorkoutStore // the apis know only about the interface only to decouple the database from thr api
+	ExerciseStore store.ExerciseStore
+	Metrics       metrics.Metrics
+	Logger        *slog.Logger
 }
 
-func NewWorkoutHandler(workoutStore store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(workoutStore store.WorkoutStore, exerciseStore store.ExerciseStore, m metrics.Metrics, logger *slog.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
-		WorkoutStore: workoutStore,
-		Logger:       logger,
+		WorkoutStore:  workoutStore,
+		ExerciseStore: exerciseStore,
+		Metrics:       m,
+		Logger:        logger,
 	}
 }
 
 func (wh *WorkoutHandler) HandleGetWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.Logger.Printf("ERRR:ReadIDParam %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		wh.Logger.WarnContext(r.Context(), "ReadIDParam", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "invalid workout id")
 		return
 	}
-	workout, err := wh.WorkoutStore.GetWorkoutByID(workoutID)
+	workout, err := wh.WorkoutStore.GetWorkoutByID(r.Context(), workoutID)
 	if err != nil {
-		wh.Logger.Printf("ERRR:GetWorkoutByID %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		writeError(wh.Logger, w, r, "GetWorkoutByID", err)
+		return
+	}
+	if !canAccessWorkout(r, workout.UserID, roles.WorkoutsReadAny) {
+		// answer as if it did not exist so workout ids of other users
+		// cannot be probed
+		utils.WriteError(w, r, store.ErrNotFound)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": workout})
 }
 
+// canAccessWorkout reports whether the user of r may act on a workout owned
+// by ownerID: owners always can, anyone else needs permission from their
+// role, which API keys do not carry.
+func canAccessWorkout(r *http.Request, ownerID int, permission roles.Permission) bool {
+	return ownerID == middleware.GetUser(r).ID || middleware.Can(r, permission)
+}
+
+// authorizeWorkout returns store.ErrNotFound when the workout does not
+// exist or the user of r may not act on it, so the two cannot be told apart.
+func (wh *WorkoutHandler) authorizeWorkout(r *http.Request, workoutID int64, permission roles.Permission) error {
+	ownerID, err := wh.WorkoutStore.GetWorkoutOwnerID(r.Context(), workoutID)
+	if err != nil {
+		return err
+	}
+	if !canAccessWorkout(r, ownerID, permission) {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+const (
+	defaultWorkoutPageSize = 20
+	maxWorkoutPageSize     = 100
+)
+
+func (wh *WorkoutHandler) HandleListWorkouts(w http.ResponseWriter, r *http.Request) {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := store.WorkoutFilter{
+		UserID:   currentUser.ID,
+		Title:    query.Get("title"),
+		Exercise: query.Get("exercise"),
+		Cursor:   query.Get("cursor"),
+		Limit:    defaultWorkoutPageSize,
+	}
+
+	// sort=duration sorts ascending, sort=-duration descending; newest first by default
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = "-" + store.WorkoutSortDate
+	}
+	filter.SortDesc = strings.HasPrefix(sort, "-")
+	filter.SortBy = strings.TrimPrefix(sort, "-")
+	switch filter.SortBy {
+	case store.WorkoutSortDate, store.WorkoutSortDuration, store.WorkoutSortCalories:
+	default:
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "sort must be one of date, duration, calories")
+		return
+	}
+
+	var err error
+	if filter.From, err = utils.ReadTimeQuery(r, "from", currentUser.Location()); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return
+	}
+	if filter.To, err = utils.ReadTimeQuery(r, "to", currentUser.Location()); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return
+	}
+	// a plain date in "to" includes the whole day in the user's time zone
+	if filter.To != nil && len(query.Get("to")) == len(time.DateOnly) {
+		to := filter.To.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+	if filter.MinDuration, err = utils.ReadIntQuery(r, "min_duration"); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return
+	}
+	if filter.MaxDuration, err = utils.ReadIntQuery(r, "max_duration"); err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return
+	}
+	limit, err := utils.ReadIntQuery(r, "limit")
+	if err != nil {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, err.Error())
+		return
+	}
+	if limit != nil {
+		if *limit < 1 || *limit > maxWorkoutPageSize {
+			utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "limit must be between 1 and 100")
+			return
+		}
+		filter.Limit = *limit
+	}
+
+	workouts, nextCursor, err := wh.WorkoutStore.ListWorkouts(r.Context(), filter)
+	if errors.Is(err, store.ErrInvalidCursor) {
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "invalid cursor")
+		return
+	}
+	if err != nil {
+		writeError(wh.Logger, w, r, "ListWorkouts", err)
+		return
+	}
+	if workouts == nil {
+		workouts = []*store.Workout{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workouts": workouts, "next_cursor": nextCursor})
+}
+
 func (wh *WorkoutHandler) HandleCreateWorkout(w http.ResponseWriter, r *http.Request) {
 	var workout store.Workout
-	err := json.NewDecoder(r.Body).Decode(&workout)
+	err := utils.ReadJSON(w, r, &workout)
 	if err != nil {
-		wh.Logger.Printf("ERRR:decodingCreateWorkout %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request sent"})
+		wh.Logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteError(w, r, err)
 		return
 	}
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil || currentUser.IsAnonymous() {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeUnauthorized, "unauthorized")
 		return
 	}
 	workout.UserID = currentUser.ID
-	createdWorkout, err := wh.WorkoutStore.CreateWorkout(&workout)
+	if err = ValidateWorkout(r.Context(), wh.ExerciseStore, &workout); err != nil {
+		writeError(wh.Logger, w, r, "ValidateWorkout", err)
+		return
+	}
+	createdWorkout, err := wh.WorkoutStore.CreateWorkout(r.Context(), &workout)
 	if err != nil {
-		wh.Logger.Printf("ERRR:CreateWorkout %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		writeError(wh.Logger, w, r, "CreateWorkout", err)
 		return
 	}
+	wh.Metrics.WorkoutCreated()
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"createdWorkout": createdWorkout})
 
 }
 func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.Logger.Printf("ERRR:ReadIDParam %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		wh.Logger.WarnContext(r.Context(), "ReadIDParam", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "invalid workout id")
 		return
 	}
 
-	existingWorkout, err := wh.WorkoutStore.GetWorkoutByID(workoutID)
+	currentUser := middleware.GetUser(r)
+	// Check that the user is authenticated and may change the workout
+	// before reading it or the body, so other users cannot probe which
+	// ids exist.
+	if currentUser == nil || currentUser.IsAnonymous() {
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeUnauthorized, "unauthorized")
+		return
+	}
+	err = wh.authorizeWorkout(r, workoutID, roles.WorkoutsWriteAny)
 	if err != nil {
-		wh.Logger.Printf("ERRR:GetWorkoutByID %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		writeError(wh.Logger, w, r, "GetWorkoutOwnerID", err)
 		return
 	}
-	if existingWorkout == nil {
-		http.NotFound(w, r)
-		//utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+
+	existingWorkout, err := wh.WorkoutStore.GetWorkoutByID(r.Context(), workoutID)
+	if err != nil {
+		writeError(wh.Logger, w, r, "GetWorkoutByID", err)
 		return
 	}
 	var updatedWorkoutRequest struct {
@@ -87,12 +216,13 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 		Description     *string              `json:"description"`
 		DurationMinutes *int                 `json:"duration_minutes"`
 		CaloriesBurned  *int                 `json:"calories_burned"`
+		PerformedAt     *time.Time           `json:"performed_at"`
 		Entries         []store.WorkoutEntry `json:"entries"`
 	}
-	err = json.NewDecoder(r.Body).Decode(&updatedWorkoutRequest)
+	err = utils.ReadJSON(w, r, &updatedWorkoutRequest)
 	if err != nil {
-		wh.Logger.Printf("ERRR:decodingUpdateRequest %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request payload"})
+		wh.Logger.WarnContext(r.Context(), "decoding request body", "error", err)
+		utils.WriteError(w, r, err)
 		return
 	}
 
@@ -108,34 +238,20 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 	if updatedWorkoutRequest.CaloriesBurned != nil {
 		existingWorkout.CaloriesBurned = *updatedWorkoutRequest.CaloriesBurned
 	}
+	if updatedWorkoutRequest.PerformedAt != nil {
+		existingWorkout.PerformedAt = *updatedWorkoutRequest.PerformedAt
+	}
 	if updatedWorkoutRequest.Entries != nil {
 		existingWorkout.Entries = updatedWorkoutRequest.Entries
 	}
 
-	currentUser := middleware.GetUser(r)
-	// Check if the user is authenticated
-	// and if the workout belongs to the user
-
-	if currentUser == nil || currentUser.IsAnonymous() {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
-		return
-	}
-	workoutOwner, err := wh.WorkoutStore.GetWorkoutOwnerID(workoutID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
-			return
-		}
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
-	}
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
+	if err = ValidateWorkout(r.Context(), wh.ExerciseStore, existingWorkout); err != nil {
+		writeError(wh.Logger, w, r, "ValidateWorkout", err)
 		return
 	}
-	err = wh.WorkoutStore.UpdateWorkout(existingWorkout)
+	err = wh.WorkoutStore.UpdateWorkout(r.Context(), existingWorkout)
 	if err != nil {
-		wh.Logger.Printf("ERRR:UpdateWorkout %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		writeError(wh.Logger, w, r, "UpdateWorkout", err)
 		return
 	}
 
@@ -146,8 +262,8 @@ func (wh *WorkoutHandler) HandleUpdateWorkoutByID(w http.ResponseWriter, r *http
 func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http.Request) {
 	workoutID, err := utils.ReadIDParam(r)
 	if err != nil {
-		wh.Logger.Printf("ERRR:ReadIDParam %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid workout id"})
+		wh.Logger.WarnContext(r.Context(), "ReadIDParam", "error", err)
+		utils.WriteErrorCode(w, r, http.StatusBadRequest, utils.CodeInvalidParameter, "invalid workout id")
 		return
 	}
 	currentUser := middleware.GetUser(r)
@@ -155,30 +271,17 @@ func (wh *WorkoutHandler) HandleDeleteWorkoutByID(w http.ResponseWriter, r *http
 	// and if the workout belongs to the user
 
 	if currentUser == nil || currentUser.IsAnonymous() {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "unauthorized"})
+		utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeUnauthorized, "unauthorized")
 		return
 	}
-	workoutOwner, err := wh.WorkoutStore.GetWorkoutOwnerID(workoutID)
+	err = wh.authorizeWorkout(r, workoutID, roles.WorkoutsWriteAny)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
-			return
-		}
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
-	}
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "forbidden"})
-		return
-	}
-	err = wh.WorkoutStore.DeleteWorkout(workoutID)
-	if err == sql.ErrNoRows {
-		wh.Logger.Printf("ERRR:DeleteWorkout %v", err)
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout not found"})
+		writeError(wh.Logger, w, r, "GetWorkoutOwnerID", err)
 		return
 	}
+	err = wh.WorkoutStore.DeleteWorkout(r.Context(), workoutID)
 	if err != nil {
-		wh.Logger.Printf("ERRR:DeleteWorkout %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		writeError(wh.Logger, w, r, "DeleteWorkout", err)
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"workout": "workout deleted"})
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+// Limits mirror the workouts and workout_entries columns so invalid input is
+// rejected with a 422 before it reaches the database.
+const (
+	maxWorkoutTitleLength   = 255
+	maxWorkoutDuration      = 24 * 60
+	maxExerciseNameLength   = 255
+	maxEntrySets            = 1000
+	maxEntryDurationSeconds = 24 * 60 * 60
+	// weight is a DECIMAL(5, 2)
+	maxEntryWeight = 999.99
+	// distance_meters is a DECIMAL(9, 2)
+	maxEntryDistanceMeters = 9999999.99
+)
+
+// ValidateWorkout links the entries of a workout about to be created or
+// saved to the exercise catalog and checks the workout, reporting every
+// invalid field at once in a *utils.ValidationError. Any other error comes
+// from exercises. The seed command runs it too, so seeded workouts are ones
+// the API would have accepted.
+func ValidateWorkout(ctx context.Context, exercises store.ExerciseStore, workout *store.Workout) error {
+	v := &utils.ValidationError{}
+	if err := linkExercises(ctx, exercises, v, workout); err != nil {
+		return err
+	}
+
+	title := strings.TrimSpace(workout.Title)
+	v.Check(title != "", "title", "required", "title is required")
+	v.Check(utf8.RuneCountInString(workout.Title) <= maxWorkoutTitleLength, "title", "too_long",
+		fmt.Sprintf("title cannot be longer than %d characters", maxWorkoutTitleLength))
+	v.Check(workout.DurationMinutes > 0, "duration_minutes", "out_of_range", "duration_minutes must be positive")
+	v.Check(workout.DurationMinutes <= maxWorkoutDuration, "duration_minutes", "out_of_range",
+		fmt.Sprintf("duration_minutes cannot be more than %d", maxWorkoutDuration))
+	v.Check(workout.CaloriesBurned >= 0, "calories_burned", "out_of_range", "calories_burned cannot be negative")
+
+	orderIndexes := make(map[int]bool, len(workout.Entries))
+	for i, entry := range workout.Entries {
+		validateWorkoutEntry(v, fmt.Sprintf("entries[%d].", i), &entry)
+		v.Check(!orderIndexes[entry.OrderIndex], fmt.Sprintf("entries[%d].order_index", i), "duplicate",
+			fmt.Sprintf("order_index %d is used by another entry", entry.OrderIndex))
+		orderIndexes[entry.OrderIndex] = true
+	}
+	return v.Err()
+}
+
+// validateWorkoutEntry adds the problems of one entry to v, prefixing field
+// names with prefix.
+func validateWorkoutEntry(v *utils.ValidationError, prefix string, entry *store.WorkoutEntry) {
+	v.Check(strings.TrimSpace(entry.ExerciseName) != "", prefix+"exercise_name", "required", "exercise_name is required")
+	v.Check(utf8.RuneCountInString(entry.ExerciseName) <= maxExerciseNameLength, prefix+"exercise_name", "too_long",
+		fmt.Sprintf("exercise_name cannot be longer than %d characters", maxExerciseNameLength))
+	v.Check(entry.Sets > 0 && entry.Sets <= maxEntrySets, prefix+"sets", "out_of_range",
+		fmt.Sprintf("sets must be between 1 and %d", maxEntrySets))
+
+	// an entry is either counted in reps or timed and/or measured over a
+	// distance, never both
+	switch {
+	case entry.Reps == nil && entry.DurationSeconds == nil && entry.DistanceMeters == nil:
+		v.Add(prefix+"reps", "required", "either reps, duration_seconds or distance_meters is required")
+	case entry.Reps != nil && entry.DurationSeconds != nil:
+		v.Add(prefix+"duration_seconds", "conflict", "reps and duration_seconds cannot both be set")
+	case entry.Reps != nil && entry.DistanceMeters != nil:
+		v.Add(prefix+"distance_meters", "conflict", "reps and distance_meters cannot both be set")
+	}
+	if entry.Reps != nil {
+		v.Check(*entry.Reps > 0, prefix+"reps", "out_of_range", "reps must be positive")
+	}
+	if entry.DurationSeconds != nil {
+		v.Check(*entry.DurationSeconds > 0 && *entry.DurationSeconds <= maxEntryDurationSeconds, prefix+"duration_seconds", "out_of_range",
+			fmt.Sprintf("duration_seconds must be between 1 and %d", maxEntryDurationSeconds))
+	}
+	if entry.DistanceMeters != nil {
+		v.Check(*entry.DistanceMeters > 0 && *entry.DistanceMeters <= maxEntryDistanceMeters, prefix+"distance_meters", "out_of_range",
+			fmt.Sprintf("distance_meters must be positive and at most %.2f", maxEntryDistanceMeters))
+	}
+	if entry.Weight != nil {
+		v.Check(*entry.Weight >= 0 && *entry.Weight <= maxEntryWeight, prefix+"weight", "out_of_range",
+			fmt.Sprintf("weight must be between 0 and %.2f", maxEntryWeight))
+	}
+	v.Check(entry.OrderIndex >= 0, prefix+"order_index", "out_of_range", "order_index cannot be negative")
+}
+
+// linkExercises connects the entries of workout to the exercise catalog as
+// its owner sees it and adds the problems it finds to v. An entry with an
+// exercise_id must name a visible exercise and be logged the way the
+// exercise is measured; it gets the exercise's name when it has none. An
+// entry with only a name is linked when the name or an alias matches and the
+// measurement fits, and is otherwise kept as free text.
+func linkExercises(ctx context.Context, exercises store.ExerciseStore, v *utils.ValidationError, workout *store.Workout) error {
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		prefix := fmt.Sprintf("entries[%d].", i)
+
+		if entry.ExerciseID == nil {
+			if strings.TrimSpace(entry.ExerciseName) == "" {
+				continue
+			}
+			exercise, err := exercises.FindExercise(ctx, workout.UserID, entry.ExerciseName)
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if exercise.Measures(entry) {
+				entry.ExerciseID = &exercise.ID
+			}
+			continue
+		}
+
+		exercise, err := exercises.GetExercise(ctx, workout.UserID, int64(*entry.ExerciseID))
+		if errors.Is(err, store.ErrNotFound) {
+			v.Add(prefix+"exercise_id", "invalid", fmt.Sprintf("exercise %d does not exist", *entry.ExerciseID))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(entry.ExerciseName) == "" {
+			entry.ExerciseName = exercise.Name
+		}
+		// entries without any measurement are reported by ValidateWorkout
+		measured := entry.Reps != nil || entry.DurationSeconds != nil || entry.DistanceMeters != nil
+		if measured && !exercise.Measures(entry) {
+			field := "reps"
+			switch exercise.Measurement {
+			case store.MeasurementDuration:
+				field = "duration_seconds"
+			case store.MeasurementDistance:
+				field = "distance_meters"
+			}
+			v.Add(prefix+field, "required", fmt.Sprintf("%s is measured in %s", exercise.Name, field))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+func intPtr(n int) *int { return &n }
+
+// validWorkout returns a workout ValidateWorkout accepts, for the cases to
+// break.
+func validWorkout() *store.Workout {
+	return &store.Workout{
+		UserID:          1,
+		Title:           "Leg day",
+		DurationMinutes: 60,
+		CaloriesBurned:  400,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Squat", Sets: 5, Reps: intPtr(5), OrderIndex: 0},
+			{ExerciseName: "Plank", Sets: 3, DurationSeconds: intPtr(60), OrderIndex: 1},
+		},
+	}
+}
+
+func TestValidateWorkout(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(w *store.Workout)
+		// fields are the invalid fields, in the order they are reported
+		fields []string
+	}{
+		{"valid", func(*store.Workout) {}, nil},
+		{"empty title", func(w *store.Workout) { w.Title = "  " }, []string{"title"}},
+		{"negative duration", func(w *store.Workout) { w.DurationMinutes = -10 }, []string{"duration_minutes"}},
+		{"reps with duration", func(w *store.Workout) { w.Entries[0].DurationSeconds = intPtr(30) }, []string{"entries[0].duration_seconds"}},
+		{"no measurement", func(w *store.Workout) { w.Entries[1].DurationSeconds = nil }, []string{"entries[1].reps"}},
+		{"duplicate order_index", func(w *store.Workout) { w.Entries[1].OrderIndex = 0 }, []string{"entries[1].order_index"}},
+		{
+			name: "every error at once",
+			change: func(w *store.Workout) {
+				w.Title = ""
+				w.DurationMinutes = -10
+				w.Entries[0].DurationSeconds = intPtr(30)
+				w.Entries[1].OrderIndex = 0
+			},
+			fields: []string{"title", "duration_minutes", "entries[0].duration_seconds", "entries[1].order_index"},
+		},
+	}
+	exercises := store.NewMemoryExerciseStore(store.NewMemoryDB())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workout := validWorkout()
+			tt.change(workout)
+			err := ValidateWorkout(t.Context(), exercises, workout)
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("ValidateWorkout = %v, want nil", err)
+				}
+				return
+			}
+
+			var validation *utils.ValidationError
+			if !errors.As(err, &validation) {
+				t.Fatalf("ValidateWorkout = %v, want a *utils.ValidationError", err)
+			}
+			var fields []string
+			for _, f := range validation.Fields {
+				fields = append(fields, f.Field)
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+			if p := utils.ProblemFor(err); p.Status != http.StatusUnprocessableEntity || len(p.Errors) != len(tt.fields) {
+				t.Errorf("problem = %d with %d errors, want %d with %d", p.Status, len(p.Errors), http.StatusUnprocessableEntity, len(tt.fields))
+			}
+		})
+	}
+}
@@ -1,59 +1,370 @@
 package app
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/syafae/femProject/internal/api"
+	"github.com/syafae/femProject/internal/config"
+	"github.com/syafae/femProject/internal/health"
+	"github.com/syafae/femProject/internal/lockout"
+	"github.com/syafae/femProject/internal/logging"
+	"github.com/syafae/femProject/internal/mailer"
+	"github.com/syafae/femProject/internal/metrics"
 	"github.com/syafae/femProject/internal/middleware"
 	"github.com/syafae/femProject/internal/migrations"
 	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/totp"
+	"github.com/syafae/femProject/internal/tracing"
+	"github.com/syafae/femProject/internal/utils"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Middleware     middleware.UserMiddleware
-	DB             *sql.DB
+	Logger               *slog.Logger
+	WorkoutHandler       *api.WorkoutHandler
+	ExerciseHandler      *api.ExerciseHandler
+	UserHandler          *api.UserHandler
+	TokenHandler         *api.TokenHandler
+	TwoFactorHandler     *api.TwoFactorHandler
+	PasswordResetHandler *api.PasswordResetHandler
+	APIKeyHandler        *api.APIKeyHandler
+	AdminHandler         *api.AdminHandler
+	Middleware           middleware.UserMiddleware
+	DB                   *sql.DB // postgres or sqlite, nil with the memory store
+	// Health holds the readiness checks; subsystems may register their own.
+	Health  *health.Registry
+	Metrics *metrics.Prometheus
+	// TrustedProxies may set the client IP through X-Forwarded-For.
+	TrustedProxies []netip.Prefix
+
+	// draining is set once shutdown begins so readiness checks fail while
+	// in-flight requests finish.
+	draining atomic.Bool
+	// stopWorkers cancels the context of the background workers, which
+	// report on workers when they return.
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
+	// stopTracing flushes buffered spans to the exporter.
+	stopTracing func(context.Context) error
+	closeOnce   sync.Once
 }
 
-func NewApplication() (*Application, error) {
-	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
-	pgDB, err := store.Open()
+const (
+	// expiredTokenPurgeInterval is how often expired tokens are deleted.
+	expiredTokenPurgeInterval = time.Hour
+	// healthCheckTimeout bounds each readiness check.
+	healthCheckTimeout = 2 * time.Second
+	// tracingFlushTimeout bounds exporting the remaining spans on Close.
+	tracingFlushTimeout = 5 * time.Second
+)
+
+// Failed logins are limited per username and, more loosely, per client IP
+// since many users can share one address.
+var (
+	usernameLockoutPolicy = lockout.Policy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+	ipLockoutPolicy = lockout.Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+)
+
+func NewApplication(cfg *config.Config) (*Application, error) {
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
 		return nil, err
 	}
-	err = store.MigrateFS(pgDB, migrations.FS, ".")
+	store.SetLogger(logger)
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing, os.Stdout)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	store.SetBcryptCost(cfg.BcryptCost)
+	// checked before the database is opened and migrated
+	totpCipher, err := newTOTPCipher(cfg.TOTPEncryptionKey, cfg.Store, logger)
+	if err != nil {
+		return nil, err
+	}
+	stores, err := OpenStores(cfg, logger)
+	if err != nil {
+		return nil, err
 	}
+	appMetrics := metrics.NewPrometheus(stores.DB, cfg.Store)
 	// our store will go out here
-	workoutStore := store.NewPostgresWorkoutStore(pgDB)
-	userStore := store.NewPostgresUserStore(pgDB)
-	tokenStore := store.NewPostgresTokenStore(pgDB)
+	workoutStore := store.NewInstrumentedWorkoutStore(stores.Workouts, appMetrics)
+	appMailer := newMailer(cfg.SMTP, logger)
 	// our handlers will go here
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
-	userHandler := api.NewUserHandler(userStore, logger)
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
-	middleware := middleware.UserMiddleware{UserStore: userStore}
+	workoutHandler := api.NewWorkoutHandler(workoutStore, stores.Exercises, appMetrics, logger)
+	exerciseHandler := api.NewExerciseHandler(stores.Exercises, logger)
+	userHandler := api.NewUserHandler(stores.Users, stores.Tokens, appMailer, appMetrics, logger)
+	tokenHandler := api.NewTokenHandler(stores.Tokens, stores.Users, stores.LoginAudit, stores.UserTracker, stores.IPTracker, totpCipher, cfg.Tokens, appMetrics, logger)
+	twoFactorHandler := api.NewTwoFactorHandler(stores.Users, stores.UserTracker, stores.IPTracker, totpCipher, logger)
+	passwordResetHandler := api.NewPasswordResetHandler(stores.Users, stores.Tokens, appMailer, logger)
+	apiKeyHandler := api.NewAPIKeyHandler(stores.APIKeys, appMetrics, logger)
+	adminHandler := api.NewAdminHandler(stores.Users, stores.Tokens, logger)
+	middleware := middleware.UserMiddleware{UserStore: stores.Users, TokenStore: stores.Tokens, APIKeyStore: stores.APIKeys, Metrics: appMetrics, Logger: logger}
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     middleware,
-		DB:             pgDB,
+		Logger:               logger,
+		WorkoutHandler:       workoutHandler,
+		ExerciseHandler:      exerciseHandler,
+		UserHandler:          userHandler,
+		TokenHandler:         tokenHandler,
+		TwoFactorHandler:     twoFactorHandler,
+		PasswordResetHandler: passwordResetHandler,
+		APIKeyHandler:        apiKeyHandler,
+		AdminHandler:         adminHandler,
+		Middleware:           middleware,
+		DB:                   stores.DB,
+		Metrics:              appMetrics,
+		Health:               health.NewRegistry(healthCheckTimeout),
+		TrustedProxies:       cfg.Server.TrustedProxies,
+		stopTracing:          stopTracing,
 	}
+	if stores.DB != nil {
+		app.Health.Register(cfg.Store, health.Ping(stores.DB))
+		app.Health.Register(cfg.Store+"_pool", health.PoolStats(stores.DB))
+		app.Health.Register("migrations", migrationCheck(stores.DB, stores.Migrations))
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	app.stopWorkers = stopWorkers
+	app.startWorker(workerCtx, "purge expired tokens", expiredTokenPurgeInterval, func(ctx context.Context) error {
+		n, err := stores.Tokens.DeleteExpiredTokens(ctx)
+		if err == nil && n > 0 {
+			logger.InfoContext(ctx, "purged expired tokens", "count", n)
+		}
+		return err
+	})
 	return app, nil
 
 }
 
-func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprint(w, "status is available\n")
+// Stores is the storage backend selected by the configuration.
+type Stores struct {
+	// DB is nil for the memory backend.
+	DB *sql.DB
+	// Migrations are the schema migrations applied to DB.
+	Migrations  fs.FS
+	Workouts    store.WorkoutStore
+	Exercises   store.ExerciseStore
+	Users       store.UserStore
+	Tokens      store.TokenStore
+	APIKeys     store.APIKeyStore
+	LoginAudit  store.LoginAuditStore
+	UserTracker lockout.Tracker
+	IPTracker   lockout.Tracker
+}
+
+// OpenStores opens the backend named by cfg.Store, migrating the database
+// first when there is one and cfg.AutoMigrate is set.
+func OpenStores(cfg *config.Config, logger *slog.Logger) (*Stores, error) {
+	if cfg.Store == "memory" {
+		logger.Warn("using the memory store, all data is lost on restart")
+		db := store.NewMemoryDB()
+		return &Stores{
+			Workouts:    store.NewMemoryWorkoutStore(db),
+			Exercises:   store.NewMemoryExerciseStore(db),
+			Users:       store.NewMemoryUserStore(db),
+			Tokens:      store.NewMemoryTokenStore(db),
+			APIKeys:     store.NewMemoryAPIKeyStore(db),
+			LoginAudit:  store.NewMemoryLoginAuditStore(db),
+			UserTracker: lockout.NewMemoryTracker(usernameLockoutPolicy),
+			IPTracker:   lockout.NewMemoryTracker(ipLockoutPolicy),
+		}, nil
+	}
+
+	db, migrationFS, err := OpenDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AutoMigrate {
+		if err := store.MigrateFS(db, migrationFS, "."); err != nil {
+			db.Close()
+			return nil, err
+		}
+	} else {
+		logger.Info("automatic migration is disabled, run the migrate command to update the schema")
+	}
+
+	if cfg.Store == "sqlite" {
+		return &Stores{
+			DB:         db,
+			Migrations: migrationFS,
+			Workouts:   store.NewSQLiteWorkoutStore(db, cfg.DB.QueryTimeout),
+			Exercises:  store.NewSQLiteExerciseStore(db, cfg.DB.QueryTimeout),
+			Users:      store.NewSQLiteUserStore(db, cfg.DB.QueryTimeout),
+			Tokens:     store.NewSQLiteTokenStore(db, cfg.DB.QueryTimeout),
+			APIKeys:    store.NewSQLiteAPIKeyStore(db, cfg.DB.QueryTimeout),
+			LoginAudit: store.NewSQLiteLoginAuditStore(db, cfg.DB.QueryTimeout),
+			// a single process owns the database file, so failed logins
+			// can be counted in memory
+			UserTracker: lockout.NewMemoryTracker(usernameLockoutPolicy),
+			IPTracker:   lockout.NewMemoryTracker(ipLockoutPolicy),
+		}, nil
+	}
+	return &Stores{
+		DB:          db,
+		Migrations:  migrationFS,
+		Workouts:    store.NewPostgresWorkoutStore(db, cfg.DB.QueryTimeout),
+		Exercises:   store.NewPostgresExerciseStore(db, cfg.DB.QueryTimeout),
+		Users:       store.NewPostgresUserStore(db, cfg.DB.QueryTimeout),
+		Tokens:      store.NewPostgresTokenStore(db, cfg.DB.QueryTimeout),
+		APIKeys:     store.NewPostgresAPIKeyStore(db, cfg.DB.QueryTimeout),
+		LoginAudit:  store.NewPostgresLoginAuditStore(db, cfg.DB.QueryTimeout),
+		UserTracker: lockout.NewPostgresTracker(db, usernameLockoutPolicy, cfg.DB.QueryTimeout),
+		IPTracker:   lockout.NewPostgresTracker(db, ipLockoutPolicy, cfg.DB.QueryTimeout),
+	}, nil
+}
 
+// OpenDatabase opens the database of cfg.Store and returns it with the
+// migrations of its schema. The memory store has no database.
+func OpenDatabase(cfg *config.Config) (*sql.DB, fs.FS, error) {
+	switch cfg.Store {
+	case "sqlite":
+		db, err := store.OpenSQLite(cfg.SQLitePath)
+		return db, migrations.SQLite, err
+	case "postgres":
+		db, err := store.Open(cfg.DB)
+		return db, migrations.FS, err
+	}
+	return nil, nil, fmt.Errorf("the %s store has no database", cfg.Store)
+}
+
+// newMailer delivers through SMTP when a host is configured; otherwise emails
+// are only logged.
+func newMailer(cfg config.SMTPConfig, logger *slog.Logger) mailer.Mailer {
+	if cfg.Host == "" {
+		return mailer.NewLogMailer(logger)
+	}
+	return mailer.NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Sender)
+}
+
+// newTOTPCipher builds the cipher for TOTP secrets from the base64 encoded
+// 32 byte key in TOTP_ENCRYPTION_KEY. The key may only be left unset with the
+// memory store, which uses a random key since its enrollments do not survive
+// a restart anyway; with a database, secrets encrypted with a random key
+// could not be read after a restart, locking users out.
+func newTOTPCipher(encoded, storeBackend string, logger *slog.Logger) (*totp.Cipher, error) {
+	if encoded == "" {
+		if storeBackend != "memory" {
+			return nil, fmt.Errorf("TOTP_ENCRYPTION_KEY is required with the %s store", storeBackend)
+		}
+		logger.Info("TOTP_ENCRYPTION_KEY is not set, using an ephemeral key")
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return totp.NewCipher(key)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("TOTP_ENCRYPTION_KEY: %w", err)
+	}
+	return totp.NewCipher(key)
+}
+
+// startWorker runs fn every interval until ctx is cancelled by Close. fn
+// receives ctx so a run in progress is abandoned on shutdown.
+func (a *Application) startWorker(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := fn(ctx); err != nil {
+					a.Logger.Error("background worker", "worker", name, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// BeginDrain marks the application as shutting down. The server keeps
+// serving in-flight requests but reports itself as not ready.
+func (a *Application) BeginDrain() {
+	a.draining.Store(true)
+}
+
+func (a *Application) Draining() bool {
+	return a.draining.Load()
+}
+
+// Close stops the background workers, waits for them to return, flushes
+// the remaining spans and then closes the database pool. It must only be
+// called once the HTTP server has shut down; later calls are no-ops.
+func (a *Application) Close() error {
+	var err error
+	a.closeOnce.Do(func() {
+		a.BeginDrain()
+		a.stopWorkers()
+		a.workers.Wait()
+		ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer cancel()
+		err = a.stopTracing(ctx)
+		if a.DB != nil {
+			err = errors.Join(err, a.DB.Close())
+		}
+	})
+	return err
+}
+
+// migrationCheck fails while the database schema is behind the migrations
+// embedded in this binary.
+func migrationCheck(db *sql.DB, migrationFS fs.FS) health.Check {
+	return func(ctx context.Context) (map[string]any, error) {
+		current, latest, err := store.MigrationVersions(ctx, db, migrationFS, ".")
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]any{"current": current, "latest": latest}
+		if current < latest {
+			return details, fmt.Errorf("database is at migration %d, expected %d", current, latest)
+		}
+		return details, nil
+	}
+}
+
+// HandleLiveness only reports that the process is serving requests; it
+// does not look at dependencies, so a database outage does not restart the
+// instance.
+func (a *Application) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"status": health.StatusUp})
+}
+
+// HandleReadiness runs the registered checks and answers 503 when any of
+// them fails or the server is draining.
+func (a *Application) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	if a.Draining() {
+		utils.WriteJSON(w, http.StatusServiceUnavailable, utils.Envelope{"status": "draining"})
+		return
+	}
+	report := a.Health.Run(r.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	utils.WriteJSON(w, status, utils.Envelope{"status": report.Status, "checks": report.Checks})
 }
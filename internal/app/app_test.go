@@ -0,0 +1,26 @@
+package app
+
+import (
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewTOTPCipher(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+
+	for _, backend := range []string{"postgres", "sqlite"} {
+		if _, err := newTOTPCipher("", backend, logger); err == nil {
+			t.Errorf("newTOTPCipher without a key on %s succeeded, want an error", backend)
+		}
+		if _, err := newTOTPCipher(key, backend, logger); err != nil {
+			t.Errorf("newTOTPCipher with a key on %s: %v", backend, err)
+		}
+	}
+	if _, err := newTOTPCipher("", "memory", logger); err != nil {
+		t.Errorf("newTOTPCipher without a key on memory: %v", err)
+	}
+}
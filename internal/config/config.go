@@ -0,0 +1,336 @@
+// Package config loads the server configuration from defaults, a .env
+// file, environment variables and command line flags, in increasing order
+// of precedence.
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Config struct {
+	// Environment is development, test or production. Commands that write
+	// made-up data, such as seed, refuse to run in production, which is the
+	// default so that a deploy has to opt out of it explicitly.
+	Environment string
+	Port        int
+	BcryptCost  int
+	LogLevel    string
+	LogFormat   string
+	DB          DBConfig
+	Server      ServerConfig
+	Tokens      TokenConfig
+	SMTP        SMTPConfig
+	Tracing     TracingConfig
+	// TOTPEncryptionKey is the base64 encoded AES key for TOTP secrets. The
+	// server requires it unless the memory store is used, which loses the
+	// secrets on restart anyway; migrate and seed do not need it.
+	TOTPEncryptionKey string
+	// Store selects the storage backend: postgres, sqlite for a single
+	// file database, or memory for demos, which keeps everything in process
+	// memory and needs no database.
+	Store string
+	// SQLitePath is the database file of the sqlite store.
+	SQLitePath string
+	// AutoMigrate applies pending migrations when the server starts. Turn it
+	// off when migrations run as a separate deploy step.
+	AutoMigrate bool
+}
+
+type DBConfig struct {
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// QueryTimeout bounds every store call, including all statements of a
+	// transaction, so a slow query cannot hold a connection indefinitely.
+	QueryTimeout time.Duration
+}
+
+type ServerConfig struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// DrainDelay is how long the server keeps accepting requests after a
+	// SIGINT or SIGTERM while reporting itself as not ready, so load
+	// balancers stop routing to it before the listener closes.
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may drain after a
+	// SIGINT or SIGTERM.
+	ShutdownTimeout time.Duration
+	// MetricsAddr is the address of the separate listener for /metrics,
+	// which is kept off the public API port. Empty disables it.
+	MetricsAddr string
+	// TrustedProxies are the addresses of the reverse proxies in front of
+	// the server. X-Forwarded-For is only read from them; without any, the
+	// client IP is the peer address of the connection.
+	TrustedProxies []netip.Prefix
+}
+
+type TokenConfig struct {
+	AuthTTL    time.Duration
+	RefreshTTL time.Duration
+}
+
+// Exporters of TracingConfig.
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// TracingConfig selects where spans are exported: none, otlp or stdout.
+// The OTLP exporter also honours the standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	Exporter     string
+	OTLPEndpoint string
+	SampleRatio  float64
+	ServiceName  string
+}
+
+// SMTPConfig selects the SMTP mailer when Host is set; otherwise emails are
+// only logged.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string
+}
+
+var (
+	Environments = []string{"development", "test", "production"}
+	LogLevels    = []string{"debug", "info", "warn", "error"}
+	LogFormats   = []string{"json", "text"}
+	// TracingExporters are the exporters the tracing package can set up.
+	TracingExporters = []string{TracingExporterNone, TracingExporterOTLP, TracingExporterStdout}
+	StoreBackends    = []string{"postgres", "sqlite", "memory"}
+)
+
+// envFile is read from the working directory when it exists. Variables that
+// are already set in the environment take precedence over it.
+const envFile = ".env"
+
+// Load builds the configuration from command line arguments, not including
+// the program and command names, and returns the arguments left after the
+// flags. The configuration flags are added to flags, which may already hold
+// flags of the command.
+func Load(flags *flag.FlagSet, args []string) (*Config, []string, error) {
+	if err := godotenv.Load(envFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("config: load %s: %w", envFile, err)
+	}
+
+	env := &envReader{}
+	cfg := &Config{}
+
+	flags.StringVar(&cfg.Environment, "env", env.string("APP_ENV", "production"), "environment (development, test, production)")
+	flags.IntVar(&cfg.Port, "port", env.int("PORT", 8080), "server backend port")
+	flags.IntVar(&cfg.BcryptCost, "bcrypt-cost", env.int("BCRYPT_COST", 12), "bcrypt cost for password hashes")
+	flags.StringVar(&cfg.LogLevel, "log-level", env.string("LOG_LEVEL", "info"), "log level (debug, info, warn, error)")
+	flags.StringVar(&cfg.LogFormat, "log-format", env.string("LOG_FORMAT", "json"), "log format (json, text)")
+
+	flags.StringVar(&cfg.Store, "store", env.string("STORE", "postgres"), "storage backend (postgres, sqlite, memory)")
+	flags.StringVar(&cfg.SQLitePath, "sqlite-path", env.string("SQLITE_PATH", "workouts.db"), "database file of the sqlite store")
+	flags.BoolVar(&cfg.AutoMigrate, "auto-migrate", env.bool("AUTO_MIGRATE", true), "apply pending database migrations when the server starts")
+	flags.StringVar(&cfg.DB.DSN, "db-dsn", env.string("DB_DSN",
+		"host=localhost user=postgres password=postgres dbname=postgres port=5432 sslmode=disable"), "PostgreSQL DSN")
+	flags.IntVar(&cfg.DB.MaxOpenConns, "db-max-open-conns", env.int("DB_MAX_OPEN_CONNS", 25), "maximum open database connections (0 is unlimited)")
+	flags.IntVar(&cfg.DB.MaxIdleConns, "db-max-idle-conns", env.int("DB_MAX_IDLE_CONNS", 25), "maximum idle database connections")
+	flags.DurationVar(&cfg.DB.ConnMaxLifetime, "db-conn-max-lifetime", env.duration("DB_CONN_MAX_LIFETIME", time.Hour), "maximum lifetime of a database connection")
+	flags.DurationVar(&cfg.DB.ConnMaxIdleTime, "db-conn-max-idle-time", env.duration("DB_CONN_MAX_IDLE_TIME", 15*time.Minute), "maximum idle time of a database connection")
+	flags.DurationVar(&cfg.DB.QueryTimeout, "db-query-timeout", env.duration("DB_QUERY_TIMEOUT", 5*time.Second), "maximum duration of a database call")
+
+	flags.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", env.duration("SERVER_READ_TIMEOUT", 10*time.Second), "HTTP read timeout")
+	flags.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", env.duration("SERVER_WRITE_TIMEOUT", 30*time.Second), "HTTP write timeout")
+	flags.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", env.duration("SERVER_IDLE_TIMEOUT", time.Minute), "HTTP idle timeout")
+	flags.DurationVar(&cfg.Server.DrainDelay, "drain-delay", env.duration("SERVER_DRAIN_DELAY", 0), "time to keep serving after a shutdown signal before draining")
+	flags.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", env.duration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second), "time allowed for in-flight requests to finish on shutdown")
+	flags.StringVar(&cfg.Server.MetricsAddr, "metrics-addr", env.string("METRICS_ADDR", "localhost:9090"), "address of the Prometheus metrics listener, empty to disable it")
+	trustedProxies := flags.String("trusted-proxies", env.string("TRUSTED_PROXIES", ""), "comma separated IPs or CIDRs of proxies whose X-Forwarded-For is trusted")
+
+	flags.DurationVar(&cfg.Tokens.AuthTTL, "auth-token-ttl", env.duration("AUTH_TOKEN_TTL", 24*time.Hour), "lifetime of authentication tokens")
+	flags.DurationVar(&cfg.Tokens.RefreshTTL, "refresh-token-ttl", env.duration("REFRESH_TOKEN_TTL", 30*24*time.Hour), "lifetime of refresh tokens")
+
+	flags.StringVar(&cfg.SMTP.Host, "smtp-host", env.string("SMTP_HOST", ""), "SMTP host, emails are logged when empty")
+	flags.IntVar(&cfg.SMTP.Port, "smtp-port", env.int("SMTP_PORT", 1025), "SMTP port")
+	flags.StringVar(&cfg.SMTP.Username, "smtp-username", env.string("SMTP_USERNAME", ""), "SMTP username")
+	flags.StringVar(&cfg.SMTP.Password, "smtp-password", env.string("SMTP_PASSWORD", ""), "SMTP password")
+	flags.StringVar(&cfg.SMTP.Sender, "smtp-sender", env.string("SMTP_SENDER", "femProject <no-reply@femproject.local>"), "sender address of emails")
+
+	flags.StringVar(&cfg.Tracing.Exporter, "tracing-exporter", env.string("TRACING_EXPORTER", TracingExporterNone), "trace exporter (none, otlp, stdout)")
+	flags.StringVar(&cfg.Tracing.OTLPEndpoint, "otlp-endpoint", env.string("OTLP_ENDPOINT", ""), "OTLP/HTTP endpoint URL, e.g. http://localhost:4318")
+	flags.Float64Var(&cfg.Tracing.SampleRatio, "tracing-sample-ratio", env.float("TRACING_SAMPLE_RATIO", 1), "fraction of new traces to sample")
+	flags.StringVar(&cfg.Tracing.ServiceName, "service-name", env.string("SERVICE_NAME", "femproject"), "service name reported in traces")
+
+	flags.StringVar(&cfg.TOTPEncryptionKey, "totp-encryption-key", env.string("TOTP_ENCRYPTION_KEY", ""), "base64 encoded 32 byte key for TOTP secrets")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	var proxyErr error
+	cfg.Server.TrustedProxies, proxyErr = parsePrefixes(*trustedProxies)
+	if err := errors.Join(append(env.errs, proxyErr, cfg.Validate())...); err != nil {
+		return nil, nil, fmt.Errorf("config: %w", err)
+	}
+	return cfg, flags.Args(), nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(slices.Contains(Environments, c.Environment), "environment must be one of %v, got %q", Environments, c.Environment)
+	check(c.Port > 0 && c.Port <= 65535, "port must be between 1 and 65535, got %d", c.Port)
+	check(c.BcryptCost >= bcrypt.MinCost && c.BcryptCost <= bcrypt.MaxCost,
+		"bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.BcryptCost)
+	check(slices.Contains(LogLevels, c.LogLevel), "log level must be one of %v, got %q", LogLevels, c.LogLevel)
+	check(slices.Contains(LogFormats, c.LogFormat), "log format must be one of %v, got %q", LogFormats, c.LogFormat)
+
+	check(slices.Contains(StoreBackends, c.Store), "store must be one of %v, got %q", StoreBackends, c.Store)
+	check(c.Store != "postgres" || c.DB.DSN != "", "database DSN is required")
+	check(c.Store != "sqlite" || c.SQLitePath != "", "SQLite path is required")
+	check(c.DB.MaxOpenConns >= 0, "max open connections cannot be negative")
+	check(c.DB.MaxIdleConns >= 0, "max idle connections cannot be negative")
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns,
+		"max idle connections (%d) cannot exceed max open connections (%d)", c.DB.MaxIdleConns, c.DB.MaxOpenConns)
+	check(c.DB.ConnMaxLifetime >= 0, "connection max lifetime cannot be negative")
+	check(c.DB.ConnMaxIdleTime >= 0, "connection max idle time cannot be negative")
+	check(c.DB.QueryTimeout > 0, "query timeout must be positive")
+
+	check(c.Server.ReadTimeout > 0, "read timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "write timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "idle timeout must be positive")
+	check(c.Server.DrainDelay >= 0, "drain delay cannot be negative")
+	check(c.Server.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	if c.Server.MetricsAddr != "" {
+		_, _, err := net.SplitHostPort(c.Server.MetricsAddr)
+		check(err == nil, "metrics address must be a host:port such as localhost:9090, got %q", c.Server.MetricsAddr)
+	}
+
+	check(c.Tokens.AuthTTL > 0, "authentication token TTL must be positive")
+	check(c.Tokens.RefreshTTL >= c.Tokens.AuthTTL, "refresh token TTL cannot be shorter than the authentication token TTL")
+
+	if c.SMTP.Host != "" {
+		check(c.SMTP.Port > 0 && c.SMTP.Port <= 65535, "SMTP port must be between 1 and 65535, got %d", c.SMTP.Port)
+		check(c.SMTP.Sender != "", "SMTP sender is required when an SMTP host is set")
+	}
+
+	check(slices.Contains(TracingExporters, c.Tracing.Exporter), "tracing exporter must be one of %v, got %q", TracingExporters, c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing sample ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	check(c.Tracing.ServiceName != "", "service name is required")
+
+	// whether the key is required is decided by the server, which is the
+	// only command that encrypts TOTP secrets
+	if c.TOTPEncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.TOTPEncryptionKey)
+		check(err == nil && len(key) == 32, "TOTP encryption key must be 32 bytes encoded as base64")
+	}
+
+	return errors.Join(errs...)
+}
+
+// parsePrefixes parses a comma separated list of CIDRs, taking a bare IP as
+// a prefix that only matches itself.
+func parsePrefixes(raw string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(field)
+			if addrErr != nil {
+				return nil, fmt.Errorf("trusted proxies must be IPs or CIDRs, got %q", field)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// envReader reads typed environment variables, remembering parse errors so
+// they can be reported together with validation errors.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) string(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func (e *envReader) int(key string, fallback int) int {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be an integer, got %q", key, raw))
+		return fallback
+	}
+	return value
+}
+
+func (e *envReader) duration(key string, fallback time.Duration) time.Duration {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a duration such as 30s or 24h, got %q", key, raw))
+		return fallback
+	}
+	return value
+}
+
+func (e *envReader) bool(key string, fallback bool) bool {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be true or false, got %q", key, raw))
+		return fallback
+	}
+	return value
+}
+
+func (e *envReader) float(key string, fallback float64) float64 {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a number, got %q", key, raw))
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,120 @@
+// Package health runs the dependency checks behind the readiness probe.
+// Subsystems register a Check with the Registry at startup.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check reports whether a dependency is usable. It may return details, such
+// as versions or counters, which are included in the report either way.
+type Check func(ctx context.Context) (map[string]any, error)
+
+type Result struct {
+	Status   string         `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Duration string         `json:"duration"`
+	Details  map[string]any `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status string             `json:"status"`
+	Checks map[string]*Result `json:"checks"`
+}
+
+type Registry struct {
+	mu      sync.RWMutex
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+// NewRegistry returns an empty registry whose checks each get timeout to
+// complete.
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{
+		checks:  map[string]Check{},
+		timeout: timeout,
+	}
+}
+
+// Register adds or replaces the check called name.
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = check
+}
+
+// Run executes all checks concurrently. The report is up only if every
+// check is.
+func (r *Registry) Run(ctx context.Context) *Report {
+	r.mu.RLock()
+	checks := make(map[string]Check, len(r.checks))
+	for name, check := range r.checks {
+		checks[name] = check
+	}
+	r.mu.RUnlock()
+
+	report := &Report{Status: StatusUp, Checks: make(map[string]*Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := r.run(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, check Check) *Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	result := &Result{Status: StatusUp, Duration: time.Since(start).String(), Details: details}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Ping checks that the database accepts connections.
+func Ping(db *sql.DB) Check {
+	return func(ctx context.Context) (map[string]any, error) {
+		return nil, db.PingContext(ctx)
+	}
+}
+
+// PoolStats reports the connection pool counters. It never fails; a busy
+// pool should not take the instance out of rotation.
+func PoolStats(db *sql.DB) Check {
+	return func(ctx context.Context) (map[string]any, error) {
+		stats := db.Stats()
+		return map[string]any{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration":        stats.WaitDuration.String(),
+		}, nil
+	}
+}
@@ -0,0 +1,102 @@
+// Package lockout tracks failed login attempts and slows down repeated
+// failures with exponential backoff until a key is temporarily locked out.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Tracker counts failures per key, such as a username or a client IP.
+type Tracker interface {
+	// Check returns how long the key has to wait before it may try again,
+	// or zero when an attempt is allowed right now.
+	Check(ctx context.Context, key string) (time.Duration, error)
+	// Reserve counts an attempt as failed before it is made, so that
+	// parallel attempts cannot all pass a Check before any failure is
+	// recorded. When the key has to wait, nothing is counted and the wait
+	// is returned; otherwise it returns zero.
+	Reserve(ctx context.Context, key string) (time.Duration, error)
+	// Release takes back the failure counted by Reserve for an attempt
+	// that succeeded.
+	Release(ctx context.Context, key string) error
+	// Reset forgets all failures of the key, e.g. after a successful login.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy decides how long a key waits after a number of failures.
+type Policy struct {
+	// FreeAttempts failures are allowed before any delay applies.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts; it
+	// doubles with every further failure.
+	BaseDelay time.Duration
+	// MaxDelay caps the wait; reaching it amounts to a temporary lockout.
+	MaxDelay time.Duration
+	// ResetAfter forgets the failures of a key that has not failed for
+	// this long.
+	ResetAfter time.Duration
+}
+
+// Delay returns the wait imposed after failures consecutive failures.
+func (p Policy) Delay(failures int) time.Duration {
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < over; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// state is what a tracker remembers about a key.
+type state struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// expired reports whether the failures are old enough to be forgotten.
+func (s state) expired(p Policy, now time.Time) bool {
+	return p.ResetAfter > 0 && now.Sub(s.lastFailure) >= p.ResetAfter && !now.Before(s.lockedUntil)
+}
+
+func (s state) wait(now time.Time) time.Duration {
+	if now.Before(s.lockedUntil) {
+		return s.lockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// reserve returns the state after an attempt at now is counted as failed,
+// or the state unchanged and the wait when the key is locked out.
+func (s state) reserve(p Policy, now time.Time) (state, time.Duration) {
+	// a row just inserted by the postgres tracker has no failures, and its
+	// database timestamps must not count as a lock
+	if s.failures == 0 || s.expired(p, now) {
+		s = state{}
+	}
+	if wait := s.wait(now); wait > 0 {
+		return s, wait
+	}
+	s.failures++
+	s.lastFailure = now
+	s.lockedUntil = now.Add(p.Delay(s.failures))
+	return s, 0
+}
+
+// release returns the state after a reserved attempt turned out to succeed.
+// Reserve only lets an attempt through when the key is not locked out, so
+// the lock the reservation started is lifted again.
+func (s state) release() state {
+	if s.failures > 0 {
+		s.failures--
+	}
+	s.lockedUntil = s.lastFailure
+	return s
+}
@@ -0,0 +1,163 @@
+package lockout
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	ResetAfter:   time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// newClockedTracker returns a memory tracker whose clock only moves when
+// the returned function is called.
+func newClockedTracker() (*MemoryTracker, func(time.Duration)) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewMemoryTracker(testPolicy)
+	tracker.now = func() time.Time { return now }
+	return tracker, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryTracker(t *testing.T) {
+	const key = "user:alice"
+	tests := []struct {
+		name string
+		// steps runs against a key that has used up its free attempts
+		steps    func(t *testing.T, tracker *MemoryTracker, advance func(time.Duration))
+		wantWait time.Duration
+	}{
+		{
+			name:     "locked after the free attempts",
+			steps:    func(*testing.T, *MemoryTracker, func(time.Duration)) {},
+			wantWait: time.Second,
+		},
+		{
+			name: "lock runs out",
+			steps: func(_ *testing.T, _ *MemoryTracker, advance func(time.Duration)) {
+				advance(time.Second)
+			},
+			wantWait: 0,
+		},
+		{
+			name: "backoff doubles",
+			steps: func(t *testing.T, tracker *MemoryTracker, advance func(time.Duration)) {
+				advance(time.Second)
+				mustReserve(t, tracker, key)
+			},
+			wantWait: 2 * time.Second,
+		},
+		{
+			name: "failures expire",
+			steps: func(t *testing.T, tracker *MemoryTracker, advance func(time.Duration)) {
+				advance(testPolicy.ResetAfter)
+				for range testPolicy.FreeAttempts {
+					mustReserve(t, tracker, key)
+				}
+			},
+			wantWait: 0,
+		},
+		{
+			name: "reset forgets failures",
+			steps: func(t *testing.T, tracker *MemoryTracker, _ func(time.Duration)) {
+				if err := tracker.Reset(t.Context(), key); err != nil {
+					t.Fatal(err)
+				}
+				mustReserve(t, tracker, key)
+			},
+			wantWait: 0,
+		},
+		{
+			name: "release lifts the lock of the reservation",
+			steps: func(t *testing.T, tracker *MemoryTracker, _ func(time.Duration)) {
+				if err := tracker.Release(t.Context(), key); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantWait: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, advance := newClockedTracker()
+			for range testPolicy.FreeAttempts + 1 {
+				mustReserve(t, tracker, key)
+			}
+			tt.steps(t, tracker, advance)
+			wait, err := tracker.Check(t.Context(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wait != tt.wantWait {
+				t.Errorf("Check = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func mustReserve(t *testing.T, tracker Tracker, key string) {
+	t.Helper()
+	wait, err := tracker.Reserve(t.Context(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait != 0 {
+		t.Fatalf("Reserve(%q) = %v, want an attempt", key, wait)
+	}
+}
+
+// TestMemoryTrackerReserveConcurrent checks that parallel attempts cannot
+// get past the backoff together.
+func TestMemoryTrackerReserveConcurrent(t *testing.T) {
+	tracker, _ := newClockedTracker()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := tracker.Reserve(t.Context(), "ip:192.0.2.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if want := testPolicy.FreeAttempts + 1; allowed != want {
+		t.Errorf("%d parallel attempts were allowed, want %d", allowed, want)
+	}
+}
@@ -0,0 +1,75 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryTracker keeps failures in process memory. It suits single instance
+// deployments and tests; state is lost on restart.
+type MemoryTracker struct {
+	policy Policy
+	now    func() time.Time
+
+	mu     sync.Mutex
+	states map[string]state
+}
+
+func NewMemoryTracker(policy Policy) *MemoryTracker {
+	return &MemoryTracker{
+		policy: policy,
+		now:    time.Now,
+		states: make(map[string]state),
+	}
+}
+
+func (t *MemoryTracker) Check(_ context.Context, key string) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	s, ok := t.states[key]
+	if !ok {
+		return 0, nil
+	}
+	if s.expired(t.policy, now) {
+		delete(t.states, key)
+		return 0, nil
+	}
+	return s.wait(now), nil
+}
+
+func (t *MemoryTracker) Reserve(_ context.Context, key string) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, wait := t.states[key].reserve(t.policy, t.now())
+	t.states[key] = s
+	return wait, nil
+}
+
+func (t *MemoryTracker) Release(_ context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.states[key]
+	if !ok {
+		return nil
+	}
+	s = s.release()
+	if s.failures == 0 {
+		delete(t.states, key)
+		return nil
+	}
+	t.states[key] = s
+	return nil
+}
+
+func (t *MemoryTracker) Reset(_ context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.states, key)
+	return nil
+}
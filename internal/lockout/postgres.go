@@ -0,0 +1,99 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresTracker stores failures in the login_attempts table so that every
+// server instance sees the same counts. Each call is bounded by timeout.
+type PostgresTracker struct {
+	db      *sql.DB
+	policy  Policy
+	timeout time.Duration
+}
+
+func NewPostgresTracker(db *sql.DB, policy Policy, timeout time.Duration) *PostgresTracker {
+	return &PostgresTracker{db: db, policy: policy, timeout: timeout}
+}
+
+func (t *PostgresTracker) Check(ctx context.Context, key string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	var s state
+	query := `SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1`
+	err := t.db.QueryRowContext(ctx, query, key).Scan(&s.failures, &s.lastFailure, &s.lockedUntil)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if s.expired(t.policy, now) {
+		return 0, nil
+	}
+	return s.wait(now), nil
+}
+
+func (t *PostgresTracker) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	var wait time.Duration
+	err := t.update(ctx, key, func(s state, now time.Time) state {
+		s, wait = s.reserve(t.policy, now)
+		return s
+	})
+	return wait, err
+}
+
+func (t *PostgresTracker) Release(ctx context.Context, key string) error {
+	return t.update(ctx, key, func(s state, _ time.Time) state {
+		return s.release()
+	})
+}
+
+// update applies change to the state of key with the row locked, so that
+// concurrent attempts on every instance are counted one after the other.
+// Keys left without failures are deleted.
+func (t *PostgresTracker) update(ctx context.Context, key string, change func(s state, now time.Time) state) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO login_attempts (key) VALUES ($1) ON CONFLICT (key) DO NOTHING`, key)
+	if err != nil {
+		return err
+	}
+	var s state
+	query := `SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, key).Scan(&s.failures, &s.lastFailure, &s.lockedUntil)
+	if err != nil {
+		return err
+	}
+
+	s = change(s, time.Now())
+	if s.failures == 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	} else {
+		query = `UPDATE login_attempts SET failures = $1, last_failure_at = $2, locked_until = $3 WHERE key = $4`
+		_, err = tx.ExecContext(ctx, query, s.failures, s.lastFailure, s.lockedUntil, key)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *PostgresTracker) Reset(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	_, err := t.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,99 @@
+// Package logging builds the application's slog logger. Records logged with
+// a request context carry that request's ID and, once authenticated, the
+// user's ID.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a logger writing records at level or above to w, formatted as
+// json or text.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logging: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("logging: unknown format %q", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+type requestInfoKey struct{}
+
+// requestInfo is shared by pointer so that middleware running after the
+// request ID was assigned, such as authentication, can add to it.
+type requestInfo struct {
+	requestID string
+	userID    int
+}
+
+// WithRequestID starts the request scoped log attributes for ctx.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{requestID: requestID})
+}
+
+// RequestID returns the ID stored by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.requestID
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user for the request in ctx. It is a
+// no-op when ctx was not prepared by WithRequestID.
+func SetUserID(ctx context.Context, userID int) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+// UserID returns the ID recorded by SetUserID, or 0.
+func UserID(ctx context.Context) int {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.userID
+	}
+	return 0
+}
+
+// contextHandler adds the request attributes and the trace and span IDs
+// found in the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		record.AddAttrs(slog.String("request_id", info.requestID))
+		if info.userID != 0 {
+			record.AddAttrs(slog.Int("user_id", info.userID))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		record.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
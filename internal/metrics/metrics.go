@@ -0,0 +1,30 @@
+// Package metrics defines the instrumentation points used by handlers,
+// middleware and stores. Callers depend only on the Metrics interface; the
+// Prometheus implementation is chosen when the application is wired up.
+package metrics
+
+import "time"
+
+type Metrics interface {
+	// ObserveHTTPRequest records a finished request. route is the router
+	// pattern, such as /workouts/{id}, not the raw path.
+	ObserveHTTPRequest(method, route string, status int, duration time.Duration)
+	// ObserveStoreQuery records the latency of one store method call.
+	ObserveStoreQuery(store, method string, duration time.Duration, err error)
+	// TokenIssued counts tokens handed out, by scope.
+	TokenIssued(scope string)
+	// AuthFailure counts rejected logins and rejected credentials, by reason.
+	AuthFailure(reason string)
+	WorkoutCreated()
+	UserRegistered()
+}
+
+// Nop discards everything. It is useful where instrumentation is optional.
+type Nop struct{}
+
+func (Nop) ObserveHTTPRequest(string, string, int, time.Duration)  {}
+func (Nop) ObserveStoreQuery(string, string, time.Duration, error) {}
+func (Nop) TokenIssued(string)                                     {}
+func (Nop) AuthFailure(string)                                     {}
+func (Nop) WorkoutCreated()                                        {}
+func (Nop) UserRegistered()                                        {}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "femproject"
+
+// Prometheus implements Metrics with its own registry, so only the
+// application's collectors are exposed by Handler.
+type Prometheus struct {
+	registry        *prometheus.Registry
+	httpRequests    *prometheus.CounterVec
+	httpDuration    *prometheus.HistogramVec
+	storeDuration   *prometheus.HistogramVec
+	storeErrors     *prometheus.CounterVec
+	tokensIssued    *prometheus.CounterVec
+	authFailures    *prometheus.CounterVec
+	workoutsCreated prometheus.Counter
+	usersRegistered prometheus.Counter
+}
+
+// NewPrometheus registers the application metrics together with the Go
+// runtime, process and db connection pool collectors. db may be nil when
+// the application runs without a database; dbName labels its pool metrics.
+func NewPrometheus(db *sql.DB, dbName string) *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route pattern and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_query_duration_seconds",
+			Help:      "Store method latency.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"store", "method"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "store_query_errors_total",
+			Help:      "Store method calls that returned an error.",
+		}, []string{"store", "method"}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Tokens issued by scope.",
+		}, []string{"scope"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failures_total",
+			Help:      "Rejected logins and credentials by reason.",
+		}, []string{"reason"}),
+		workoutsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "workouts_created_total",
+			Help:      "Workouts created.",
+		}),
+		usersRegistered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_registered_total",
+			Help:      "Users registered.",
+		}),
+	}
+	p.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		p.httpRequests,
+		p.httpDuration,
+		p.storeDuration,
+		p.storeErrors,
+		p.tokensIssued,
+		p.authFailures,
+		p.workoutsCreated,
+		p.usersRegistered,
+	)
+	if db != nil {
+		p.registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+	}
+	return p
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{Registry: p.registry})
+}
+
+func (p *Prometheus) ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	p.httpRequests.WithLabelValues(method, route, code).Inc()
+	p.httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) ObserveStoreQuery(store, method string, duration time.Duration, err error) {
+	p.storeDuration.WithLabelValues(store, method).Observe(duration.Seconds())
+	if err != nil {
+		p.storeErrors.WithLabelValues(store, method).Inc()
+	}
+}
+
+func (p *Prometheus) TokenIssued(scope string) {
+	p.tokensIssued.WithLabelValues(scope).Inc()
+}
+
+func (p *Prometheus) AuthFailure(reason string) {
+	p.authFailures.WithLabelValues(reason).Inc()
+}
+
+func (p *Prometheus) WorkoutCreated() {
+	p.workoutsCreated.Inc()
+}
+
+func (p *Prometheus) UserRegistered() {
+	p.usersRegistered.Inc()
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/syafae/femProject/internal/utils"
+)
+
+// ForwardedForHeader lists the addresses a request was forwarded for, the
+// client first and each proxy appending the peer it received it from.
+const ForwardedForHeader = "X-Forwarded-For"
+
+// ClientIP resolves the client address of every request for utils.ClientIP.
+// X-Forwarded-For is read from right to left only while the hops are in
+// trusted, so a client cannot pick the address its failed logins are
+// counted against. Without trusted proxies the header is ignored.
+func ClientIP(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip, ok := forwardedClientIP(r, trusted); ok {
+				r = utils.SetClientIP(r, ip.String())
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClientIP returns the first address that is not a trusted proxy,
+// walking from the peer of the connection back through X-Forwarded-For. It
+// stops at the last trusted hop when the header is malformed.
+func forwardedClientIP(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	ip := peer.Addr().Unmap()
+	isTrusted := func(ip netip.Addr) bool {
+		return slices.ContainsFunc(trusted, func(p netip.Prefix) bool { return p.Contains(ip) })
+	}
+	if !isTrusted(ip) {
+		return ip, true
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values(ForwardedForHeader) {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !isTrusted(ip) {
+			break
+		}
+	}
+	return ip, true
+}
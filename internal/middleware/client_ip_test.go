@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/syafae/femProject/internal/utils"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.0.2.1/32")}
+	tests := []struct {
+		name       string
+		trusted    []netip.Prefix
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxies", nil, "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"untrusted peer", trusted, "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted peer", trusted, "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop before the client", trusted, "10.1.2.3:4000", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", trusted, "192.0.2.1:4000", []string{"198.51.100.1, 10.0.0.5", "10.0.0.6"}, "198.51.100.1"},
+		{"only proxies", trusted, "10.1.2.3:4000", []string{"10.0.0.5"}, "10.0.0.5"},
+		{"malformed hop", trusted, "10.1.2.3:4000", []string{"198.51.100.1, bogus"}, "10.1.2.3"},
+		{"no header", trusted, "10.1.2.3:4000", nil, "10.1.2.3"},
+		{"mapped IPv4", trusted, "[::ffff:10.1.2.3]:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add(ForwardedForHeader, value)
+			}
+			var got string
+			ClientIP(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = utils.ClientIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
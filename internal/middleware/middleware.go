@@ -2,22 +2,49 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/syafae/femProject/internal/logging"
+	"github.com/syafae/femProject/internal/metrics"
+	"github.com/syafae/femProject/internal/roles"
 	"github.com/syafae/femProject/internal/store"
 	"github.com/syafae/femProject/internal/tokens"
 	"github.com/syafae/femProject/internal/utils"
 )
 
 type UserMiddleware struct {
-	UserStore store.UserStore
+	UserStore   store.UserStore
+	TokenStore  store.TokenStore
+	APIKeyStore store.APIKeyStore
+	Metrics     metrics.Metrics
+	Logger      *slog.Logger
 }
+
+const (
+	// DeviceLabelHeader lets clients name the device a session belongs to.
+	DeviceLabelHeader = "X-Device-Label"
+	// maxDeviceLabelLength is in bytes, which also keeps the label within
+	// the characters of its VARCHAR(100) column.
+	maxDeviceLabelLength = 100
+)
+
 type contextKey string
 
-const UserContextKey = contextKey("user")
+const (
+	UserContextKey       = contextKey("user")
+	TokenContextKey      = contextKey("token")
+	APIKeyContextKey     = contextKey("api_key")
+	scopeCheckContextKey = contextKey("scope_checked")
+)
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
+	if !user.IsAnonymous() {
+		logging.SetUserID(r.Context(), user.ID)
+	}
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -30,6 +57,55 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+// SetToken stores the bearer token the request was authenticated with.
+func SetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), TokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// GetToken returns the bearer token of the request, or "" for anonymous
+// requests.
+func GetToken(r *http.Request) string {
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	return token
+}
+
+// RequestClient describes the client that sent r for session bookkeeping.
+func RequestClient(r *http.Request, deviceLabel string) tokens.Client {
+	return tokens.Client{
+		UserAgent:   r.UserAgent(),
+		IP:          utils.ClientIP(r),
+		DeviceLabel: truncate(deviceLabel, maxDeviceLabelLength),
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8
+// sequence, so the result stays valid text for the database.
+func truncate(s string, n int) string {
+	end := 0
+	for end < len(s) {
+		_, size := utf8.DecodeRuneInString(s[end:])
+		if end+size > n {
+			break
+		}
+		end += size
+	}
+	return s[:end]
+}
+
+// SetAPIKey marks the request as authenticated with an API key.
+func SetAPIKey(r *http.Request, key *tokens.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), APIKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// GetAPIKey returns the API key the request was authenticated with, or nil
+// for session tokens and anonymous requests.
+func GetAPIKey(r *http.Request) *tokens.APIKey {
+	key, _ := r.Context().Value(APIKeyContextKey).(*tokens.APIKey)
+	return key
+}
+
 func (um *UserMiddleware) Authenicate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -41,32 +117,133 @@ func (um *UserMiddleware) Authenicate(next http.Handler) http.Handler {
 		}
 		headerParts := strings.Split(authHeader, " ")
 		if len(headerParts) != 2 || strings.ToLower(headerParts[0]) != "bearer" {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid authorization header"})
+			utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid authorization header")
 			return
 		}
 		token := headerParts[1]
-		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
+		if tokens.IsAPIKey(token) {
+			user, key, err := um.APIKeyStore.GetUserForAPIKey(r.Context(), token)
+			if errors.Is(err, store.ErrNotFound) {
+				um.Metrics.AuthFailure("invalid_api_key")
+				utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid or expired api key")
+				return
+			}
+			if err != nil {
+				um.writeError(w, r, "GetUserForAPIKey", err)
+				return
+			}
+			if user.Disabled {
+				um.Metrics.AuthFailure("disabled_user")
+				utils.WriteErrorCode(w, r, http.StatusForbidden, utils.CodeAccountDisabled, "your user account has been disabled")
+				return
+			}
+			r = SetUser(r, user)
+			r = SetAPIKey(r, key)
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, err := um.UserStore.GetUserToken(r.Context(), tokens.ScopeAuth, token)
+		if errors.Is(err, store.ErrNotFound) {
+			um.Metrics.AuthFailure("invalid_token")
+			utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeInvalidToken, "invalid or expired token")
+			return
+		}
 		if err != nil {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
+			um.writeError(w, r, "GetUserToken", err)
 			return
 		}
-		if user == nil {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid or expired token"})
+		if user.Disabled {
+			um.Metrics.AuthFailure("disabled_user")
+			utils.WriteErrorCode(w, r, http.StatusForbidden, utils.CodeAccountDisabled, "your user account has been disabled")
 			return
 		}
+		client := RequestClient(r, r.Header.Get(DeviceLabelHeader))
+		if err := um.TokenStore.TouchToken(r.Context(), tokens.HashPlaintext(token), client); err != nil {
+			// failing to record session activity must not fail the request
+			um.Logger.ErrorContext(r.Context(), "TouchToken", "error", err)
+		}
 		r = SetUser(r, user)
+		r = SetToken(r, token)
 		next.ServeHTTP(w, r)
 
 	})
 }
 
+// writeError sends the problem for err, logging it when it is a server
+// error, like the handlers do.
+func (um *UserMiddleware) writeError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	problem := utils.ProblemFor(err)
+	if problem.Status >= http.StatusInternalServerError {
+		um.Logger.ErrorContext(r.Context(), op, "error", err)
+	}
+	utils.WriteProblem(w, r, problem)
+}
+
 func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUser(r)
 		if user.IsAnonymous() {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to access this resource"})
+			utils.WriteErrorCode(w, r, http.StatusUnauthorized, utils.CodeUnauthorized, "you must be logged in to access this resource")
+			return
+		}
+		// API keys only reach routes that grant them a scope
+		if GetAPIKey(r) != nil && r.Context().Value(scopeCheckContextKey) == nil {
+			utils.WriteErrorCode(w, r, http.StatusForbidden, utils.CodeInsufficientScope, "api keys cannot access this resource")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope lets a route be called with an API key that has scope, in
+// addition to regular session tokens which are never scope restricted. It
+// implies RequireUser.
+func (um *UserMiddleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	fn := um.RequireUser(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := GetAPIKey(r)
+		if key != nil {
+			if !key.HasScope(scope) {
+				utils.WriteErrorCode(w, r, http.StatusForbidden, utils.CodeInsufficientScope, "api key is missing the "+scope+" scope")
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), scopeCheckContextKey, true))
+		}
+		fn.ServeHTTP(w, r)
+	})
+}
+
+// RequireActivatedUser is RequireUser for routes that additionally need a
+// verified email address.
+func (um *UserMiddleware) RequireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if !user.Activated {
+			utils.WriteErrorCode(w, r, http.StatusForbidden, utils.CodeAccountNotActivated, "your user account must be activated to access this resource")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+	return um.RequireUser(fn)
+}
+
+// Can reports whether the user of r may act with permission from their role.
+// Requests made with an API key never get role permissions, only the scopes
+// of the key and what the user owns.
+func Can(r *http.Request, permission roles.Permission) bool {
+	return GetAPIKey(r) == nil && GetUser(r).Can(permission)
+}
+
+// RequirePermission restricts a route to users whose role grants
+// permission. It implies RequireUser, so API keys are rejected.
+func (um *UserMiddleware) RequirePermission(permission roles.Permission, next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+		if !user.Can(permission) {
+			utils.WriteErrorCode(w, r, http.StatusForbidden, utils.CodeForbidden, "you do not have permission to access this resource")
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
+	return um.RequireUser(fn)
 }
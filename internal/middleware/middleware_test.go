@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRequestClientDeviceLabel(t *testing.T) {
+	tests := []struct {
+		name, label, want string
+	}{
+		{"short", "Pixel 8", "Pixel 8"},
+		{"ascii", strings.Repeat("a", 120), strings.Repeat("a", maxDeviceLabelLength)},
+		// 33 three-byte runes fit in 99 bytes, the 34th would split
+		{"multibyte", strings.Repeat("€", 40), strings.Repeat("€", 33)},
+		{"emoji boundary", "a" + strings.Repeat("💪", 30), "a" + strings.Repeat("💪", 24)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := RequestClient(httptest.NewRequest("POST", "/tokens/authentication", nil), tt.label)
+			if client.DeviceLabel != tt.want {
+				t.Errorf("DeviceLabel = %q, want %q", client.DeviceLabel, tt.want)
+			}
+			if !utf8.ValidString(client.DeviceLabel) {
+				t.Errorf("DeviceLabel %q is not valid UTF-8", client.DeviceLabel)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tokens
+ADD COLUMN family TEXT,
+ADD COLUMN used_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_tokens_family ON tokens (family);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tokens_family;
+
+ALTER TABLE tokens
+DROP COLUMN used_at,
+DROP COLUMN family;
+
+-- +goose StatementEnd
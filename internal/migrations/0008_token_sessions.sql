@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE tokens
+ADD COLUMN id BIGSERIAL UNIQUE,
+ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN last_used_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN device_label VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_tokens_user_scope ON tokens (user_id, scope);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_tokens_user_scope;
+
+ALTER TABLE tokens
+DROP COLUMN device_label,
+DROP COLUMN ip,
+DROP COLUMN user_agent,
+DROP COLUMN last_used_at,
+DROP COLUMN created_at,
+DROP COLUMN id;
+
+-- +goose StatementEnd
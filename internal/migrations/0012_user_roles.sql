@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false,
+ADD CONSTRAINT valid_user_role CHECK (role IN ('user', 'coach', 'admin'));
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP CONSTRAINT valid_user_role,
+DROP COLUMN disabled,
+DROP COLUMN role;
+
+-- +goose StatementEnd
@@ -0,0 +1,171 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS exercises (
+    id BIGSERIAL PRIMARY KEY,
+    -- NULL for the built-in catalog
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    category VARCHAR(20) NOT NULL,
+    primary_muscles TEXT NOT NULL DEFAULT '',
+    secondary_muscles TEXT NOT NULL DEFAULT '',
+    equipment TEXT NOT NULL DEFAULT '',
+    measurement VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT valid_exercise_category CHECK (category IN ('strength', 'cardio', 'mobility')),
+    CONSTRAINT valid_exercise_measurement CHECK (measurement IN ('reps', 'duration', 'distance'))
+);
+
+-- names are unique within the catalog and within each user's own exercises
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_built_in_name ON exercises (lower(name)) WHERE user_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_user_name ON exercises (user_id, lower(name)) WHERE user_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS exercise_aliases (
+    exercise_id BIGINT NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+    order_index INT NOT NULL,
+    alias VARCHAR(255) NOT NULL,
+    PRIMARY KEY (exercise_id, order_index)
+);
+
+-- entries keep exercise_name for display; it is what was logged
+ALTER TABLE workout_entries ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_workout_entries_exercise_id ON workout_entries (exercise_id);
+
+-- the built-in catalog, kept in sync with builtInExercises in internal/store
+INSERT INTO exercises (name, category, primary_muscles, secondary_muscles, equipment, measurement) VALUES
+    ('Back Squat', 'strength', 'quadriceps glutes', 'hamstrings core', 'barbell rack', 'reps'),
+    ('Front Squat', 'strength', 'quadriceps', 'glutes core', 'barbell rack', 'reps'),
+    ('Goblet Squat', 'strength', 'quadriceps glutes', 'core', 'kettlebell', 'reps'),
+    ('Deadlift', 'strength', 'hamstrings glutes lower_back', 'quadriceps upper_back forearms', 'barbell', 'reps'),
+    ('Romanian Deadlift', 'strength', 'hamstrings glutes', 'lower_back', 'barbell', 'reps'),
+    ('Bench Press', 'strength', 'chest', 'triceps shoulders', 'barbell bench', 'reps'),
+    ('Incline Bench Press', 'strength', 'chest shoulders', 'triceps', 'barbell bench', 'reps'),
+    ('Dumbbell Bench Press', 'strength', 'chest', 'triceps shoulders', 'dumbbell bench', 'reps'),
+    ('Overhead Press', 'strength', 'shoulders', 'triceps upper_back core', 'barbell', 'reps'),
+    ('Barbell Row', 'strength', 'upper_back lats', 'biceps lower_back', 'barbell', 'reps'),
+    ('Dumbbell Row', 'strength', 'lats upper_back', 'biceps', 'dumbbell bench', 'reps'),
+    ('Pull-up', 'strength', 'lats', 'biceps upper_back', 'pull_up_bar', 'reps'),
+    ('Chin-up', 'strength', 'lats biceps', 'upper_back', 'pull_up_bar', 'reps'),
+    ('Lat Pulldown', 'strength', 'lats', 'biceps upper_back', 'cable', 'reps'),
+    ('Push-up', 'strength', 'chest', 'triceps shoulders core', '', 'reps'),
+    ('Dip', 'strength', 'chest triceps', 'shoulders', 'dip_bars', 'reps'),
+    ('Lunge', 'strength', 'quadriceps glutes', 'hamstrings', 'dumbbell', 'reps'),
+    ('Bulgarian Split Squat', 'strength', 'quadriceps glutes', 'hamstrings', 'dumbbell bench', 'reps'),
+    ('Hip Thrust', 'strength', 'glutes', 'hamstrings', 'barbell bench', 'reps'),
+    ('Leg Press', 'strength', 'quadriceps glutes', 'hamstrings', 'machine', 'reps'),
+    ('Leg Curl', 'strength', 'hamstrings', 'calves', 'machine', 'reps'),
+    ('Calf Raise', 'strength', 'calves', '', '', 'reps'),
+    ('Dumbbell Curl', 'strength', 'biceps', 'forearms', 'dumbbell', 'reps'),
+    ('Triceps Pushdown', 'strength', 'triceps', '', 'cable', 'reps'),
+    ('Lateral Raise', 'strength', 'shoulders', '', 'dumbbell', 'reps'),
+    ('Face Pull', 'strength', 'shoulders upper_back', 'biceps', 'cable', 'reps'),
+    ('Kettlebell Swing', 'strength', 'glutes hamstrings', 'core shoulders', 'kettlebell', 'reps'),
+    ('Hanging Leg Raise', 'strength', 'core', 'hip_flexors', 'pull_up_bar', 'reps'),
+    ('Plank', 'strength', 'core', 'shoulders', 'mat', 'duration'),
+    ('Side Plank', 'strength', 'obliques', 'core', 'mat', 'duration'),
+    ('Running', 'cardio', 'quadriceps hamstrings calves', 'glutes', '', 'distance'),
+    ('Treadmill Run', 'cardio', 'quadriceps hamstrings calves', 'glutes', 'treadmill', 'distance'),
+    ('Walking', 'cardio', 'quadriceps calves', 'hamstrings glutes', '', 'distance'),
+    ('Cycling', 'cardio', 'quadriceps', 'hamstrings glutes calves', 'bike', 'distance'),
+    ('Rowing', 'cardio', 'upper_back quadriceps', 'lats hamstrings biceps', 'rower', 'distance'),
+    ('Swimming', 'cardio', 'lats shoulders', 'core', '', 'distance'),
+    ('Jump Rope', 'cardio', 'calves', 'shoulders', 'jump_rope', 'duration'),
+    ('Burpee', 'cardio', 'quadriceps chest', 'core shoulders', '', 'reps'),
+    ('Elliptical', 'cardio', 'quadriceps', 'glutes', 'machine', 'duration'),
+    ('Hip Flexor Stretch', 'mobility', 'hip_flexors', 'quadriceps', 'mat', 'duration'),
+    ('Hamstring Stretch', 'mobility', 'hamstrings', 'calves', 'mat', 'duration'),
+    ('Cat-Cow', 'mobility', 'lower_back', 'core', 'mat', 'reps'),
+    ('World''s Greatest Stretch', 'mobility', 'hip_flexors hamstrings', 'upper_back', '', 'reps'),
+    ('Band Pull-Apart', 'mobility', 'upper_back shoulders', '', 'band', 'reps'),
+    ('Foam Rolling', 'mobility', 'quadriceps hamstrings', 'upper_back calves', 'foam_roller', 'duration');
+
+-- VALUES columns are named column1, column2, ... in both postgres and sqlite
+INSERT INTO exercise_aliases (exercise_id, order_index, alias)
+SELECT e.id, v.column2, v.column3
+FROM (VALUES
+    ('Back Squat', 0, 'Squat'),
+    ('Back Squat', 1, 'Squats'),
+    ('Back Squat', 2, 'Barbell Squat'),
+    ('Deadlift', 0, 'Conventional Deadlift'),
+    ('Deadlift', 1, 'Deadlifts'),
+    ('Romanian Deadlift', 0, 'RDL'),
+    ('Bench Press', 0, 'Barbell Bench Press'),
+    ('Bench Press', 1, 'Flat Bench'),
+    ('Incline Bench Press', 0, 'Incline Press'),
+    ('Dumbbell Bench Press', 0, 'DB Bench'),
+    ('Overhead Press', 0, 'OHP'),
+    ('Overhead Press', 1, 'Military Press'),
+    ('Overhead Press', 2, 'Shoulder Press'),
+    ('Barbell Row', 0, 'Bent-Over Row'),
+    ('Barbell Row', 1, 'Bent Over Row'),
+    ('Dumbbell Row', 0, 'One-Arm Row'),
+    ('Pull-up', 0, 'Pull-ups'),
+    ('Pull-up', 1, 'Pullup'),
+    ('Pull-up', 2, 'Pullups'),
+    ('Chin-up', 0, 'Chin-ups'),
+    ('Chin-up', 1, 'Chinup'),
+    ('Lat Pulldown', 0, 'Pulldown'),
+    ('Push-up', 0, 'Push-ups'),
+    ('Push-up', 1, 'Pushup'),
+    ('Push-up', 2, 'Pushups'),
+    ('Dip', 0, 'Dips'),
+    ('Lunge', 0, 'Lunges'),
+    ('Bulgarian Split Squat', 0, 'Split Squat'),
+    ('Hip Thrust', 0, 'Barbell Hip Thrust'),
+    ('Leg Curl', 0, 'Hamstring Curl'),
+    ('Calf Raise', 0, 'Calf Raises'),
+    ('Dumbbell Curl', 0, 'Biceps Curl'),
+    ('Dumbbell Curl', 1, 'Bicep Curl'),
+    ('Triceps Pushdown', 0, 'Tricep Pushdown'),
+    ('Lateral Raise', 0, 'Side Raise'),
+    ('Kettlebell Swing', 0, 'KB Swing'),
+    ('Hanging Leg Raise', 0, 'Leg Raise'),
+    ('Plank', 0, 'Planks'),
+    ('Plank', 1, 'Front Plank'),
+    ('Running', 0, 'Run'),
+    ('Running', 1, 'Jogging'),
+    ('Walking', 0, 'Walk'),
+    ('Cycling', 0, 'Bike'),
+    ('Cycling', 1, 'Biking'),
+    ('Rowing', 0, 'Row'),
+    ('Rowing', 1, 'Erg'),
+    ('Rowing', 2, 'Rowing Machine'),
+    ('Swimming', 0, 'Swim'),
+    ('Jump Rope', 0, 'Skipping'),
+    ('Jump Rope', 1, 'Skipping Rope'),
+    ('Burpee', 0, 'Burpees'),
+    ('Elliptical', 0, 'Cross Trainer'),
+    ('Hip Flexor Stretch', 0, 'Couch Stretch'),
+    ('Cat-Cow', 0, 'Cat Cow'),
+    ('Band Pull-Apart', 0, 'Pull-Apart'),
+    ('Foam Rolling', 0, 'Foam Roll')
+) AS v
+JOIN exercises AS e ON e.user_id IS NULL AND e.name = v.column1;
+
+-- link the entries logged so far, by name first and then by alias, unless
+-- they were logged in a way the exercise is not measured
+UPDATE workout_entries
+SET exercise_id = (
+    SELECT e.id FROM exercises AS e
+    WHERE e.user_id IS NULL AND lower(e.name) = lower(trim(workout_entries.exercise_name))
+);
+UPDATE workout_entries
+SET exercise_id = (
+    SELECT min(a.exercise_id) FROM exercise_aliases AS a
+    WHERE lower(a.alias) = lower(trim(workout_entries.exercise_name))
+)
+WHERE exercise_id IS NULL;
+UPDATE workout_entries
+SET exercise_id = NULL
+WHERE exercise_id IN (SELECT id FROM exercises WHERE measurement = 'reps') AND reps IS NULL
+   OR exercise_id IN (SELECT id FROM exercises WHERE measurement = 'duration') AND duration_seconds IS NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_workout_entries_exercise_id;
+ALTER TABLE workout_entries DROP COLUMN IF EXISTS exercise_id;
+DROP TABLE IF EXISTS exercise_aliases;
+DROP TABLE IF EXISTS exercises;
+
+-- +goose StatementEnd
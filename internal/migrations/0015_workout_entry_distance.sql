@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE workout_entries ADD COLUMN distance_meters DECIMAL(9, 2);
+
+-- an entry is counted in reps, or timed and/or measured over a distance
+ALTER TABLE workout_entries DROP CONSTRAINT IF EXISTS valid_workout_entry;
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry CHECK(
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL OR distance_meters IS NOT NULL) AND
+    (reps IS NULL OR (duration_seconds IS NULL AND distance_meters IS NULL))
+);
+
+-- distance exercises are now logged with a distance, which no entry has yet
+UPDATE workout_entries
+SET exercise_id = NULL
+WHERE exercise_id IN (SELECT id FROM exercises WHERE measurement = 'distance');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM workout_entries WHERE reps IS NULL AND duration_seconds IS NULL;
+ALTER TABLE workout_entries DROP CONSTRAINT IF EXISTS valid_workout_entry;
+ALTER TABLE workout_entries ADD CONSTRAINT valid_workout_entry CHECK(
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+    (reps IS NULL OR duration_seconds IS NULL)
+);
+ALTER TABLE workout_entries DROP COLUMN IF EXISTS distance_meters;
+-- +goose StatementEnd
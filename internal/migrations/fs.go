@@ -1,7 +1,18 @@
 package migrations
 
-import "embed"
+import (
+	"embed"
+	"io/fs"
+)
 
 //go:embed *.sql
 
-var FS embed.FS
\ No newline at end of file
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLite holds the migrations of the sqlite store. It starts from the
+// schema FS had reached at 0013; later schema changes need a migration in
+// both.
+var SQLite, _ = fs.Sub(sqliteFS, "sqlite")
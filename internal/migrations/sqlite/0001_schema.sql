@@ -0,0 +1,121 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The schema of the postgres migrations up to 0013_login_attempts. Times are
+-- stored as fixed width UTC text, see sqliteTimeFormat in internal/store.
+-- Failed login counts are kept in memory with this backend, so there is no
+-- login_attempts table.
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) UNIQUE NOT NULL,
+    email VARCHAR(100) UNIQUE NOT NULL,
+    password_hash BLOB NOT NULL,
+    bio TEXT,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    activated BOOLEAN NOT NULL DEFAULT false,
+    totp_secret BLOB,
+    totp_enabled BOOLEAN NOT NULL DEFAULT false,
+    totp_last_step BIGINT,
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
+    disabled BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    CONSTRAINT valid_user_role CHECK (role IN ('user', 'coach', 'admin'))
+);
+
+CREATE TABLE IF NOT EXISTS workouts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    duration_minutes INT NOT NULL,
+    calories_burned INT,
+    performed_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_workouts_user_performed_at ON workouts (user_id, performed_at);
+
+CREATE TABLE IF NOT EXISTS workout_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workout_id INT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    duration_seconds INT,
+    weight REAL,
+    sets INT NOT NULL,
+    reps INT,
+    notes TEXT,
+    order_index INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    CONSTRAINT valid_workout_entry CHECK(
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+        (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_workout_id ON workout_entries (workout_id);
+
+CREATE TABLE IF NOT EXISTS tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash BLOB UNIQUE NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry TIMESTAMP NOT NULL,
+    scope TEXT NOT NULL,
+    family TEXT,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    last_used_at TIMESTAMP,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    device_label VARCHAR(100) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_tokens_family ON tokens (family);
+CREATE INDEX IF NOT EXISTS idx_tokens_user_scope ON tokens (user_id, scope);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BLOB NOT NULL,
+    used_at TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) UNIQUE NOT NULL,
+    hash BLOB UNIQUE NOT NULL,
+    scopes TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
+
+CREATE TABLE IF NOT EXISTS failed_logins (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(255) NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    ip TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    reason VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_failed_logins_created_at ON failed_logins (created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS failed_logins;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS workout_entries;
+DROP TABLE IF EXISTS workouts;
+DROP TABLE IF EXISTS users;
+-- +goose StatementEnd
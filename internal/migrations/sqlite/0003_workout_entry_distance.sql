@@ -0,0 +1,66 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The same as 0015_workout_entry_distance of the postgres migrations.
+-- SQLite cannot change a CHECK constraint, so the table is rebuilt.
+CREATE TABLE workout_entries_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workout_id INT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    duration_seconds INT,
+    weight REAL,
+    sets INT NOT NULL,
+    reps INT,
+    notes TEXT,
+    order_index INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL,
+    distance_meters REAL,
+    -- an entry is counted in reps, or timed and/or measured over a distance
+    CONSTRAINT valid_workout_entry CHECK(
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL OR distance_meters IS NOT NULL) AND
+        (reps IS NULL OR (duration_seconds IS NULL AND distance_meters IS NULL))
+    )
+);
+
+-- distance exercises are now logged with a distance, which no entry has yet
+INSERT INTO workout_entries_new (id, workout_id, exercise_name, duration_seconds, weight, sets, reps, notes, order_index, created_at, exercise_id)
+SELECT id, workout_id, exercise_name, duration_seconds, weight, sets, reps, notes, order_index, created_at,
+    CASE WHEN exercise_id IN (SELECT id FROM exercises WHERE measurement = 'distance') THEN NULL ELSE exercise_id END
+FROM workout_entries;
+
+DROP TABLE workout_entries;
+ALTER TABLE workout_entries_new RENAME TO workout_entries;
+CREATE INDEX IF NOT EXISTS idx_workout_entries_workout_id ON workout_entries (workout_id);
+CREATE INDEX IF NOT EXISTS idx_workout_entries_exercise_id ON workout_entries (exercise_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE workout_entries_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    workout_id INT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+    exercise_name VARCHAR(255) NOT NULL,
+    duration_seconds INT,
+    weight REAL,
+    sets INT NOT NULL,
+    reps INT,
+    notes TEXT,
+    order_index INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f000Z', 'now')),
+    exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL,
+    CONSTRAINT valid_workout_entry CHECK(
+        (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+        (reps IS NULL OR duration_seconds IS NULL)
+    )
+);
+
+INSERT INTO workout_entries_old (id, workout_id, exercise_name, duration_seconds, weight, sets, reps, notes, order_index, created_at, exercise_id)
+SELECT id, workout_id, exercise_name, duration_seconds, weight, sets, reps, notes, order_index, created_at, exercise_id
+FROM workout_entries
+WHERE reps IS NOT NULL OR duration_seconds IS NOT NULL;
+
+DROP TABLE workout_entries;
+ALTER TABLE workout_entries_old RENAME TO workout_entries;
+CREATE INDEX IF NOT EXISTS idx_workout_entries_workout_id ON workout_entries (workout_id);
+CREATE INDEX IF NOT EXISTS idx_workout_entries_exercise_id ON workout_entries (exercise_id);
+-- +goose StatementEnd
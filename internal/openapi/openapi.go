@@ -0,0 +1,102 @@
+// Package openapi serves the OpenAPI description of the API and a docs page
+// rendering it. The document is maintained by hand in openapi.json;
+// CheckRoutes keeps it in step with the router.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var (
+	//go:embed openapi.json
+	spec []byte
+	//go:embed docs.html
+	docsPage []byte
+)
+
+// Spec returns the OpenAPI document.
+func Spec() []byte {
+	return spec
+}
+
+// HandleSpec serves the OpenAPI document.
+func HandleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// HandleDocs serves a page listing the operations of the document served by
+// HandleSpec. It needs no assets beyond the page itself.
+func HandleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
+
+// CheckRoutes reports every route registered on routes that has no
+// operation in the document, and every operation that no longer has a route.
+// chi and OpenAPI write path parameters the same way, so patterns are
+// compared as they are.
+func CheckRoutes(routes chi.Routes) error {
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return fmt.Errorf("openapi: %w", err)
+	}
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			// path items may also hold summary, parameters and the like
+			if slices.Contains(methods, strings.ToUpper(method)) {
+				documented[operation(method, path)] = true
+			}
+		}
+	}
+
+	var missing []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		op := operation(method, route)
+		if documented[op] {
+			delete(documented, op)
+		} else {
+			missing = append(missing, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("openapi: %w", err)
+	}
+
+	var errs []error
+	slices.Sort(missing)
+	for _, op := range missing {
+		errs = append(errs, fmt.Errorf("openapi: route %s is not documented", op))
+	}
+	var stale []string
+	for op := range documented {
+		stale = append(stale, op)
+	}
+	slices.Sort(stale)
+	for _, op := range stale {
+		errs = append(errs, fmt.Errorf("openapi: documented operation %s has no route", op))
+	}
+	return errors.Join(errs...)
+}
+
+// methods are the operations a path item can describe.
+var methods = []string{
+	http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete,
+	http.MethodOptions, http.MethodHead, http.MethodPatch, http.MethodTrace,
+}
+
+func operation(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
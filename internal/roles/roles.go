@@ -0,0 +1,39 @@
+// Package roles maps user roles to the permissions they grant.
+package roles
+
+import "slices"
+
+const (
+	User  = "user"
+	Coach = "coach"
+	Admin = "admin"
+)
+
+type Permission string
+
+const (
+	// WorkoutsReadAny allows reading workouts owned by other users.
+	WorkoutsReadAny Permission = "workouts:read:any"
+	// WorkoutsWriteAny allows changing and deleting other users' workouts.
+	WorkoutsWriteAny Permission = "workouts:write:any"
+	UsersRead        Permission = "users:read"
+	UsersWrite       Permission = "users:write"
+	TokensRevokeAny  Permission = "tokens:revoke:any"
+)
+
+// Everyone may manage their own data; these permissions are only about
+// acting on other users.
+var rolePermissions = map[string][]Permission{
+	User:  {},
+	Coach: {WorkoutsReadAny},
+	Admin: {WorkoutsReadAny, WorkoutsWriteAny, UsersRead, UsersWrite, TokensRevokeAny},
+}
+
+func Valid(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func Has(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
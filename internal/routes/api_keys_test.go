@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/tokens"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+// TestAPIKeyScopes checks that an API key only reaches the routes its
+// scopes grant, and never the routes that take a session only.
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser("alice", roles.Admin)
+	workout := s.createWorkout(alice)
+	workoutPath := fmt.Sprintf("/workouts/%d", workout.ID)
+
+	readOnly := s.apiKey(alice, tokens.APIScopeWorkoutsRead, tokens.APIScopeProfileRead)
+	allScopes := s.apiKey(alice, tokens.APIScopes...)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		body   any
+		want   int
+	}{
+		{"read workouts", http.MethodGet, "/workouts", readOnly, nil, http.StatusOK},
+		{"read a workout", http.MethodGet, fmt.Sprintf("/workout/%d", workout.ID), readOnly, nil, http.StatusOK},
+		{"read the profile", http.MethodGet, "/users/alice", readOnly, nil, http.StatusOK},
+		{"update a workout without workouts:write", http.MethodPut, workoutPath, readOnly, map[string]any{"title": "Renamed"}, http.StatusForbidden},
+		{"delete a workout without workouts:write", http.MethodDelete, workoutPath, readOnly, nil, http.StatusForbidden},
+		{"create an exercise without workouts:write", http.MethodPost, "/exercises", readOnly, map[string]any{}, http.StatusForbidden},
+		{"update the profile without profile:write", http.MethodPut, "/users/alice", readOnly, map[string]any{"email": "alice@example.com"}, http.StatusForbidden},
+		{"update a workout", http.MethodPut, workoutPath, allScopes, map[string]any{"title": "Renamed"}, http.StatusOK},
+		{"update the profile", http.MethodPut, "/users/alice", allScopes, map[string]any{"email": "alice@example.com"}, http.StatusOK},
+
+		// session only routes
+		{"list api keys", http.MethodGet, "/users/me/api-keys", allScopes, nil, http.StatusForbidden},
+		{"create an api key", http.MethodPost, "/users/me/api-keys", allScopes, map[string]any{"name": "more", "scopes": tokens.APIScopes}, http.StatusForbidden},
+		{"delete an api key", http.MethodDelete, "/users/me/api-keys/1", allScopes, nil, http.StatusForbidden},
+		{"begin two-factor enrollment", http.MethodPost, "/users/me/2fa", allScopes, nil, http.StatusForbidden},
+		{"confirm two-factor enrollment", http.MethodPost, "/users/me/2fa/confirm", allScopes, map[string]any{"totp_code": "123456"}, http.StatusForbidden},
+		{"disable two-factor", http.MethodDelete, "/users/me/2fa", allScopes, map[string]any{"totp_code": "123456"}, http.StatusForbidden},
+		{"list sessions", http.MethodGet, "/tokens", allScopes, nil, http.StatusForbidden},
+		{"log out everywhere", http.MethodDelete, "/tokens", allScopes, nil, http.StatusForbidden},
+		{"list users as admin", http.MethodGet, "/admin/users", allScopes, nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(tt.method, tt.path, tt.key, tt.body)
+			expect(t, rec, tt.want)
+			if tt.want == http.StatusForbidden && !strings.Contains(rec.Body.String(), utils.CodeInsufficientScope) {
+				t.Errorf("problem code is not %s: %s", utils.CodeInsufficientScope, rec.Body.String())
+			}
+		})
+	}
+
+	// the same routes work with a session
+	session := s.sessionToken(alice)
+	expect(t, s.do(http.MethodGet, "/users/me/api-keys", session, nil), http.StatusOK)
+	expect(t, s.do(http.MethodGet, "/tokens", session, nil), http.StatusOK)
+	expect(t, s.do(http.MethodGet, "/admin/users", session, nil), http.StatusOK)
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	s := newTestServer(t)
+	session := s.sessionToken(s.createUser("alice", roles.User))
+
+	tests := []struct {
+		name  string
+		body  map[string]any
+		want  int
+		field string
+	}{
+		{"valid", map[string]any{"name": "backup", "scopes": []string{tokens.APIScopeWorkoutsRead}, "expires_in_days": 365}, http.StatusCreated, ""},
+		{"no expiry", map[string]any{"name": "backup", "scopes": []string{tokens.APIScopeWorkoutsRead}}, http.StatusCreated, ""},
+		{"expiry too long", map[string]any{"name": "backup", "scopes": []string{tokens.APIScopeWorkoutsRead}, "expires_in_days": 366}, http.StatusUnprocessableEntity, "expires_in_days"},
+		{"expiry not positive", map[string]any{"name": "backup", "scopes": []string{tokens.APIScopeWorkoutsRead}, "expires_in_days": 0}, http.StatusUnprocessableEntity, "expires_in_days"},
+		{"duplicate scope", map[string]any{"name": "backup", "scopes": []string{tokens.APIScopeWorkoutsRead, tokens.APIScopeWorkoutsRead}}, http.StatusUnprocessableEntity, "scopes"},
+		{"unknown scope", map[string]any{"name": "backup", "scopes": []string{"admin"}}, http.StatusUnprocessableEntity, "scopes"},
+		{"no scopes", map[string]any{"name": "backup"}, http.StatusUnprocessableEntity, "scopes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(http.MethodPost, "/users/me/api-keys", session, tt.body)
+			expect(t, rec, tt.want)
+			if tt.field != "" && !strings.Contains(rec.Body.String(), `"field": "`+tt.field+`"`) {
+				t.Errorf("the problem does not name %s: %s", tt.field, rec.Body.String())
+			}
+		})
+	}
+}
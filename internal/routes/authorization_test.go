@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+// TestAPIKeysDoNotCarryRolePermissions checks that an admin's API key only
+// reaches what the admin owns, while the admin's session reaches everything.
+func TestAPIKeysDoNotCarryRolePermissions(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.createUser("admin", roles.Admin)
+	alice := s.createUser("alice", roles.User)
+	session := s.sessionToken(admin)
+	key := s.apiKey(admin, tokens.APIScopes...)
+
+	workout := s.createWorkout(alice)
+	workoutPath := fmt.Sprintf("/workouts/%d", workout.ID)
+	update := map[string]any{"title": "Renamed"}
+	profile := map[string]any{"email": "taken-over@example.com"}
+
+	expect(t, s.do(http.MethodGet, fmt.Sprintf("/workout/%d", workout.ID), key, nil), http.StatusNotFound)
+	expect(t, s.do(http.MethodPut, workoutPath, key, update), http.StatusNotFound)
+	expect(t, s.do(http.MethodPut, workoutPath, key, "not an object"), http.StatusNotFound)
+	expect(t, s.do(http.MethodDelete, workoutPath, key, nil), http.StatusNotFound)
+	expect(t, s.do(http.MethodPut, "/users/alice", key, profile), http.StatusForbidden)
+
+	own := s.createWorkout(admin)
+	expect(t, s.do(http.MethodPut, fmt.Sprintf("/workouts/%d", own.ID), key, update), http.StatusOK)
+
+	expect(t, s.do(http.MethodPut, workoutPath, session, update), http.StatusOK)
+	expect(t, s.do(http.MethodDelete, workoutPath, session, nil), http.StatusOK)
+	expect(t, s.do(http.MethodPut, "/users/alice", session, profile), http.StatusOK)
+}
@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/syafae/femProject/internal/api"
+	"github.com/syafae/femProject/internal/app"
+	"github.com/syafae/femProject/internal/config"
+	"github.com/syafae/femProject/internal/health"
+	"github.com/syafae/femProject/internal/lockout"
+	"github.com/syafae/femProject/internal/mailer"
+	"github.com/syafae/femProject/internal/metrics"
+	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
+	"github.com/syafae/femProject/internal/totp"
+)
+
+func TestMain(m *testing.M) {
+	// every test user gets a password hash
+	store.SetBcryptCost(bcrypt.MinCost)
+	os.Exit(m.Run())
+}
+
+// testServer is the API on the memory store, with the stores kept at hand
+// so tests can arrange data without going through the routes.
+type testServer struct {
+	t        *testing.T
+	handler  http.Handler
+	users    store.UserStore
+	workouts store.WorkoutStore
+	tokens   store.TokenStore
+	apiKeys  store.APIKeyStore
+	mailer   *mailer.FileMailer
+	cipher   *totp.Cipher
+}
+
+var testLockoutPolicy = lockout.Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Minute,
+	MaxDelay:     time.Hour,
+	ResetAfter:   time.Hour,
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db := store.NewMemoryDB()
+	users := store.NewMemoryUserStore(db)
+	tokenStore := store.NewMemoryTokenStore(db)
+	apiKeys := store.NewMemoryAPIKeyStore(db)
+	workouts := store.NewMemoryWorkoutStore(db)
+	exercises := store.NewMemoryExerciseStore(db)
+	appMetrics := metrics.NewPrometheus(nil, "memory")
+	appMailer, err := mailer.NewFileMailer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := totp.NewCipher(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttls := config.TokenConfig{AuthTTL: time.Hour, RefreshTTL: 24 * time.Hour}
+	userTracker := lockout.NewMemoryTracker(testLockoutPolicy)
+	ipTracker := lockout.NewMemoryTracker(testLockoutPolicy)
+
+	application := &app.Application{
+		Logger:               logger,
+		WorkoutHandler:       api.NewWorkoutHandler(workouts, exercises, appMetrics, logger),
+		ExerciseHandler:      api.NewExerciseHandler(exercises, logger),
+		UserHandler:          api.NewUserHandler(users, tokenStore, appMailer, appMetrics, logger),
+		TokenHandler:         api.NewTokenHandler(tokenStore, users, store.NewMemoryLoginAuditStore(db), userTracker, ipTracker, cipher, ttls, appMetrics, logger),
+		TwoFactorHandler:     api.NewTwoFactorHandler(users, userTracker, ipTracker, cipher, logger),
+		PasswordResetHandler: api.NewPasswordResetHandler(users, tokenStore, appMailer, logger),
+		APIKeyHandler:        api.NewAPIKeyHandler(apiKeys, appMetrics, logger),
+		AdminHandler:         api.NewAdminHandler(users, tokenStore, logger),
+		Middleware:           middleware.UserMiddleware{UserStore: users, TokenStore: tokenStore, APIKeyStore: apiKeys, Metrics: appMetrics, Logger: logger},
+		Metrics:              appMetrics,
+		Health:               health.NewRegistry(time.Second),
+	}
+	return &testServer{
+		t:        t,
+		handler:  SetUpRoutes(application),
+		users:    users,
+		workouts: workouts,
+		tokens:   tokenStore,
+		apiKeys:  apiKeys,
+		mailer:   appMailer,
+		cipher:   cipher,
+	}
+}
+
+// createUser adds an activated user with the password "Password123!".
+func (s *testServer) createUser(username, role string) *store.User {
+	s.t.Helper()
+	user := &store.User{UserName: username, Email: username + "@example.com", Role: role, Activated: true}
+	if _, err := user.PasswordHash.Set("Password123!"); err != nil {
+		s.t.Fatal(err)
+	}
+	if err := s.users.CreateUser(s.t.Context(), user); err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+// sessionToken returns the plaintext of a new authentication token of user.
+func (s *testServer) sessionToken(user *store.User) string {
+	s.t.Helper()
+	token, err := s.tokens.CreateNewToken(s.t.Context(), user.ID, time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return token.Plaintext
+}
+
+// apiKey returns the plaintext of a new API key of user with scopes.
+func (s *testServer) apiKey(user *store.User, scopes ...string) string {
+	s.t.Helper()
+	key, err := tokens.GenerateAPIKey(user.ID, "test", scopes, nil)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if err := s.apiKeys.CreateAPIKey(s.t.Context(), key); err != nil {
+		s.t.Fatal(err)
+	}
+	return key.Plaintext
+}
+
+// createWorkout adds a workout owned by user.
+func (s *testServer) createWorkout(user *store.User) *store.Workout {
+	s.t.Helper()
+	reps := 10
+	workout, err := s.workouts.CreateWorkout(s.t.Context(), &store.Workout{
+		UserID:          user.ID,
+		Title:           "Leg day",
+		DurationMinutes: 45,
+		PerformedAt:     time.Now().UTC(),
+		Entries:         []store.WorkoutEntry{{ExerciseName: "Squat", Sets: 3, Reps: &reps}},
+	})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return workout
+}
+
+// do sends body, encoded as JSON unless it is nil, with credential as the
+// bearer token unless it is empty.
+func (s *testServer) do(method, path, credential string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if credential != "" {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect fails the test when rec does not have status want.
+func expect(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body.String())
+	}
+}
@@ -1,36 +1,104 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/syafae/femProject/internal/app"
+	"github.com/syafae/femProject/internal/middleware"
+	"github.com/syafae/femProject/internal/openapi"
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/tokens"
+	"github.com/syafae/femProject/internal/utils"
 )
 
 func SetUpRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.ClientIP(app.TrustedProxies))
+	r.Use(middleware.Tracing)
+	r.Use(middleware.AccessLog(app.Logger))
+	r.Use(middleware.Metrics(app.Metrics))
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteErrorCode(w, r, http.StatusNotFound, utils.CodeNotFound, "no route matches "+r.URL.Path)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteErrorCode(w, r, http.StatusMethodNotAllowed, utils.CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+	})
 
 	r.Group(func(r chi.Router) {
 		r.Use(app.Middleware.Authenicate)
 		// Add any middleware that should be applied to all routes here
 		//workouts
-		r.Get("/workout/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleGetWorkoutByID))
-		r.Post("/workouts", app.Middleware.RequireUser(app.WorkoutHandler.HandleCreateWorkout))
-		r.Put("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleUpdateWorkoutByID))
-		r.Delete("/workouts/{id}", app.Middleware.RequireUser(app.WorkoutHandler.HandleDeleteWorkoutByID))
+		r.Get("/workouts", app.Middleware.RequireScope(tokens.APIScopeWorkoutsRead, app.WorkoutHandler.HandleListWorkouts))
+		r.Get("/workout/{id}", app.Middleware.RequireScope(tokens.APIScopeWorkoutsRead, app.WorkoutHandler.HandleGetWorkoutByID))
+		r.Post("/workouts", app.Middleware.RequireScope(tokens.APIScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.WorkoutHandler.HandleCreateWorkout)))
+		r.Put("/workouts/{id}", app.Middleware.RequireScope(tokens.APIScopeWorkoutsWrite, app.WorkoutHandler.HandleUpdateWorkoutByID))
+		r.Delete("/workouts/{id}", app.Middleware.RequireScope(tokens.APIScopeWorkoutsWrite, app.WorkoutHandler.HandleDeleteWorkoutByID))
+
+		//exercises
+		r.Get("/exercises", app.Middleware.RequireScope(tokens.APIScopeWorkoutsRead, app.ExerciseHandler.HandleListExercises))
+		r.Post("/exercises", app.Middleware.RequireScope(tokens.APIScopeWorkoutsWrite, app.Middleware.RequireActivatedUser(app.ExerciseHandler.HandleCreateExercise)))
 
 		//users
-		r.Get("/users/{username}", app.Middleware.RequireUser(app.UserHandler.HandleGetUserByName))
-		r.Put("/users/{username}", app.Middleware.RequireUser(app.UserHandler.HandleUpdateUser))
+		r.Get("/users/{username}", app.Middleware.RequireScope(tokens.APIScopeProfileRead, app.UserHandler.HandleGetUserByName))
+		r.Put("/users/{username}", app.Middleware.RequireScope(tokens.APIScopeProfileWrite, app.UserHandler.HandleUpdateUser))
+		r.Post("/users/me/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleBeginEnrollment))
+		r.Post("/users/me/2fa/confirm", app.Middleware.RequireUser(app.TwoFactorHandler.HandleConfirmEnrollment))
+		r.Delete("/users/me/2fa", app.Middleware.RequireUser(app.TwoFactorHandler.HandleDisable))
+
+		//api keys, managed with a session token only
+		r.Get("/users/me/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleListAPIKeys))
+		r.Post("/users/me/api-keys", app.Middleware.RequireUser(app.APIKeyHandler.HandleCreateAPIKey))
+		r.Delete("/users/me/api-keys/{id}", app.Middleware.RequireUser(app.APIKeyHandler.HandleDeleteAPIKey))
+
+		//tokens
+		r.Get("/tokens", app.Middleware.RequireUser(app.TokenHandler.HandleListSessions))
+		r.Delete("/tokens/current", app.Middleware.RequireUser(app.TokenHandler.HandleDeleteCurrentToken))
+		r.Delete("/tokens/{id}", app.Middleware.RequireUser(app.TokenHandler.HandleDeleteSession))
+		r.Delete("/tokens", app.Middleware.RequireUser(app.TokenHandler.HandleDeleteAllTokens))
+
+		//admin
+		r.Route("/admin", func(r chi.Router) {
+			r.Get("/users", app.Middleware.RequirePermission(roles.UsersRead, app.AdminHandler.HandleListUsers))
+			r.Put("/users/{id}/disabled", app.Middleware.RequirePermission(roles.UsersWrite, app.AdminHandler.HandleSetUserDisabled))
+			r.Put("/users/{id}/role", app.Middleware.RequirePermission(roles.UsersWrite, app.AdminHandler.HandleSetUserRole))
+			r.Delete("/users/{id}/tokens", app.Middleware.RequirePermission(roles.TokensRevokeAny, app.AdminHandler.HandleRevokeUserTokens))
+			r.Get("/workouts/{id}", app.Middleware.RequirePermission(roles.WorkoutsReadAny, app.WorkoutHandler.HandleGetWorkoutByID))
+		})
 
 	})
 	// Add routes that don't require authentication here
 
-	r.Get("/health", app.HealthCheck)
+	r.Get("/health/live", app.HandleLiveness)
+	r.Get("/health/ready", app.HandleReadiness)
+	// kept for existing probes, same as /health/ready
+	r.Get("/health", app.HandleReadiness)
+
+	//api description, see internal/openapi/openapi.json
+	r.Get("/openapi.json", openapi.HandleSpec)
+	r.Get("/docs", openapi.HandleDocs)
 
 	//user
 	r.Post("/users", app.UserHandler.HandleRegiserUserRequest)
+	r.Put("/users/activated", app.UserHandler.HandleActivateUser)
+	r.Post("/users/activation", app.UserHandler.HandleResendActivation)
 
 	//tokens
 	r.Post("/tokens/authentication", app.TokenHandler.HandleCreateToken)
+	r.Post("/tokens/refresh", app.TokenHandler.HandleRefreshToken)
+
+	//password reset
+	r.Post("/password-reset", app.PasswordResetHandler.HandleRequestPasswordReset)
+	r.Put("/password-reset", app.PasswordResetHandler.HandleConfirmPasswordReset)
+
+	return r
+}
 
+// SetUpMetricsRoutes serves the Prometheus metrics on their own listener, so
+// they are not reachable through the public API port.
+func SetUpMetricsRoutes(app *app.Application) *chi.Mux {
+	r := chi.NewRouter()
+	r.Method(http.MethodGet, "/metrics", app.Metrics.Handler())
 	return r
 }
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/syafae/femProject/internal/app"
+	"github.com/syafae/femProject/internal/config"
+	"github.com/syafae/femProject/internal/openapi"
+)
+
+// newApplication builds the application on the memory store.
+func newApplication(t *testing.T) *app.Application {
+	t.Helper()
+	// NewApplication sets the bcrypt cost of the whole package
+	args := []string{"-store=memory", "-log-level=error", fmt.Sprintf("-bcrypt-cost=%d", bcrypt.MinCost)}
+	cfg, _, err := config.Load(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	application, err := app.NewApplication(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { application.Close() })
+	return application
+}
+
+// TestRoutesDocumented fails when a route is missing from the OpenAPI
+// document or the document describes a route that no longer exists.
+func TestRoutesDocumented(t *testing.T) {
+	application := newApplication(t)
+
+	if err := openapi.CheckRoutes(SetUpRoutes(application)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMetricsNotPublic checks that /metrics is only served by the metrics
+// listener.
+func TestMetricsNotPublic(t *testing.T) {
+	application := newApplication(t)
+
+	rec := httptest.NewRecorder()
+	SetUpRoutes(application).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /metrics on the API router = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	rec = httptest.NewRecorder()
+	SetUpMetricsRoutes(application).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /metrics on the metrics router = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
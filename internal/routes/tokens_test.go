@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/syafae/femProject/internal/roles"
+)
+
+// TestLoginFailuresLookAlike checks that an unknown username and a wrong
+// password get the same answer, so logins do not reveal which users exist.
+func TestLoginFailuresLookAlike(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice", roles.User)
+
+	problem := func(username string) map[string]any {
+		t.Helper()
+		rec := s.do(http.MethodPost, "/tokens/authentication", "", map[string]any{"username": username, "password": "Wrong123!"})
+		expect(t, rec, http.StatusUnauthorized)
+		var body map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	unknown, wrongPassword := problem("mallory"), problem("alice")
+	for _, member := range []string{"status", "code", "detail"} {
+		if unknown[member] != wrongPassword[member] {
+			t.Errorf("%s = %v for an unknown user, %v for a wrong password", member, unknown[member], wrongPassword[member])
+		}
+	}
+}
+
+// TestParallelLoginGuesses checks that guesses sent at once cannot all get
+// past the backoff before their failures are counted.
+func TestParallelLoginGuesses(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice", roles.User)
+
+	const guesses = 20
+	codes := make([]int, guesses)
+	var wg sync.WaitGroup
+	for i := range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := s.do(http.MethodPost, "/tokens/authentication", "", map[string]any{"username": "alice", "password": "Wrong123!"})
+			codes[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Fatalf("status = %d, want %d or %d", code, http.StatusUnauthorized, http.StatusTooManyRequests)
+		}
+	}
+	if want := testLockoutPolicy.FreeAttempts + 1; checked != want {
+		t.Errorf("%d of %d parallel guesses were checked, want %d", checked, guesses, want)
+	}
+}
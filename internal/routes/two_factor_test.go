@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/totp"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+// enrollment is what a user got when enabling two-factor authentication.
+type enrollment struct {
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recovery_codes"`
+	// ConfirmedWith is the code that confirmed the enrollment, whose time
+	// step is used up.
+	ConfirmedWith string `json:"-"`
+}
+
+// enableTwoFactor enrolls the user of session through the API.
+func (s *testServer) enableTwoFactor(session string) *enrollment {
+	s.t.Helper()
+	rec := s.do(http.MethodPost, "/users/me/2fa", session, nil)
+	expect(s.t, rec, http.StatusCreated)
+	var e enrollment
+	if err := json.Unmarshal(rec.Body.Bytes(), &e); err != nil {
+		s.t.Fatal(err)
+	}
+	e.ConfirmedWith = totpCode(s.t, e.Secret, time.Now())
+	expect(s.t, s.do(http.MethodPost, "/users/me/2fa/confirm", session, map[string]any{"totp_code": e.ConfirmedWith}), http.StatusOK)
+	return &e
+}
+
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.CodeAt(secret, totp.Step(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// TestDisableTwoFactorLockout checks that wrong codes on the disable route
+// are counted like failed logins and eventually lock the user out.
+func TestDisableTwoFactorLockout(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser("alice", roles.User)
+	session := s.sessionToken(alice)
+	secret := s.enableTwoFactor(session).Secret
+
+	wrong := map[string]any{"recovery_code": "not-a-code"}
+	for i := range testLockoutPolicy.FreeAttempts {
+		rec := s.do(http.MethodDelete, "/users/me/2fa", session, wrong)
+		expect(t, rec, http.StatusUnprocessableEntity)
+		if rec.Header().Get("Retry-After") != "" {
+			t.Fatalf("attempt %d within the free attempts has a Retry-After", i+1)
+		}
+	}
+	rec := s.do(http.MethodDelete, "/users/me/2fa", session, wrong)
+	expect(t, rec, http.StatusUnprocessableEntity)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("the failure past the free attempts has no Retry-After")
+	}
+
+	// a valid code is refused while locked out, and so is a login
+	next := totpCode(t, secret, time.Now().Add(totp.Period))
+	expect(t, s.do(http.MethodDelete, "/users/me/2fa", session, map[string]any{"totp_code": next}), http.StatusTooManyRequests)
+	login := map[string]any{"username": "alice", "password": "Password123!", "totp_code": next}
+	expect(t, s.do(http.MethodPost, "/tokens/authentication", "", login), http.StatusTooManyRequests)
+
+	user, err := s.users.GetUserByName(t.Context(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.TwoFactor {
+		t.Error("two-factor authentication was disabled")
+	}
+}
+
+// TestTwoFactorLogin walks through enrollment and logins with a second
+// factor, checking that neither a TOTP step nor a recovery code can be used
+// twice.
+func TestTwoFactorLogin(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser("alice", roles.User)
+	enrolled := s.enableTwoFactor(s.sessionToken(alice))
+
+	login := func(secondFactor map[string]any) *httptest.ResponseRecorder {
+		t.Helper()
+		body := map[string]any{"username": "alice", "password": "Password123!"}
+		maps.Copy(body, secondFactor)
+		return s.do(http.MethodPost, "/tokens/authentication", "", body)
+	}
+	expectCode := func(rec *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+		expect(t, rec, status)
+		if !strings.Contains(rec.Body.String(), `"code": "`+code+`"`) {
+			t.Errorf("problem code is not %s: %s", code, rec.Body.String())
+		}
+	}
+
+	expectCode(login(nil), http.StatusUnauthorized, utils.CodeTwoFactorRequired)
+	// the step the enrollment was confirmed with is spent
+	expectCode(login(map[string]any{"totp_code": enrolled.ConfirmedWith}), http.StatusUnauthorized, utils.CodeInvalidTwoFactorCode)
+
+	next := totpCode(t, enrolled.Secret, time.Now().Add(totp.Period))
+	expect(t, login(map[string]any{"totp_code": next}), http.StatusCreated)
+	expectCode(login(map[string]any{"totp_code": next}), http.StatusUnauthorized, utils.CodeInvalidTwoFactorCode)
+
+	recovery := map[string]any{"recovery_code": strings.ToLower(enrolled.RecoveryCodes[0])}
+	expect(t, login(recovery), http.StatusCreated)
+	expectCode(login(recovery), http.StatusUnauthorized, utils.CodeInvalidTwoFactorCode)
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+// TestUpdateUserEmailRequiresActivation checks that a new address
+// deactivates the account until the token emailed to it is used.
+func TestUpdateUserEmailRequiresActivation(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser("alice", roles.User)
+	session := s.sessionToken(alice)
+	oldToken, err := s.tokens.CreateNewToken(t.Context(), alice.ID, time.Hour, tokens.ScopeActivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do(http.MethodPut, "/users/alice", session, map[string]any{"email": "alice@example.com", "bio": "Runner"})
+	expect(t, rec, http.StatusOK)
+	if user, _ := s.users.GetUserByName(t.Context(), "alice"); !user.Activated {
+		t.Fatal("keeping the email deactivated the account")
+	}
+	if len(s.mailer.Sent()) != 0 {
+		t.Fatalf("keeping the email sent %d emails", len(s.mailer.Sent()))
+	}
+
+	rec = s.do(http.MethodPut, "/users/alice", session, map[string]any{"email": "alice@example.org"})
+	expect(t, rec, http.StatusOK)
+	var body struct {
+		User store.User `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.User.Activated {
+		t.Error("the account is still activated after the email changed")
+	}
+	if _, err := s.users.GetUserToken(t.Context(), tokens.ScopeActivation, oldToken.Plaintext); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("the activation token sent before the change = %v, want %v", err, store.ErrNotFound)
+	}
+
+	sent := s.mailer.Sent()
+	if len(sent) != 1 || sent[0].To != "alice@example.org" {
+		t.Fatalf("sent %+v, want one email to the new address", sent)
+	}
+	expect(t, s.do(http.MethodPost, "/workouts", session, map[string]any{"title": "Run"}), http.StatusForbidden)
+
+	lines := strings.Fields(sent[0].Body)
+	newToken := lines[len(lines)-1]
+	expect(t, s.do(http.MethodPut, "/users/activated", "", map[string]any{"token": newToken}), http.StatusOK)
+	if user, _ := s.users.GetUserByName(t.Context(), "alice"); !user.Activated {
+		t.Error("the emailed token did not activate the account")
+	}
+}
+
+// TestUpdateUserRefusesPassword checks that the profile update does not
+// change the password, which only the password reset flow may do.
+func TestUpdateUserRefusesPassword(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser("alice", roles.User)
+	session := s.sessionToken(alice)
+
+	rec := s.do(http.MethodPut, "/users/alice", session, map[string]any{"email": "alice@example.com", "password": "N3wSecureP@ss"})
+	expect(t, rec, http.StatusUnprocessableEntity)
+	if !strings.Contains(rec.Body.String(), `"field": "password"`) {
+		t.Errorf("the problem does not name the password field: %s", rec.Body.String())
+	}
+	user, err := s.users.GetUserByName(t.Context(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := user.PasswordHash.Matches("Password123!"); !ok {
+		t.Error("the password changed")
+	}
+}
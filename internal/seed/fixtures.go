@@ -0,0 +1,126 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/syafae/femProject/internal/api"
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/store"
+)
+
+// Fixture is a known set of users and workouts, written as YAML or JSON
+// with the field names of the API:
+//
+//	users:
+//	  - username: alice
+//	    email: alice@example.com
+//	    password: Secret-pw1!
+//	    activated: true
+//	    workouts:
+//	      - title: Leg Day
+//	        performed_at: 2025-03-01T07:30:00Z
+//	        duration_minutes: 60
+//	        entries:
+//	          - {exercise_name: Squats, sets: 5, reps: 5, weight: 100, order_index: 1}
+//
+// Load fills in the ids, so tests can refer to what they loaded.
+type Fixture struct {
+	Users []FixtureUser `json:"users"`
+}
+
+type FixtureUser struct {
+	UserName  string `json:"username"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	Bio       string `json:"bio"`
+	Timezone  string `json:"timezone"`
+	Activated bool   `json:"activated"`
+	// Role defaults to user.
+	Role     string          `json:"role"`
+	Workouts []store.Workout `json:"workouts"`
+
+	// User is the stored user once the fixture is loaded.
+	User *store.User `json:"-"`
+}
+
+// ParseFixture decodes a fixture; name decides the format, JSON for a .json
+// file and YAML otherwise. Unknown fields are rejected so typos do not go
+// unnoticed.
+func ParseFixture(name string, data []byte) (*Fixture, error) {
+	if !strings.EqualFold(path.Ext(name), ".json") {
+		// YAML goes through JSON so both formats share the json field tags
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("seed: fixture %s: %w", name, err)
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("seed: fixture %s: %w", name, err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	fixture := &Fixture{}
+	if err := decoder.Decode(fixture); err != nil {
+		return nil, fmt.Errorf("seed: fixture %s: %w", name, err)
+	}
+	return fixture, nil
+}
+
+// Load writes the users and workouts of fixture through stores, in order.
+// Workouts the API would reject fail with a *utils.ValidationError.
+func Load(ctx context.Context, stores Stores, fixture *Fixture) (*Result, error) {
+	result := &Result{}
+	for i := range fixture.Users {
+		fu := &fixture.Users[i]
+		if fu.UserName == "" || fu.Email == "" || fu.Password == "" {
+			return result, fmt.Errorf("seed: fixture user %d needs a username, email and password", i)
+		}
+		if fu.Role == "" {
+			fu.Role = roles.User
+		}
+		if !roles.Valid(fu.Role) {
+			return result, fmt.Errorf("seed: fixture user %s: unknown role %q", fu.UserName, fu.Role)
+		}
+
+		user := &store.User{
+			UserName:  fu.UserName,
+			Email:     fu.Email,
+			Bio:       fu.Bio,
+			Timezone:  fu.Timezone,
+			Activated: fu.Activated,
+			Role:      fu.Role,
+		}
+		if _, err := user.PasswordHash.Set(fu.Password); err != nil {
+			return result, err
+		}
+		if err := stores.Users.CreateUser(ctx, user); err != nil {
+			return result, fmt.Errorf("seed: fixture user %s: %w", fu.UserName, err)
+		}
+		fu.User = user
+		result.Users++
+
+		for j := range fu.Workouts {
+			workout := &fu.Workouts[j]
+			workout.ID = 0
+			workout.UserID = user.ID
+			if err := api.ValidateWorkout(ctx, stores.Exercises, workout); err != nil {
+				return result, fmt.Errorf("seed: fixture workout %d of %s: %w", j, fu.UserName, err)
+			}
+			if _, err := stores.Workouts.CreateWorkout(ctx, workout); err != nil {
+				return result, fmt.Errorf("seed: fixture workout %d of %s: %w", j, fu.UserName, err)
+			}
+			result.Workouts++
+			result.Entries += len(workout.Entries)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package seed_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/seed"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/utils"
+)
+
+func TestMain(m *testing.M) {
+	// every user gets a password hash
+	store.SetBcryptCost(bcrypt.MinCost)
+	os.Exit(m.Run())
+}
+
+func memoryStores() seed.Stores {
+	db := store.NewMemoryDB()
+	return seed.Stores{
+		Users:     store.NewMemoryUserStore(db),
+		Workouts:  store.NewMemoryWorkoutStore(db),
+		Exercises: store.NewMemoryExerciseStore(db),
+	}
+}
+
+func TestLoadDemo(t *testing.T) {
+	raw, err := os.ReadFile("testdata/demo.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture, err := seed.ParseFixture("demo.yaml", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := memoryStores()
+	result, err := seed.Load(t.Context(), stores, fixture)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if *result != (seed.Result{Users: 3, Workouts: 3, Entries: 4}) {
+		t.Errorf("Load = %+v, want 3 users, 3 workouts and 4 entries", result)
+	}
+
+	wantRoles := []string{roles.Admin, roles.User, roles.User}
+	for i, fu := range fixture.Users {
+		if fu.User == nil || fu.User.ID != i+1 || fu.User.Role != wantRoles[i] {
+			t.Fatalf("user %s = %+v, want id %d with role %s", fu.UserName, fu.User, i+1, wantRoles[i])
+		}
+		for _, fixtureWorkout := range fu.Workouts {
+			if fixtureWorkout.ID == 0 {
+				t.Fatalf("workout %q of %s has no id", fixtureWorkout.Title, fu.UserName)
+			}
+			workout, err := stores.Workouts.GetWorkoutByID(t.Context(), int64(fixtureWorkout.ID))
+			if err != nil {
+				t.Fatalf("GetWorkoutByID(%d): %v", fixtureWorkout.ID, err)
+			}
+			if workout.UserID != fu.User.ID || workout.Title != fixtureWorkout.Title || len(workout.Entries) != len(fixtureWorkout.Entries) {
+				t.Errorf("workout %d = %+v, want %q of %s", workout.ID, workout, fixtureWorkout.Title, fu.UserName)
+			}
+			// every demo exercise is in the built-in catalog
+			for _, entry := range workout.Entries {
+				if entry.ExerciseID == nil {
+					t.Errorf("entry %s of %q is not linked to the catalog", entry.ExerciseName, workout.Title)
+				}
+			}
+		}
+	}
+}
+
+func TestLoadRejectsInvalidWorkouts(t *testing.T) {
+	fixture, err := seed.ParseFixture("invalid.yaml", []byte(`
+users:
+  - username: dave
+    email: dave@example.com
+    password: Dave-pw12!
+    workouts:
+      - title: Morning Run
+        performed_at: 2025-03-02T06:15:00Z
+        duration_minutes: 30
+        entries:
+          - {exercise_name: Running, sets: 1, reps: 10, distance_meters: 5000, order_index: 1}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := memoryStores()
+	result, err := seed.Load(t.Context(), stores, fixture)
+	var invalid *utils.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Load = %v, want a validation error", err)
+	}
+	if result.Workouts != 0 {
+		t.Errorf("Load created %d workouts, want none", result.Workouts)
+	}
+}
@@ -0,0 +1,259 @@
+// Package seed fills the stores with data for development and tests: either
+// generated users and workouts or a fixture read from YAML or JSON.
+package seed
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/syafae/femProject/internal/api"
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/store"
+)
+
+// Stores are the stores that seed data is written to. Workouts are checked
+// and linked to the exercise catalog of Exercises the way the API does it.
+type Stores struct {
+	Users     store.UserStore
+	Workouts  store.WorkoutStore
+	Exercises store.ExerciseStore
+}
+
+// Options select the generated data. The same options always produce the
+// same users and workouts.
+type Options struct {
+	Seed uint64
+	// Users is the number of users; each gets between 5 and 40 workouts.
+	Users int
+	// Password is the password of every user.
+	Password string
+	// Admin makes the first user an activated admin.
+	Admin bool
+	// Now anchors the workout dates, which fall in the 180 days before it.
+	// It defaults to DefaultNow so the data does not depend on the day it
+	// is generated.
+	Now time.Time
+}
+
+// DefaultNow is the default of Options.Now.
+var DefaultNow = time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+// Result counts what Generate created.
+type Result struct {
+	Users    int
+	Workouts int
+	Entries  int
+	// Admin is the username of the admin Generate created, if any.
+	Admin string
+}
+
+const (
+	minWorkoutsPerUser = 5
+	maxWorkoutsPerUser = 40
+	historyDays        = 180
+)
+
+var (
+	firstNames = []string{
+		"maya", "liam", "sofia", "noah", "amara", "lucas", "yuki", "omar", "elena", "mateo",
+		"priya", "jonas", "zoe", "felix", "nadia", "leo", "ines", "kai", "hana", "theo",
+	}
+	bios = []string{
+		"", "Training for my first marathon.", "Powerlifting on weekdays, trails on weekends.",
+		"Getting back into shape after a long break.", "Coach and lifelong rower.",
+		"Five by five, every week.", "Cyclist who also lifts.",
+	}
+	timezones = []string{"UTC", "Europe/Berlin", "Europe/London", "America/New_York", "America/Los_Angeles", "Asia/Tokyo", "Australia/Sydney"}
+)
+
+// liftExercise is counted in reps; bodyweight lifts have no weight range.
+type liftExercise struct {
+	name                 string
+	minWeight, maxWeight float64
+}
+
+// timedExercise is counted in seconds per set. Those with a speed are also
+// logged with their distance.
+type timedExercise struct {
+	name                   string
+	sets                   [2]int
+	minSeconds, maxSeconds int
+	caloriesPerMinute      float64
+	metersPerSecond        float64
+	title                  string
+}
+
+var (
+	lifts = []liftExercise{
+		{"Squats", 40, 180},
+		{"Bench Press", 30, 140},
+		{"Deadlift", 60, 220},
+		{"Overhead Press", 20, 80},
+		{"Barbell Row", 30, 120},
+		{"Lunges", 10, 60},
+		{"Dumbbell Curl", 6, 25},
+		{"Pull-ups", 0, 0},
+		{"Push-ups", 0, 0},
+		{"Dips", 0, 0},
+	}
+	timed = []timedExercise{
+		{"Running", [2]int{1, 1}, 15 * 60, 75 * 60, 11, 2.8, "Run"},
+		{"Cycling", [2]int{1, 1}, 30 * 60, 120 * 60, 9, 6.5, "Ride"},
+		{"Rowing", [2]int{1, 3}, 5 * 60, 20 * 60, 10, 4, "Rowing"},
+		{"Swimming", [2]int{1, 1}, 20 * 60, 60 * 60, 10, 0.7, "Swim"},
+		{"Jump Rope", [2]int{3, 6}, 60, 3 * 60, 12, 0, "Conditioning"},
+		{"Plank", [2]int{3, 4}, 30, 2 * 60, 4, 0, "Core"},
+	}
+	liftTitles = []string{"Leg Day", "Push Day", "Pull Day", "Upper Body", "Full Body Strength", "Heavy Triples", "Volume Day"}
+	times      = []string{"Morning", "Lunchtime", "Evening"}
+)
+
+// Generate creates opts.Users users with their workouts through stores.
+// Usernames do not depend on the seed, so it fails
+// with a store.ConflictError on a database that was seeded before.
+func Generate(ctx context.Context, stores Stores, opts Options) (*Result, error) {
+	if opts.Now.IsZero() {
+		opts.Now = DefaultNow
+	}
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed))
+
+	// hashing is slow at production costs and every user shares the password
+	var hashed store.User
+	if _, err := hashed.PasswordHash.Set(opts.Password); err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for i := range opts.Users {
+		name := fmt.Sprintf("%s%d", firstNames[i%len(firstNames)], i+1)
+		user := &store.User{
+			UserName:     name,
+			Email:        name + "@example.com",
+			PasswordHash: hashed.PasswordHash,
+			Bio:          pick(rng, bios),
+			Timezone:     pick(rng, timezones),
+			Activated:    rng.IntN(10) > 0,
+			Role:         roles.User,
+		}
+		if i == 0 && opts.Admin {
+			user.Role = roles.Admin
+			user.Activated = true
+			result.Admin = name
+		}
+		if err := stores.Users.CreateUser(ctx, user); err != nil {
+			return result, fmt.Errorf("seed: user %s: %w", name, err)
+		}
+		result.Users++
+
+		workouts := minWorkoutsPerUser + rng.IntN(maxWorkoutsPerUser-minWorkoutsPerUser+1)
+		for range workouts {
+			workout := generateWorkout(rng, opts.Now)
+			workout.UserID = user.ID
+			if err := api.ValidateWorkout(ctx, stores.Exercises, workout); err != nil {
+				return result, fmt.Errorf("seed: workout of %s: %w", name, err)
+			}
+			if _, err := stores.Workouts.CreateWorkout(ctx, workout); err != nil {
+				return result, fmt.Errorf("seed: workout of %s: %w", name, err)
+			}
+			result.Workouts++
+			result.Entries += len(workout.Entries)
+		}
+	}
+	return result, nil
+}
+
+// generateWorkout returns a strength, cardio or mixed session performed in
+// the historyDays before now.
+func generateWorkout(rng *rand.Rand, now time.Time) *store.Workout {
+	day := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -rng.IntN(historyDays))
+	workout := &store.Workout{
+		PerformedAt: day.Add(time.Duration(6*60+rng.IntN(15*12)*5) * time.Minute),
+	}
+
+	var seconds int
+	var calories float64
+	switch kind := rng.IntN(10); {
+	case kind < 5:
+		workout.Title = pick(rng, liftTitles)
+		seconds, calories = addLifts(rng, workout, 3+rng.IntN(4))
+	case kind < 8:
+		exercise := pick(rng, timed)
+		workout.Title = pick(rng, times) + " " + exercise.title
+		seconds, calories = addTimed(rng, workout, exercise)
+	default:
+		workout.Title = "Strength and Conditioning"
+		seconds, calories = addLifts(rng, workout, 2+rng.IntN(2))
+		finisherSeconds, finisherCalories := addTimed(rng, workout, pick(rng, timed))
+		seconds += finisherSeconds
+		calories += finisherCalories
+	}
+
+	// warm-up and rest between sets
+	workout.DurationMinutes = min(seconds/60+5+rng.IntN(15), 24*60)
+	workout.CaloriesBurned = int(calories)
+	if rng.IntN(3) == 0 {
+		workout.Description = pick(rng, []string{"Felt strong.", "Tired legs today.", "New personal best!", "Easy recovery pace.", "Short on time."})
+	}
+	return workout
+}
+
+// addLifts appends n different lifts and returns their estimated time and
+// calories.
+func addLifts(rng *rand.Rand, workout *store.Workout, n int) (int, float64) {
+	var seconds int
+	var calories float64
+	for _, i := range rng.Perm(len(lifts))[:n] {
+		lift := lifts[i]
+		entry := store.WorkoutEntry{
+			ExerciseName: lift.name,
+			Sets:         3 + rng.IntN(3),
+			Reps:         intPtr(3 + rng.IntN(10)),
+			OrderIndex:   len(workout.Entries) + 1,
+		}
+		if lift.maxWeight > 0 {
+			// plates come in 2.5 steps
+			weight := lift.minWeight + math.Round(rng.Float64()*(lift.maxWeight-lift.minWeight)/2.5)*2.5
+			entry.Weight = &weight
+		}
+		workout.Entries = append(workout.Entries, entry)
+		seconds += entry.Sets * 150
+		calories += float64(entry.Sets) * 12
+	}
+	return seconds, calories
+}
+
+// addTimed appends one timed exercise and returns its time and calories.
+func addTimed(rng *rand.Rand, workout *store.Workout, exercise timedExercise) (int, float64) {
+	sets := exercise.sets[0] + rng.IntN(exercise.sets[1]-exercise.sets[0]+1)
+	// round to 30 seconds so the durations look like they were entered by hand
+	duration := (exercise.minSeconds + rng.IntN(exercise.maxSeconds-exercise.minSeconds+1)) / 30 * 30
+	duration = max(duration, 30)
+	entry := store.WorkoutEntry{
+		ExerciseName:    exercise.name,
+		Sets:            sets,
+		DurationSeconds: intPtr(duration),
+		OrderIndex:      len(workout.Entries) + 1,
+	}
+	if exercise.metersPerSecond > 0 {
+		// to the nearest 10 meters, like a watch would show it
+		distance := math.Round(float64(duration)*exercise.metersPerSecond/10) * 10
+		entry.DistanceMeters = &distance
+	}
+	if sets == 1 && rng.IntN(4) == 0 {
+		entry.Notes = pick(rng, []string{"Intervals", "Steady", "Hilly route", "Tempo"})
+	}
+	workout.Entries = append(workout.Entries, entry)
+	seconds := sets * duration
+	return seconds, float64(seconds) / 60 * exercise.caloriesPerMinute
+}
+
+func pick[T any](rng *rand.Rand, values []T) T {
+	return values[rng.IntN(len(values))]
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,50 @@
+package seed_test
+
+import (
+	"testing"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/seed"
+	"github.com/syafae/femProject/internal/store"
+)
+
+func TestGenerate(t *testing.T) {
+	opts := seed.Options{Seed: 7, Users: 3, Password: "Seed-pass1!"}
+	first, err := seed.Generate(t.Context(), memoryStores(), opts)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if first.Users != 3 || first.Workouts < 3*5 || first.Admin != "" {
+		t.Errorf("Generate = %+v, want 3 users with at least 5 workouts each and no admin", first)
+	}
+
+	opts.Admin = true
+	stores := memoryStores()
+	second, err := seed.Generate(t.Context(), stores, opts)
+	if err != nil {
+		t.Fatalf("Generate with an admin: %v", err)
+	}
+	if second.Workouts != first.Workouts || second.Entries != first.Entries {
+		t.Errorf("Generate with the same seed = %+v, want the counts of %+v", second, first)
+	}
+	admin, err := stores.Users.GetUserByName(t.Context(), second.Admin)
+	if err != nil {
+		t.Fatalf("GetUserByName(%q): %v", second.Admin, err)
+	}
+	if admin.Role != roles.Admin || !admin.Activated {
+		t.Errorf("admin %s = %+v, want an activated admin", admin.UserName, admin)
+	}
+
+	// the generated workouts are ones the API accepts, linked to the catalog
+	workouts, _, err := stores.Workouts.ListWorkouts(t.Context(), store.WorkoutFilter{UserID: admin.ID, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workout := range workouts {
+		for _, entry := range workout.Entries {
+			if entry.ExerciseID == nil {
+				t.Errorf("entry %s of %q is not linked to the catalog", entry.ExerciseName, workout.Title)
+			}
+		}
+	}
+}
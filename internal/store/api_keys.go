@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *tokens.APIKey) error
+	ListAPIKeys(ctx context.Context, userID int) ([]*tokens.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID int, id int64) error
+	GetUserForAPIKey(ctx context.Context, plaintext string) (*User, *tokens.APIKey, error)
+}
+
+type PostgresAPIKeyStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB, timeout time.Duration) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db: db, timeout: timeout}
+}
+
+func (p *PostgresAPIKeyStore) CreateAPIKey(ctx context.Context, key *tokens.APIKey) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresAPIKeyStore.CreateAPIKey")
+	defer func() { end(err) }()
+
+	query := `INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expires_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, created_at`
+	return p.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, " "), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+}
+
+func (p *PostgresAPIKeyStore) ListAPIKeys(ctx context.Context, userID int) (_ []*tokens.APIKey, err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresAPIKeyStore.ListAPIKeys")
+	defer func() { end(err) }()
+
+	query := `SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+	          FROM api_keys
+			  WHERE user_id = $1
+			  ORDER BY created_at DESC, id DESC`
+	rows, err := p.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*tokens.APIKey{}
+	for rows.Next() {
+		key := &tokens.APIKey{UserID: userID}
+		var scopes string
+		err = rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes one of the user's keys. It returns ErrNotFound when
+// the user has no key with that id.
+func (p *PostgresAPIKeyStore) DeleteAPIKey(ctx context.Context, userID int, id int64) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresAPIKeyStore.DeleteAPIKey")
+	defer func() { end(err) }()
+
+	result, err := p.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("api key")
+	}
+	return nil
+}
+
+// GetUserForAPIKey resolves an API key to its owner. It returns ErrNotFound
+// when the key is unknown or expired. Each successful lookup records the
+// time of use.
+func (p *PostgresAPIKeyStore) GetUserForAPIKey(ctx context.Context, plaintext string) (_ *User, _ *tokens.APIKey, err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresAPIKeyStore.GetUserForAPIKey")
+	defer func() { end(err) }()
+
+	hash := tokens.HashPlaintext(plaintext)
+	query := `UPDATE api_keys AS k
+	          SET last_used_at = CURRENT_TIMESTAMP
+			  FROM users AS u
+			  WHERE k.user_id = u.id AND k.hash = $1 AND (k.expires_at IS NULL OR k.expires_at > $2)
+			  RETURNING ` + userColumns + `, k.id, k.name, k.prefix, k.scopes, k.expires_at, k.last_used_at, k.created_at`
+	key := &tokens.APIKey{Hash: hash}
+	var scopes string
+	user, err := scanUser(p.db.QueryRowContext(ctx, query, hash, time.Now()),
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, notFound("api key")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key.UserID = user.ID
+	key.Scopes = strings.Fields(scopes)
+	return user, key, nil
+}
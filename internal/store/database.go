@@ -1,20 +1,56 @@
 package store
 
 import (
+	"cmp"
+	"context"
 	"database/sql"
 	"fmt"
 	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
+	"github.com/syafae/femProject/internal/config"
 )
 
-func Open() (*sql.DB, error) {
-	db, err := sql.Open("pgx", "host=localhost user=postgres password= postgres dbname=postgres port= 5432 sslmode=disable")
+// logger receives the store's own log records, such as migration progress.
+var logger = slog.Default()
+
+// SetLogger replaces the store logger. It must be called before the stores
+// are used.
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// gooseLogger forwards goose output to the store logger.
+type gooseLogger struct{}
+
+func (gooseLogger) Printf(format string, v ...any) {
+	logger.Info(strings.TrimSpace(fmt.Sprintf(format, v...)), "component", "goose")
+}
+
+func (gooseLogger) Fatalf(format string, v ...any) {
+	logger.Error(strings.TrimSpace(fmt.Sprintf(format, v...)), "component", "goose")
+	os.Exit(1)
+}
+
+func Open(cfg config.DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", cfg.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("db: open %w", err)
 	}
-	fmt.Println("Connected to the database")
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	logger.Info("opened database pool", "max_open_conns", cfg.MaxOpenConns, "max_idle_conns", cfg.MaxIdleConns)
 	return db, nil
 }
 
@@ -26,12 +62,159 @@ func MigrateFS(db *sql.DB, MigrationFS fs.FS, dir string) error {
 	return Migrate(db, dir)
 }
 
+// RunMigrationsFS runs the goose command up, down or redo with the
+// migrations in migrationFS.
+func RunMigrationsFS(ctx context.Context, db *sql.DB, migrationFS fs.FS, dir, command string) error {
+	switch command {
+	case "up", "down", "redo":
+	default:
+		return fmt.Errorf("db: unknown migration command %q", command)
+	}
+	goose.SetBaseFS(migrationFS)
+	defer goose.SetBaseFS(nil)
+	goose.SetDialect(gooseDialect(db))
+	goose.SetLogger(gooseLogger{})
+	if err := goose.RunContext(ctx, command, db, dir); err != nil {
+		return fmt.Errorf("db: migrate %s %w", command, err)
+	}
+	return nil
+}
+
 func Migrate(db *sql.DB, dir string) error {
-	goose.SetDialect("postgres")
+	goose.SetDialect(gooseDialect(db))
+	goose.SetLogger(gooseLogger{})
 	err := goose.Up(db, dir)
 	if err != nil {
 		return fmt.Errorf("db: migrate %w", err)
 	}
-	fmt.Println("Migrated the database")
+	logger.Info("migrated the database")
 	return nil
 }
+
+// MigrationVersions returns the goose version applied to db and the latest
+// version found in migrationFS, so callers can tell whether the schema is
+// behind the binary.
+func MigrationVersions(ctx context.Context, db *sql.DB, migrationFS fs.FS, dir string) (int64, int64, error) {
+	names, err := fs.Glob(migrationFS, path.Join(dir, "*.sql"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("db: list migrations %w", err)
+	}
+	var latest int64
+	for _, name := range names {
+		version, err := goose.NumericComponent(name)
+		if err != nil {
+			return 0, 0, fmt.Errorf("db: migration %s %w", name, err)
+		}
+		latest = max(latest, version)
+	}
+
+	goose.SetDialect(gooseDialect(db))
+	current, err := goose.GetDBVersionContext(ctx, db)
+	if err != nil {
+		return 0, 0, fmt.Errorf("db: migration version %w", err)
+	}
+	return current, latest, nil
+}
+
+// MigrationStatus is a migration embedded in the binary and when it was
+// applied, nil while it is pending.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// MigrationStatuses lists the migrations in migrationFS by version.
+func MigrationStatuses(ctx context.Context, db *sql.DB, migrationFS fs.FS, dir string) ([]MigrationStatus, error) {
+	names, err := fs.Glob(migrationFS, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("db: list migrations %w", err)
+	}
+
+	goose.SetDialect(gooseDialect(db))
+	if _, err := goose.EnsureDBVersionContext(ctx, db); err != nil {
+		return nil, fmt.Errorf("db: migration version %w", err)
+	}
+	// goose deletes the row of a migration when it is rolled back
+	rows, err := db.QueryContext(ctx, `SELECT version_id, tstamp FROM `+goose.TableName()+` WHERE version_id > 0 AND is_applied`)
+	if err != nil {
+		return nil, fmt.Errorf("db: applied migrations %w", err)
+	}
+	defer rows.Close()
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(names))
+	for _, name := range names {
+		version, err := goose.NumericComponent(name)
+		if err != nil {
+			return nil, fmt.Errorf("db: migration %s %w", name, err)
+		}
+		status := MigrationStatus{Version: version, Name: path.Base(name)}
+		if appliedAt, ok := applied[version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return statuses, nil
+}
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+const migrationTemplate = `-- +goose Up
+-- +goose StatementBegin
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+-- +goose StatementEnd
+`
+
+// CreateMigration writes an empty migration called name to dir, numbered
+// after the last one there, and returns its path.
+func CreateMigration(dir, name string) (string, error) {
+	if !migrationName.MatchString(name) {
+		return "", fmt.Errorf("db: migration name must be lowercase letters, digits and underscores, got %q", name)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("db: migrations directory %w", err)
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return "", fmt.Errorf("db: list migrations %w", err)
+	}
+	var latest int64
+	for _, name := range names {
+		version, err := goose.NumericComponent(name)
+		if err != nil {
+			return "", fmt.Errorf("db: migration %s %w", name, err)
+		}
+		latest = max(latest, version)
+	}
+
+	file := filepath.Join(dir, fmt.Sprintf("%04d_%s.sql", latest+1, name))
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("db: create migration %w", err)
+	}
+	if _, err := f.WriteString(migrationTemplate); err != nil {
+		f.Close()
+		return "", fmt.Errorf("db: create migration %w", err)
+	}
+	return file, f.Close()
+}
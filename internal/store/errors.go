@@ -0,0 +1,98 @@
+package store
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Errors returned by every store implementation. Callers match them with
+// errors.Is; the typed errors below carry details and match these as well.
+var (
+	// ErrNotFound means the row asked for, or the row to be changed or
+	// deleted, does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means a write collided with an existing row, such as a
+	// taken username.
+	ErrConflict = errors.New("already exists")
+	// ErrForbidden means the row exists but the caller may not act on it.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// NotFoundError names what was not found. It matches ErrNotFound.
+type NotFoundError struct {
+	Resource string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " not found"
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func notFound(resource string) error {
+	return &NotFoundError{Resource: resource}
+}
+
+// ConflictError names the field whose value is already taken. It matches
+// ErrConflict and wraps the driver error.
+type ConflictError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConflictError) Error() string {
+	if e.Field == "" {
+		return "resource already exists"
+	}
+	return e.Field + " is already taken"
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// pgUniqueViolation is the PostgreSQL SQLSTATE for unique_violation.
+const pgUniqueViolation = "23505"
+
+// uniqueFields maps unique constraints to the field they protect, as named
+// in requests. SQLite names the constrained column instead, or the index
+// when it is on an expression.
+var uniqueFields = map[string]string{
+	"users_username_key":          "username",
+	"users_email_key":             "email",
+	"users.username":              "username",
+	"users.email":                 "email",
+	"idx_exercises_user_name":     "name",
+	"idx_exercises_built_in_name": "name",
+}
+
+// conflictError turns unique violations into a ConflictError and returns
+// any other error unchanged.
+func conflictError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return &ConflictError{Field: uniqueFields[pgErr.ConstraintName], Err: err}
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		// the message ends in "UNIQUE constraint failed: users.email (2067)"
+		// or, for an index on an expression, in "... failed: index 'name' (2067)"
+		_, columns, _ := strings.Cut(sqliteErr.Error(), "UNIQUE constraint failed: ")
+		if index, ok := strings.CutPrefix(columns, "index '"); ok {
+			columns, _, _ = strings.Cut(index, "'")
+		}
+		column, _, _ := strings.Cut(columns, " ")
+		return &ConflictError{Field: uniqueFields[column], Err: err}
+	}
+	return err
+}
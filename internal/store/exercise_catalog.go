@@ -0,0 +1,53 @@
+package store
+
+// builtInExercises is the catalog every backend starts with. The SQL
+// backends insert it in their exercises migration, so a change here needs a
+// migration for both that makes the same change; the store tests compare
+// the migrated catalog with this one.
+var builtInExercises = []Exercise{
+	{Name: "Back Squat", Aliases: []string{"Squat", "Squats", "Barbell Squat"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"quadriceps", "glutes"}, SecondaryMuscles: []string{"hamstrings", "core"}, Equipment: []string{"barbell", "rack"}, Measurement: MeasurementReps},
+	{Name: "Front Squat", Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"quadriceps"}, SecondaryMuscles: []string{"glutes", "core"}, Equipment: []string{"barbell", "rack"}, Measurement: MeasurementReps},
+	{Name: "Goblet Squat", Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"quadriceps", "glutes"}, SecondaryMuscles: []string{"core"}, Equipment: []string{"kettlebell"}, Measurement: MeasurementReps},
+	{Name: "Deadlift", Aliases: []string{"Conventional Deadlift", "Deadlifts"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"hamstrings", "glutes", "lower_back"}, SecondaryMuscles: []string{"quadriceps", "upper_back", "forearms"}, Equipment: []string{"barbell"}, Measurement: MeasurementReps},
+	{Name: "Romanian Deadlift", Aliases: []string{"RDL"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"hamstrings", "glutes"}, SecondaryMuscles: []string{"lower_back"}, Equipment: []string{"barbell"}, Measurement: MeasurementReps},
+	{Name: "Bench Press", Aliases: []string{"Barbell Bench Press", "Flat Bench"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"chest"}, SecondaryMuscles: []string{"triceps", "shoulders"}, Equipment: []string{"barbell", "bench"}, Measurement: MeasurementReps},
+	{Name: "Incline Bench Press", Aliases: []string{"Incline Press"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"chest", "shoulders"}, SecondaryMuscles: []string{"triceps"}, Equipment: []string{"barbell", "bench"}, Measurement: MeasurementReps},
+	{Name: "Dumbbell Bench Press", Aliases: []string{"DB Bench"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"chest"}, SecondaryMuscles: []string{"triceps", "shoulders"}, Equipment: []string{"dumbbell", "bench"}, Measurement: MeasurementReps},
+	{Name: "Overhead Press", Aliases: []string{"OHP", "Military Press", "Shoulder Press"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"shoulders"}, SecondaryMuscles: []string{"triceps", "upper_back", "core"}, Equipment: []string{"barbell"}, Measurement: MeasurementReps},
+	{Name: "Barbell Row", Aliases: []string{"Bent-Over Row", "Bent Over Row"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"upper_back", "lats"}, SecondaryMuscles: []string{"biceps", "lower_back"}, Equipment: []string{"barbell"}, Measurement: MeasurementReps},
+	{Name: "Dumbbell Row", Aliases: []string{"One-Arm Row"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"lats", "upper_back"}, SecondaryMuscles: []string{"biceps"}, Equipment: []string{"dumbbell", "bench"}, Measurement: MeasurementReps},
+	{Name: "Pull-up", Aliases: []string{"Pull-ups", "Pullup", "Pullups"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"lats"}, SecondaryMuscles: []string{"biceps", "upper_back"}, Equipment: []string{"pull_up_bar"}, Measurement: MeasurementReps},
+	{Name: "Chin-up", Aliases: []string{"Chin-ups", "Chinup"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"lats", "biceps"}, SecondaryMuscles: []string{"upper_back"}, Equipment: []string{"pull_up_bar"}, Measurement: MeasurementReps},
+	{Name: "Lat Pulldown", Aliases: []string{"Pulldown"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"lats"}, SecondaryMuscles: []string{"biceps", "upper_back"}, Equipment: []string{"cable"}, Measurement: MeasurementReps},
+	{Name: "Push-up", Aliases: []string{"Push-ups", "Pushup", "Pushups"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"chest"}, SecondaryMuscles: []string{"triceps", "shoulders", "core"}, Measurement: MeasurementReps},
+	{Name: "Dip", Aliases: []string{"Dips"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"chest", "triceps"}, SecondaryMuscles: []string{"shoulders"}, Equipment: []string{"dip_bars"}, Measurement: MeasurementReps},
+	{Name: "Lunge", Aliases: []string{"Lunges"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"quadriceps", "glutes"}, SecondaryMuscles: []string{"hamstrings"}, Equipment: []string{"dumbbell"}, Measurement: MeasurementReps},
+	{Name: "Bulgarian Split Squat", Aliases: []string{"Split Squat"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"quadriceps", "glutes"}, SecondaryMuscles: []string{"hamstrings"}, Equipment: []string{"dumbbell", "bench"}, Measurement: MeasurementReps},
+	{Name: "Hip Thrust", Aliases: []string{"Barbell Hip Thrust"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"glutes"}, SecondaryMuscles: []string{"hamstrings"}, Equipment: []string{"barbell", "bench"}, Measurement: MeasurementReps},
+	{Name: "Leg Press", Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"quadriceps", "glutes"}, SecondaryMuscles: []string{"hamstrings"}, Equipment: []string{"machine"}, Measurement: MeasurementReps},
+	{Name: "Leg Curl", Aliases: []string{"Hamstring Curl"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"hamstrings"}, SecondaryMuscles: []string{"calves"}, Equipment: []string{"machine"}, Measurement: MeasurementReps},
+	{Name: "Calf Raise", Aliases: []string{"Calf Raises"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"calves"}, Measurement: MeasurementReps},
+	{Name: "Dumbbell Curl", Aliases: []string{"Biceps Curl", "Bicep Curl"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"biceps"}, SecondaryMuscles: []string{"forearms"}, Equipment: []string{"dumbbell"}, Measurement: MeasurementReps},
+	{Name: "Triceps Pushdown", Aliases: []string{"Tricep Pushdown"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"triceps"}, Equipment: []string{"cable"}, Measurement: MeasurementReps},
+	{Name: "Lateral Raise", Aliases: []string{"Side Raise"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"shoulders"}, Equipment: []string{"dumbbell"}, Measurement: MeasurementReps},
+	{Name: "Face Pull", Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"shoulders", "upper_back"}, SecondaryMuscles: []string{"biceps"}, Equipment: []string{"cable"}, Measurement: MeasurementReps},
+	{Name: "Kettlebell Swing", Aliases: []string{"KB Swing"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"glutes", "hamstrings"}, SecondaryMuscles: []string{"core", "shoulders"}, Equipment: []string{"kettlebell"}, Measurement: MeasurementReps},
+	{Name: "Hanging Leg Raise", Aliases: []string{"Leg Raise"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"core"}, SecondaryMuscles: []string{"hip_flexors"}, Equipment: []string{"pull_up_bar"}, Measurement: MeasurementReps},
+	{Name: "Plank", Aliases: []string{"Planks", "Front Plank"}, Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"core"}, SecondaryMuscles: []string{"shoulders"}, Equipment: []string{"mat"}, Measurement: MeasurementDuration},
+	{Name: "Side Plank", Category: ExerciseCategoryStrength, PrimaryMuscles: []string{"obliques"}, SecondaryMuscles: []string{"core"}, Equipment: []string{"mat"}, Measurement: MeasurementDuration},
+	{Name: "Running", Aliases: []string{"Run", "Jogging"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"quadriceps", "hamstrings", "calves"}, SecondaryMuscles: []string{"glutes"}, Measurement: MeasurementDistance},
+	{Name: "Treadmill Run", Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"quadriceps", "hamstrings", "calves"}, SecondaryMuscles: []string{"glutes"}, Equipment: []string{"treadmill"}, Measurement: MeasurementDistance},
+	{Name: "Walking", Aliases: []string{"Walk"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"quadriceps", "calves"}, SecondaryMuscles: []string{"hamstrings", "glutes"}, Measurement: MeasurementDistance},
+	{Name: "Cycling", Aliases: []string{"Bike", "Biking"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"quadriceps"}, SecondaryMuscles: []string{"hamstrings", "glutes", "calves"}, Equipment: []string{"bike"}, Measurement: MeasurementDistance},
+	{Name: "Rowing", Aliases: []string{"Row", "Erg", "Rowing Machine"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"upper_back", "quadriceps"}, SecondaryMuscles: []string{"lats", "hamstrings", "biceps"}, Equipment: []string{"rower"}, Measurement: MeasurementDistance},
+	{Name: "Swimming", Aliases: []string{"Swim"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"lats", "shoulders"}, SecondaryMuscles: []string{"core"}, Measurement: MeasurementDistance},
+	{Name: "Jump Rope", Aliases: []string{"Skipping", "Skipping Rope"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"calves"}, SecondaryMuscles: []string{"shoulders"}, Equipment: []string{"jump_rope"}, Measurement: MeasurementDuration},
+	{Name: "Burpee", Aliases: []string{"Burpees"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"quadriceps", "chest"}, SecondaryMuscles: []string{"core", "shoulders"}, Measurement: MeasurementReps},
+	{Name: "Elliptical", Aliases: []string{"Cross Trainer"}, Category: ExerciseCategoryCardio, PrimaryMuscles: []string{"quadriceps"}, SecondaryMuscles: []string{"glutes"}, Equipment: []string{"machine"}, Measurement: MeasurementDuration},
+	{Name: "Hip Flexor Stretch", Aliases: []string{"Couch Stretch"}, Category: ExerciseCategoryMobility, PrimaryMuscles: []string{"hip_flexors"}, SecondaryMuscles: []string{"quadriceps"}, Equipment: []string{"mat"}, Measurement: MeasurementDuration},
+	{Name: "Hamstring Stretch", Category: ExerciseCategoryMobility, PrimaryMuscles: []string{"hamstrings"}, SecondaryMuscles: []string{"calves"}, Equipment: []string{"mat"}, Measurement: MeasurementDuration},
+	{Name: "Cat-Cow", Aliases: []string{"Cat Cow"}, Category: ExerciseCategoryMobility, PrimaryMuscles: []string{"lower_back"}, SecondaryMuscles: []string{"core"}, Equipment: []string{"mat"}, Measurement: MeasurementReps},
+	{Name: "World's Greatest Stretch", Category: ExerciseCategoryMobility, PrimaryMuscles: []string{"hip_flexors", "hamstrings"}, SecondaryMuscles: []string{"upper_back"}, Measurement: MeasurementReps},
+	{Name: "Band Pull-Apart", Aliases: []string{"Pull-Apart"}, Category: ExerciseCategoryMobility, PrimaryMuscles: []string{"upper_back", "shoulders"}, Equipment: []string{"band"}, Measurement: MeasurementReps},
+	{Name: "Foam Rolling", Aliases: []string{"Foam Roll"}, Category: ExerciseCategoryMobility, PrimaryMuscles: []string{"quadriceps", "hamstrings"}, SecondaryMuscles: []string{"upper_back", "calves"}, Equipment: []string{"foam_roller"}, Measurement: MeasurementDuration},
+}
@@ -0,0 +1,40 @@
+package store_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/syafae/femProject/internal/store"
+)
+
+// testCatalog fails when the built-in exercises of a migrated database
+// differ from store.BuiltInExercises, which the memory store serves. The
+// SQL migrations hold their own copy of the catalog.
+func testCatalog(t *testing.T, exercises store.ExerciseStore) {
+	// user 0 does not exist, so only the built-in exercises are visible
+	got, err := exercises.ListExercises(t.Context(), store.ExerciseFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*store.Exercise, len(got))
+	for _, e := range got {
+		byName[e.Name] = e
+	}
+
+	for _, want := range store.BuiltInExercises {
+		e := byName[want.Name]
+		if e == nil {
+			t.Errorf("%s is missing from the database", want.Name)
+			continue
+		}
+		delete(byName, want.Name)
+		if e.UserID != nil || e.Category != want.Category || e.Measurement != want.Measurement ||
+			!slices.Equal(e.Aliases, want.Aliases) || !slices.Equal(e.PrimaryMuscles, want.PrimaryMuscles) ||
+			!slices.Equal(e.SecondaryMuscles, want.SecondaryMuscles) || !slices.Equal(e.Equipment, want.Equipment) {
+			t.Errorf("%s is %+v in the database, want %+v", want.Name, e, want)
+		}
+	}
+	for name := range byName {
+		t.Errorf("%s is in the database but not in the catalog", name)
+	}
+}
@@ -0,0 +1,331 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Exercise is an entry of the exercise catalog. Built-in exercises have no
+// UserID and are visible to everyone; custom exercises are private to the
+// user who created them.
+type Exercise struct {
+	ID               int       `json:"id"`
+	UserID           *int      `json:"user_id"`
+	Name             string    `json:"name"`
+	Aliases          []string  `json:"aliases"`
+	Category         string    `json:"category"`
+	PrimaryMuscles   []string  `json:"primary_muscles"`
+	SecondaryMuscles []string  `json:"secondary_muscles"`
+	Equipment        []string  `json:"equipment"`
+	Measurement      string    `json:"measurement"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Measures reports whether entry is logged the way e is measured.
+func (e *Exercise) Measures(entry *WorkoutEntry) bool {
+	switch e.Measurement {
+	case MeasurementReps:
+		return entry.Reps != nil
+	case MeasurementDuration:
+		return entry.DurationSeconds != nil
+	case MeasurementDistance:
+		return entry.DistanceMeters != nil
+	default:
+		return false
+	}
+}
+
+const (
+	ExerciseCategoryStrength = "strength"
+	ExerciseCategoryCardio   = "cardio"
+	ExerciseCategoryMobility = "mobility"
+
+	// MeasurementReps exercises are logged in reps, MeasurementDuration
+	// ones in duration_seconds and MeasurementDistance ones in
+	// distance_meters, optionally with a duration.
+	MeasurementReps     = "reps"
+	MeasurementDuration = "duration"
+	MeasurementDistance = "distance"
+)
+
+// The vocabularies of the catalog. Muscles and equipment are stored space
+// separated, so their values never contain spaces.
+var (
+	ExerciseCategories = []string{ExerciseCategoryStrength, ExerciseCategoryCardio, ExerciseCategoryMobility}
+	Measurements       = []string{MeasurementReps, MeasurementDuration, MeasurementDistance}
+	MuscleGroups       = []string{
+		"chest", "upper_back", "lats", "lower_back", "shoulders", "biceps", "triceps", "forearms",
+		"core", "obliques", "glutes", "quadriceps", "hamstrings", "calves", "hip_flexors",
+	}
+	Equipment = []string{
+		"barbell", "dumbbell", "kettlebell", "bench", "rack", "pull_up_bar", "dip_bars", "cable",
+		"machine", "band", "bike", "rower", "treadmill", "jump_rope", "mat", "foam_roller",
+	}
+)
+
+// ExerciseStore only hands out exercises the given user can see: the
+// built-in ones and their own. Any other exercise is reported with
+// ErrNotFound like a missing one.
+type ExerciseStore interface {
+	ListExercises(ctx context.Context, filter ExerciseFilter) ([]*Exercise, error)
+	GetExercise(ctx context.Context, userID int, id int64) (*Exercise, error)
+	FindExercise(ctx context.Context, userID int, name string) (*Exercise, error)
+	CreateExercise(ctx context.Context, exercise *Exercise) error
+}
+
+// ExerciseFilter narrows ListExercises to the exercises visible to UserID.
+// Zero values mean "no filter"; Query matches names and aliases.
+type ExerciseFilter struct {
+	UserID   int
+	Query    string
+	Category string
+	Muscle   string
+}
+
+type postgresExerciseStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewPostgresExerciseStore(db *sql.DB, timeout time.Duration) *postgresExerciseStore {
+	return &postgresExerciseStore{db: db, timeout: timeout}
+}
+
+func (pg *postgresExerciseStore) ListExercises(ctx context.Context, filter ExerciseFilter) (_ []*Exercise, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresExerciseStore.ListExercises")
+	defer func() { end(err) }()
+
+	return listExercises(ctx, pg.db, filter, "ILIKE")
+}
+
+func (pg *postgresExerciseStore) GetExercise(ctx context.Context, userID int, id int64) (_ *Exercise, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresExerciseStore.GetExercise")
+	defer func() { end(err) }()
+
+	return getExercise(ctx, pg.db, userID, id)
+}
+
+func (pg *postgresExerciseStore) FindExercise(ctx context.Context, userID int, name string) (_ *Exercise, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresExerciseStore.FindExercise")
+	defer func() { end(err) }()
+
+	return findExercise(ctx, pg.db, userID, name)
+}
+
+func (pg *postgresExerciseStore) CreateExercise(ctx context.Context, exercise *Exercise) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresExerciseStore.CreateExercise")
+	defer func() { end(err) }()
+
+	return createExercise(ctx, pg.db, exercise, time.Now())
+}
+
+const exerciseColumns = `e.id, e.user_id, e.name, e.category, e.primary_muscles, e.secondary_muscles, e.equipment, e.measurement, e.created_at`
+
+// visibleExercise is the condition on an exercises row e for being visible
+// to the user bound to param.
+func visibleExercise(param string) string {
+	return "(e.user_id IS NULL OR e.user_id = " + param + ")"
+}
+
+func scanExercise(row rowScanner) (*Exercise, error) {
+	exercise := &Exercise{Aliases: []string{}}
+	var userID sql.NullInt64
+	var primary, secondary, equipment string
+	err := row.Scan(&exercise.ID, &userID, &exercise.Name, &exercise.Category, &primary, &secondary, &equipment,
+		&exercise.Measurement, &exercise.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		exercise.UserID = &id
+	}
+	exercise.PrimaryMuscles = strings.Fields(primary)
+	exercise.SecondaryMuscles = strings.Fields(secondary)
+	exercise.Equipment = strings.Fields(equipment)
+	return exercise, nil
+}
+
+// listExercises implements ListExercises for the SQL stores, which only
+// differ in the operator for case-insensitive matches.
+func listExercises(ctx context.Context, db *sql.DB, filter ExerciseFilter, ilike string) ([]*Exercise, error) {
+	var args []any
+	addArg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{visibleExercise(addArg(filter.UserID))}
+	if filter.Query != "" {
+		pattern := addArg(containsPattern(filter.Query)) + likeEscape
+		conditions = append(conditions, `(e.name `+ilike+` `+pattern+` OR EXISTS (SELECT 1 FROM exercise_aliases a
+			WHERE a.exercise_id = e.id AND a.alias `+ilike+` `+pattern+`))`)
+	}
+	if filter.Category != "" {
+		conditions = append(conditions, "e.category = "+addArg(filter.Category))
+	}
+	if filter.Muscle != "" {
+		conditions = append(conditions, "(' ' || e.primary_muscles || ' ' || e.secondary_muscles || ' ') LIKE "+addArg(containsPattern(" "+filter.Muscle+" "))+likeEscape)
+	}
+
+	query := `SELECT ` + exerciseColumns + `
+		FROM exercises AS e
+		WHERE ` + strings.Join(conditions, " AND ")
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []*Exercise{}
+	for rows.Next() {
+		exercise, err := scanExercise(rows)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, exercise)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sortExercises(exercises)
+	return exercises, loadExerciseAliases(ctx, db, exercises)
+}
+
+// sortExercises orders exercises by name, ignoring case. It is done here
+// rather than in SQL so that the collation of the database does not change
+// the order.
+func sortExercises(exercises []*Exercise) {
+	slices.SortFunc(exercises, func(a, b *Exercise) int {
+		return cmp.Or(strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+// loadExerciseAliases fills in the aliases of exercises in one query.
+func loadExerciseAliases(ctx context.Context, db *sql.DB, exercises []*Exercise) error {
+	if len(exercises) == 0 {
+		return nil
+	}
+	byID := make(map[int]*Exercise, len(exercises))
+	params := make([]string, len(exercises))
+	args := make([]any, len(exercises))
+	for i, exercise := range exercises {
+		byID[exercise.ID] = exercise
+		params[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = exercise.ID
+	}
+
+	query := `SELECT exercise_id, alias
+		FROM exercise_aliases
+		WHERE exercise_id IN (` + strings.Join(params, ", ") + `)
+		ORDER BY exercise_id, order_index`
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var alias string
+		if err := rows.Scan(&id, &alias); err != nil {
+			return err
+		}
+		byID[id].Aliases = append(byID[id].Aliases, alias)
+	}
+	return rows.Err()
+}
+
+func getExercise(ctx context.Context, db *sql.DB, userID int, id int64) (*Exercise, error) {
+	query := `SELECT ` + exerciseColumns + `
+		FROM exercises AS e
+		WHERE e.id = $1 AND ` + visibleExercise("$2")
+	exercise, err := scanExercise(db.QueryRowContext(ctx, query, id, userID))
+	if err == sql.ErrNoRows {
+		return nil, notFound("exercise")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exercise, loadExerciseAliases(ctx, db, []*Exercise{exercise})
+}
+
+// findExercise looks up the exercise a user means by name, ignoring case.
+// A name beats an alias, and the user's own exercise beats a built-in one.
+func findExercise(ctx context.Context, db *sql.DB, userID int, name string) (*Exercise, error) {
+	query := `SELECT ` + exerciseColumns + `
+		FROM exercises AS e
+		WHERE ` + visibleExercise("$1") + `
+		  AND (lower(e.name) = lower($2) OR EXISTS (SELECT 1 FROM exercise_aliases a
+		       WHERE a.exercise_id = e.id AND lower(a.alias) = lower($2)))
+		ORDER BY lower(e.name) = lower($2) DESC, e.user_id IS NULL, e.id
+		LIMIT 1`
+	exercise, err := scanExercise(db.QueryRowContext(ctx, query, userID, strings.TrimSpace(name)))
+	if err == sql.ErrNoRows {
+		return nil, notFound("exercise")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return exercise, loadExerciseAliases(ctx, db, []*Exercise{exercise})
+}
+
+// createExercise inserts a custom exercise with its aliases, binding
+// createdAt as the creation time. Its name may not be taken by a built-in
+// exercise or another exercise of the user.
+func createExercise(ctx context.Context, db *sql.DB, exercise *Exercise, createdAt any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// built-in exercises are only added by migrations, so checking first
+	// cannot race with another insert
+	var builtIn bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM exercises WHERE user_id IS NULL AND lower(name) = lower($1))`,
+		exercise.Name).Scan(&builtIn)
+	if err != nil {
+		return err
+	}
+	if builtIn {
+		return &ConflictError{Field: "name"}
+	}
+
+	query := `INSERT INTO exercises (user_id, name, category, primary_muscles, secondary_muscles, equipment, measurement, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			  RETURNING id, created_at`
+	err = tx.QueryRowContext(ctx, query, exercise.UserID, exercise.Name, exercise.Category, strings.Join(exercise.PrimaryMuscles, " "),
+		strings.Join(exercise.SecondaryMuscles, " "), strings.Join(exercise.Equipment, " "), exercise.Measurement, createdAt).
+		Scan(&exercise.ID, &exercise.CreatedAt)
+	if err != nil {
+		return conflictError(err)
+	}
+	for i, alias := range exercise.Aliases {
+		_, err = tx.ExecContext(ctx, `INSERT INTO exercise_aliases (exercise_id, order_index, alias) VALUES ($1, $2, $3)`,
+			exercise.ID, i, alias)
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	setEmptyLists(exercise)
+	return nil
+}
+
+// setEmptyLists replaces the nil lists of exercise with empty ones, so a
+// created exercise looks like one read back.
+func setEmptyLists(exercise *Exercise) {
+	for _, list := range []*[]string{&exercise.Aliases, &exercise.PrimaryMuscles, &exercise.SecondaryMuscles, &exercise.Equipment} {
+		if *list == nil {
+			*list = []string{}
+		}
+	}
+}
@@ -0,0 +1,4 @@
+package store
+
+// BuiltInExercises is the catalog the migrations must insert.
+var BuiltInExercises = builtInExercises
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/syafae/femProject/internal/metrics"
+)
+
+// instrumentedWorkoutStore records the latency of every call to the
+// wrapped WorkoutStore.
+type instrumentedWorkoutStore struct {
+	next    WorkoutStore
+	metrics metrics.Metrics
+}
+
+func NewInstrumentedWorkoutStore(next WorkoutStore, m metrics.Metrics) WorkoutStore {
+	return &instrumentedWorkoutStore{next: next, metrics: m}
+}
+
+func (s *instrumentedWorkoutStore) observe(method string, start time.Time, err error) {
+	// a missing workout is an answer, not a failed query
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	s.metrics.ObserveStoreQuery("workouts", method, time.Since(start), err)
+}
+
+func (s *instrumentedWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (*Workout, error) {
+	start := time.Now()
+	workout, err := s.next.GetWorkoutByID(ctx, id)
+	s.observe("GetWorkoutByID", start, err)
+	return workout, err
+}
+
+func (s *instrumentedWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error) {
+	start := time.Now()
+	created, err := s.next.CreateWorkout(ctx, workout)
+	s.observe("CreateWorkout", start, err)
+	return created, err
+}
+
+func (s *instrumentedWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout) error {
+	start := time.Now()
+	err := s.next.UpdateWorkout(ctx, workout)
+	s.observe("UpdateWorkout", start, err)
+	return err
+}
+
+func (s *instrumentedWorkoutStore) DeleteWorkout(ctx context.Context, id int64) error {
+	start := time.Now()
+	err := s.next.DeleteWorkout(ctx, id)
+	s.observe("DeleteWorkout", start, err)
+	return err
+}
+
+func (s *instrumentedWorkoutStore) GetWorkoutOwnerID(ctx context.Context, id int64) (int, error) {
+	start := time.Now()
+	ownerID, err := s.next.GetWorkoutOwnerID(ctx, id)
+	s.observe("GetWorkoutOwnerID", start, err)
+	return ownerID, err
+}
+
+func (s *instrumentedWorkoutStore) ListWorkouts(ctx context.Context, filter WorkoutFilter) ([]*Workout, string, error) {
+	start := time.Now()
+	workouts, cursor, err := s.next.ListWorkouts(ctx, filter)
+	s.observe("ListWorkouts", start, err)
+	return workouts, cursor, err
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Reasons recorded for failed logins.
+const (
+	LoginFailureUnknownUser     = "unknown_user"
+	LoginFailureInvalidPassword = "invalid_password"
+	LoginFailureInvalidTOTP     = "invalid_totp"
+	LoginFailureLockedOut       = "locked_out"
+)
+
+// FailedLogin is an audit record of a rejected login attempt. UserID is nil
+// when the username did not match any account.
+type FailedLogin struct {
+	ID        int64     `json:"id"`
+	UserName  string    `json:"username"`
+	UserID    *int      `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginAuditStore interface {
+	RecordFailedLogin(ctx context.Context, attempt *FailedLogin) error
+}
+
+type PostgresLoginAuditStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewPostgresLoginAuditStore(db *sql.DB, timeout time.Duration) *PostgresLoginAuditStore {
+	return &PostgresLoginAuditStore{db: db, timeout: timeout}
+}
+
+func (p *PostgresLoginAuditStore) RecordFailedLogin(ctx context.Context, attempt *FailedLogin) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresLoginAuditStore.RecordFailedLogin")
+	defer func() { end(err) }()
+
+	query := `INSERT INTO failed_logins (username, user_id, ip, user_agent, reason)
+	          VALUES ($1, $2, $3, $4, $5)
+			  RETURNING id, created_at`
+	return p.db.QueryRowContext(ctx, query, attempt.UserName, attempt.UserID, attempt.IP, attempt.UserAgent, attempt.Reason).
+		Scan(&attempt.ID, &attempt.CreatedAt)
+}
@@ -0,0 +1,20 @@
+package store_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/syafae/femProject/internal/store"
+)
+
+// queryTimeout bounds the calls of the SQL stores under test.
+const queryTimeout = 5 * time.Second
+
+func TestMain(m *testing.M) {
+	// the conformance checks hash many passwords
+	store.SetBcryptCost(bcrypt.MinCost)
+	os.Exit(m.Run())
+}
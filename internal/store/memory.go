@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+// MemoryDB holds the rows of the in-memory stores. Stores created from the
+// same MemoryDB share its data the way the Postgres stores share a database.
+// A single mutex guards everything, so every store call is atomic. Nothing
+// survives a restart; it is meant for tests and demos.
+type MemoryDB struct {
+	mu  sync.Mutex
+	seq map[string]int64
+
+	users        map[int]*memoryUser
+	workouts     map[int]*Workout
+	exercises    map[int]*Exercise
+	tokens       map[string]*tokens.Token
+	apiKeys      map[int64]*tokens.APIKey
+	failedLogins []*FailedLogin
+}
+
+// memoryUser is a users row together with the two-factor columns and the
+// user's recovery codes.
+type memoryUser struct {
+	user          User
+	totpSecret    []byte
+	totpLastStep  *int64
+	recoveryCodes []memoryRecoveryCode
+}
+
+type memoryRecoveryCode struct {
+	hash []byte
+	used bool
+}
+
+// NewMemoryDB returns an empty database apart from the built-in exercise
+// catalog, which the SQL stores get from their migrations.
+func NewMemoryDB() *MemoryDB {
+	db := &MemoryDB{
+		seq:       make(map[string]int64),
+		users:     make(map[int]*memoryUser),
+		workouts:  make(map[int]*Workout),
+		exercises: make(map[int]*Exercise),
+		tokens:    make(map[string]*tokens.Token),
+		apiKeys:   make(map[int64]*tokens.APIKey),
+	}
+	now := db.now()
+	for _, exercise := range builtInExercises {
+		row := copyExercise(&exercise)
+		row.ID = int(db.nextID("exercises"))
+		row.CreatedAt = now
+		db.exercises[row.ID] = row
+	}
+	return db
+}
+
+// lock starts a store call. Like a database, it refuses to start when ctx is
+// already done. The caller must unlock db.mu.
+func (db *MemoryDB) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	return nil
+}
+
+// nextID returns the next value of a table's serial column.
+func (db *MemoryDB) nextID(table string) int64 {
+	db.seq[table]++
+	return db.seq[table]
+}
+
+// now returns the current time at the microsecond precision Postgres stores,
+// so both backends hand out the same timestamps.
+func (db *MemoryDB) now() time.Time {
+	return dbTime(time.Now())
+}
+
+// dbTime rounds t like a TIMESTAMP WITH TIME ZONE column and drops the
+// monotonic clock reading.
+func dbTime(t time.Time) time.Time {
+	return t.Round(time.Microsecond)
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func copyPointer[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func copyToken(t *tokens.Token) *tokens.Token {
+	c := *t
+	c.Hash = slices.Clone(t.Hash)
+	c.UsedAt = copyTime(t.UsedAt)
+	c.LastUsedAt = copyTime(t.LastUsedAt)
+	return &c
+}
+
+func copyAPIKey(k *tokens.APIKey) *tokens.APIKey {
+	c := *k
+	c.Hash = slices.Clone(k.Hash)
+	c.Scopes = slices.Clone(k.Scopes)
+	c.ExpiresAt = copyTime(k.ExpiresAt)
+	c.LastUsedAt = copyTime(k.LastUsedAt)
+	return &c
+}
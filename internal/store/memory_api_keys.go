@@ -0,0 +1,107 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+type MemoryAPIKeyStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryAPIKeyStore(db *MemoryDB) *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{db: db}
+}
+
+func (m *MemoryAPIKeyStore) CreateAPIKey(ctx context.Context, key *tokens.APIKey) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[key.UserID]; !ok {
+		return errUnknownUser
+	}
+	for _, row := range m.db.apiKeys {
+		if row.Prefix == key.Prefix || bytes.Equal(row.Hash, key.Hash) {
+			return &ConflictError{}
+		}
+	}
+	key.ID = m.db.nextID("api_keys")
+	key.CreatedAt = m.db.now()
+	row := copyAPIKey(key)
+	row.Plaintext = ""
+	row.LastUsedAt = nil
+	m.db.apiKeys[key.ID] = row
+	return nil
+}
+
+func (m *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context, userID int) ([]*tokens.APIKey, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	keys := []*tokens.APIKey{}
+	for _, row := range m.db.apiKeys {
+		if row.UserID == userID {
+			key := copyAPIKey(row)
+			key.Hash = nil
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b *tokens.APIKey) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return keys, nil
+}
+
+// DeleteAPIKey revokes one of the user's keys. It returns ErrNotFound when
+// the user has no key with that id.
+func (m *MemoryAPIKeyStore) DeleteAPIKey(ctx context.Context, userID int, id int64) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.apiKeys[id]
+	if !ok || row.UserID != userID {
+		return notFound("api key")
+	}
+	delete(m.db.apiKeys, id)
+	return nil
+}
+
+// GetUserForAPIKey resolves an API key to its owner. It returns ErrNotFound
+// when the key is unknown or expired. Each successful lookup records the
+// time of use.
+func (m *MemoryAPIKeyStore) GetUserForAPIKey(ctx context.Context, plaintext string) (*User, *tokens.APIKey, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	hash := tokens.HashPlaintext(plaintext)
+	now := time.Now()
+	for _, row := range m.db.apiKeys {
+		if !bytes.Equal(row.Hash, hash) || (row.ExpiresAt != nil && !row.ExpiresAt.After(now)) {
+			continue
+		}
+		user, ok := m.db.users[row.UserID]
+		if !ok {
+			break
+		}
+		usedAt := m.db.now()
+		row.LastUsedAt = &usedAt
+		return user.userRow(), copyAPIKey(row), nil
+	}
+	return nil, nil, notFound("api key")
+}
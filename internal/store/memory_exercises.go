@@ -0,0 +1,139 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+)
+
+type memoryExerciseStore struct {
+	db *MemoryDB
+}
+
+// NewMemoryExerciseStore returns an exercise store keeping its rows in db.
+func NewMemoryExerciseStore(db *MemoryDB) *memoryExerciseStore {
+	return &memoryExerciseStore{db: db}
+}
+
+// copyExercise returns a copy of e whose lists are never nil, like the rows
+// the SQL stores scan.
+func copyExercise(e *Exercise) *Exercise {
+	c := *e
+	c.UserID = copyPointer(e.UserID)
+	c.Aliases = append([]string{}, e.Aliases...)
+	c.PrimaryMuscles = append([]string{}, e.PrimaryMuscles...)
+	c.SecondaryMuscles = append([]string{}, e.SecondaryMuscles...)
+	c.Equipment = append([]string{}, e.Equipment...)
+	return &c
+}
+
+func visibleTo(e *Exercise, userID int) bool {
+	return e.UserID == nil || *e.UserID == userID
+}
+
+func (m *memoryExerciseStore) matches(e *Exercise, filter ExerciseFilter) bool {
+	switch {
+	case !visibleTo(e, filter.UserID):
+		return false
+	case filter.Query != "" && !containsFold(e.Name, filter.Query) && !slices.ContainsFunc(e.Aliases, func(alias string) bool {
+		return containsFold(alias, filter.Query)
+	}):
+		return false
+	case filter.Category != "" && e.Category != filter.Category:
+		return false
+	case filter.Muscle != "" && !slices.Contains(e.PrimaryMuscles, filter.Muscle) && !slices.Contains(e.SecondaryMuscles, filter.Muscle):
+		return false
+	}
+	return true
+}
+
+func (m *memoryExerciseStore) ListExercises(ctx context.Context, filter ExerciseFilter) ([]*Exercise, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	exercises := []*Exercise{}
+	for _, row := range m.db.exercises {
+		if m.matches(row, filter) {
+			exercises = append(exercises, copyExercise(row))
+		}
+	}
+	sortExercises(exercises)
+	return exercises, nil
+}
+
+func (m *memoryExerciseStore) GetExercise(ctx context.Context, userID int, id int64) (*Exercise, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.exercises[int(id)]
+	if !ok || !visibleTo(row, userID) {
+		return nil, notFound("exercise")
+	}
+	return copyExercise(row), nil
+}
+
+// FindExercise looks up the exercise a user means by name, ignoring case.
+// A name beats an alias, and the user's own exercise beats a built-in one.
+func (m *memoryExerciseStore) FindExercise(ctx context.Context, userID int, name string) (*Exercise, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	name = strings.TrimSpace(name)
+	// rank orders candidates like the ORDER BY of the SQL stores
+	rank := func(e *Exercise) int {
+		r := 0
+		if !strings.EqualFold(e.Name, name) {
+			r += 2
+		}
+		if e.UserID == nil {
+			r++
+		}
+		return r
+	}
+	var found *Exercise
+	for _, row := range m.db.exercises {
+		if !visibleTo(row, userID) {
+			continue
+		}
+		if !strings.EqualFold(row.Name, name) && !slices.ContainsFunc(row.Aliases, func(alias string) bool {
+			return strings.EqualFold(alias, name)
+		}) {
+			continue
+		}
+		if found == nil || cmp.Or(cmp.Compare(rank(row), rank(found)), cmp.Compare(row.ID, found.ID)) < 0 {
+			found = row
+		}
+	}
+	if found == nil {
+		return nil, notFound("exercise")
+	}
+	return copyExercise(found), nil
+}
+
+func (m *memoryExerciseStore) CreateExercise(ctx context.Context, exercise *Exercise) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	if exercise.UserID == nil || m.db.users[*exercise.UserID] == nil {
+		return errUnknownUser
+	}
+	for _, row := range m.db.exercises {
+		if visibleTo(row, *exercise.UserID) && strings.EqualFold(row.Name, exercise.Name) {
+			return &ConflictError{Field: "name"}
+		}
+	}
+	exercise.ID = int(m.db.nextID("exercises"))
+	exercise.CreatedAt = m.db.now()
+	setEmptyLists(exercise)
+	m.db.exercises[exercise.ID] = copyExercise(exercise)
+	return nil
+}
@@ -0,0 +1,25 @@
+package store
+
+import "context"
+
+type MemoryLoginAuditStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryLoginAuditStore(db *MemoryDB) *MemoryLoginAuditStore {
+	return &MemoryLoginAuditStore{db: db}
+}
+
+func (m *MemoryLoginAuditStore) RecordFailedLogin(ctx context.Context, attempt *FailedLogin) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	attempt.ID = m.db.nextID("failed_logins")
+	attempt.CreatedAt = m.db.now()
+	row := *attempt
+	row.UserID = copyPointer(attempt.UserID)
+	m.db.failedLogins = append(m.db.failedLogins, &row)
+	return nil
+}
@@ -0,0 +1,20 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/store/storetest"
+)
+
+func TestMemoryStores(t *testing.T) {
+	db := store.NewMemoryDB()
+	storetest.Run(t, storetest.Stores{
+		Workouts:   store.NewMemoryWorkoutStore(db),
+		Users:      store.NewMemoryUserStore(db),
+		Tokens:     store.NewMemoryTokenStore(db),
+		Exercises:  store.NewMemoryExerciseStore(db),
+		APIKeys:    store.NewMemoryAPIKeyStore(db),
+		LoginAudit: store.NewMemoryLoginAuditStore(db),
+	})
+}
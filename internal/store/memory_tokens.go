@@ -0,0 +1,285 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+type MemoryTokenStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryTokenStore(db *MemoryDB) *MemoryTokenStore {
+	return &MemoryTokenStore{db: db}
+}
+
+// insertToken stores a copy of token the way the tokens table would: the
+// plaintext is dropped and the expiry is rounded to whole seconds.
+func (m *MemoryTokenStore) insertToken(token *tokens.Token) error {
+	if _, ok := m.db.users[token.UserID]; !ok {
+		return errUnknownUser
+	}
+	if _, ok := m.db.tokens[string(token.Hash)]; ok {
+		return &ConflictError{}
+	}
+	row := copyToken(token)
+	row.Plaintext = ""
+	row.ID = m.db.nextID("tokens")
+	row.Expiry = token.Expiry.Round(time.Second)
+	row.CreatedAt = m.db.now()
+	row.UsedAt, row.LastUsedAt = nil, nil
+	m.db.tokens[string(token.Hash)] = row
+	return nil
+}
+
+// deleteTokens removes every token matching fn and returns how many there
+// were.
+func (m *MemoryTokenStore) deleteTokens(fn func(*tokens.Token) bool) int64 {
+	var n int64
+	for hash, token := range m.db.tokens {
+		if fn(token) {
+			delete(m.db.tokens, hash)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *MemoryTokenStore) InsertToken(ctx context.Context, token *tokens.Token) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	return m.insertToken(token)
+}
+
+func (m *MemoryTokenStore) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = m.InsertToken(ctx, token)
+	return token, err
+}
+
+// CreateTokenPair starts a new token family for a fresh login and returns its
+// authentication and refresh tokens.
+func (m *MemoryTokenStore) CreateTokenPair(ctx context.Context, userID int, authTTL, refreshTTL time.Duration, client tokens.Client) (*tokens.Token, *tokens.Token, error) {
+	family, err := tokens.GenerateFamily()
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, refresh, err := generateTokenPair(userID, family, authTTL, refreshTTL, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := m.db.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	if err := m.insertToken(auth); err != nil {
+		return nil, nil, err
+	}
+	if err := m.insertToken(refresh); err != nil {
+		delete(m.db.tokens, string(auth.Hash))
+		return nil, nil, err
+	}
+	return auth, refresh, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair in the
+// same family, with the same reuse detection as the Postgres store.
+func (m *MemoryTokenStore) RotateRefreshToken(ctx context.Context, plaintext string, authTTL, refreshTTL time.Duration, client tokens.Client) (*tokens.Token, *tokens.Token, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	current, ok := m.db.tokens[string(tokens.HashPlaintext(plaintext))]
+	if !ok || current.Scope != tokens.ScopeRefresh {
+		return nil, nil, ErrInvalidToken
+	}
+	family := current.Family
+	if current.UsedAt != nil {
+		m.deleteTokens(func(t *tokens.Token) bool { return family != "" && t.Family == family })
+		return nil, nil, ErrTokenReused
+	}
+	if !current.Expiry.After(time.Now()) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	if client.DeviceLabel == "" {
+		client.DeviceLabel = current.DeviceLabel
+	}
+	auth, refresh, err := generateTokenPair(current.UserID, family, authTTL, refreshTTL, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usedAt := m.db.now()
+	current.UsedAt = &usedAt
+	m.deleteTokens(func(t *tokens.Token) bool {
+		return family != "" && t.Family == family && t.Scope == tokens.ScopeAuth
+	})
+	if err := m.insertToken(auth); err != nil {
+		return nil, nil, err
+	}
+	if err := m.insertToken(refresh); err != nil {
+		return nil, nil, err
+	}
+	return auth, refresh, nil
+}
+
+func (m *MemoryTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int, scope string) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	m.deleteTokens(func(t *tokens.Token) bool { return t.UserID == userID && t.Scope == scope })
+	return nil
+}
+
+func (m *MemoryTokenStore) DeleteToken(ctx context.Context, token *tokens.Token) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	delete(m.db.tokens, string(token.Hash))
+	return nil
+}
+
+func (m *MemoryTokenStore) DeleteTokenFamily(ctx context.Context, family string) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	// tokens without a family have a NULL family column, which never matches
+	m.deleteTokens(func(t *tokens.Token) bool { return family != "" && t.Family == family })
+	return nil
+}
+
+// DeleteExpiredTokens purges tokens past their expiry and returns how many
+// were removed.
+func (m *MemoryTokenStore) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer m.db.mu.Unlock()
+
+	now := time.Now()
+	return m.deleteTokens(func(t *tokens.Token) bool { return t.Expiry.Before(now) }), nil
+}
+
+func (m *MemoryTokenStore) GetTokenByHash(ctx context.Context, hash []byte) (*tokens.Token, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	token, ok := m.db.tokens[string(hash)]
+	if !ok {
+		return nil, notFound("token")
+	}
+	return copyToken(token), nil
+}
+
+// TouchToken records that a token was just used from client. Like the
+// Postgres store it only does so when the client changed or the last
+// recorded use is more than a minute old.
+func (m *MemoryTokenStore) TouchToken(ctx context.Context, hash []byte, client tokens.Client) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	token, ok := m.db.tokens[string(hash)]
+	if !ok {
+		return nil
+	}
+	now := m.db.now()
+	stale := token.LastUsedAt == nil || token.LastUsedAt.Before(now.Add(-time.Minute))
+	changed := token.UserAgent != client.UserAgent || token.IP != client.IP ||
+		(client.DeviceLabel != "" && token.DeviceLabel != client.DeviceLabel)
+	if !stale && !changed {
+		return nil
+	}
+	token.LastUsedAt = &now
+	token.UserAgent, token.IP = client.UserAgent, client.IP
+	if client.DeviceLabel != "" {
+		token.DeviceLabel = client.DeviceLabel
+	}
+	return nil
+}
+
+// ListSessions returns the user's live authentication tokens, most recently
+// used first.
+func (m *MemoryTokenStore) ListSessions(ctx context.Context, userID int) ([]*Session, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	now := time.Now()
+	sessions := []*Session{}
+	for _, token := range m.db.tokens {
+		if token.UserID != userID || token.Scope != tokens.ScopeAuth || !token.Expiry.After(now) {
+			continue
+		}
+		sessions = append(sessions, &Session{
+			ID:          token.ID,
+			DeviceLabel: token.DeviceLabel,
+			UserAgent:   token.UserAgent,
+			IP:          token.IP,
+			CreatedAt:   token.CreatedAt,
+			LastUsedAt:  copyTime(token.LastUsedAt),
+			Expiry:      token.Expiry,
+		})
+	}
+	lastActive := func(s *Session) time.Time {
+		if s.LastUsedAt != nil {
+			return *s.LastUsedAt
+		}
+		return s.CreatedAt
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		if c := lastActive(b).Compare(lastActive(a)); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return sessions, nil
+}
+
+// DeleteSession revokes the user's authentication token with the given id
+// along with every other token of its family. It returns ErrNotFound when
+// the user has no such session.
+func (m *MemoryTokenStore) DeleteSession(ctx context.Context, userID int, id int64) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	var family string
+	for _, token := range m.db.tokens {
+		if token.ID == id && token.UserID == userID && token.Scope == tokens.ScopeAuth {
+			family = token.Family
+		}
+	}
+	n := m.deleteTokens(func(t *tokens.Token) bool {
+		return t.UserID == userID && ((t.ID == id && t.Scope == tokens.ScopeAuth) || (family != "" && t.Family == family))
+	})
+	if n == 0 {
+		return notFound("session")
+	}
+	return nil
+}
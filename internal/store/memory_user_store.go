@@ -0,0 +1,300 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+type memoryUserStore struct {
+	db *MemoryDB
+}
+
+// NewMemoryUserStore returns a user store keeping its rows in db.
+func NewMemoryUserStore(db *MemoryDB) *memoryUserStore {
+	return &memoryUserStore{db: db}
+}
+
+// userRow returns the stored user as the store hands it out: a copy that
+// only knows its password hash.
+func (r *memoryUser) userRow() *User {
+	u := r.user
+	u.PasswordHash = password{hash: r.user.PasswordHash.hash}
+	return &u
+}
+
+// checkUnique enforces the unique username and email columns for a user
+// about to be saved under id.
+func (m *memoryUserStore) checkUnique(id int, user *User) error {
+	for _, row := range m.db.users {
+		if row.user.ID == id {
+			continue
+		}
+		if row.user.UserName == user.UserName {
+			return &ConflictError{Field: "username"}
+		}
+		if row.user.Email == user.Email {
+			return &ConflictError{Field: "email"}
+		}
+	}
+	return nil
+}
+
+func (m *memoryUserStore) CreateUser(ctx context.Context, user *User) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	if user.Role == "" {
+		user.Role = roles.User
+	}
+	if err := m.checkUnique(0, user); err != nil {
+		return err
+	}
+	now := m.db.now()
+	user.ID = int(m.db.nextID("users"))
+	user.CreatedAt, user.UpdatedAt = now, now
+
+	row := &memoryUser{user: *user}
+	row.user.TwoFactor, row.user.Disabled = false, false
+	row.user.PasswordHash = password{hash: user.PasswordHash.hash}
+	m.db.users[user.ID] = row
+	return nil
+}
+
+func (m *memoryUserStore) findUser(ctx context.Context, match func(*User) bool) (*User, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	for _, row := range m.db.users {
+		if match(&row.user) {
+			return row.userRow(), nil
+		}
+	}
+	return nil, notFound("user")
+}
+
+func (m *memoryUserStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	return m.findUser(ctx, func(u *User) bool { return int64(u.ID) == id })
+}
+
+func (m *memoryUserStore) GetUserByName(ctx context.Context, username string) (*User, error) {
+	return m.findUser(ctx, func(u *User) bool { return u.UserName == username })
+}
+
+func (m *memoryUserStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return m.findUser(ctx, func(u *User) bool { return u.Email == email })
+}
+
+// ListUsers returns users ordered by id.
+func (m *memoryUserStore) ListUsers(ctx context.Context, limit, offset int) ([]*User, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	ids := make([]int, 0, len(m.db.users))
+	for id := range m.db.users {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	users := []*User{}
+	for _, id := range ids[min(offset, len(ids)):] {
+		if len(users) == limit {
+			break
+		}
+		users = append(users, m.db.users[id].userRow())
+	}
+	return users, nil
+}
+
+func (m *memoryUserStore) UpdateUser(ctx context.Context, user *User) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.users[user.ID]
+	if !ok {
+		return notFound("user")
+	}
+	if err := m.checkUnique(user.ID, user); err != nil {
+		return err
+	}
+	row.user.UserName = user.UserName
+	row.user.Email = user.Email
+	row.user.Bio = user.Bio
+	row.user.Timezone = user.Timezone
+	row.user.Activated = user.Activated
+	row.user.UpdatedAt = m.db.now()
+	return nil
+}
+
+// UpdatePassword stores the hash most recently set on user.PasswordHash.
+func (m *memoryUserStore) UpdatePassword(ctx context.Context, user *User) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.users[user.ID]
+	if !ok {
+		return notFound("user")
+	}
+	row.user.PasswordHash = password{hash: user.PasswordHash.hash}
+	row.user.UpdatedAt = m.db.now()
+	user.UpdatedAt = row.user.UpdatedAt
+	return nil
+}
+
+func (m *memoryUserStore) GetUserToken(ctx context.Context, scope, tokenPlainText string) (*User, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	token, ok := m.db.tokens[string(tokens.HashPlaintext(tokenPlainText))]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, notFound("user")
+	}
+	row, ok := m.db.users[token.UserID]
+	if !ok {
+		return nil, notFound("user")
+	}
+	return row.userRow(), nil
+}
+
+// updateUser applies fn to the stored user and bumps updated_at.
+func (m *memoryUserStore) updateUser(ctx context.Context, userID int, fn func(*memoryUser)) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.users[userID]
+	if !ok {
+		return notFound("user")
+	}
+	fn(row)
+	row.user.UpdatedAt = m.db.now()
+	return nil
+}
+
+func (m *memoryUserStore) SetUserRole(ctx context.Context, userID int, role string) error {
+	return m.updateUser(ctx, userID, func(row *memoryUser) { row.user.Role = role })
+}
+
+func (m *memoryUserStore) SetUserDisabled(ctx context.Context, userID int, disabled bool) error {
+	return m.updateUser(ctx, userID, func(row *memoryUser) { row.user.Disabled = disabled })
+}
+
+// BeginTOTPEnrollment stores a new, not yet enabled TOTP secret and replaces
+// the user's recovery codes.
+func (m *memoryUserStore) BeginTOTPEnrollment(ctx context.Context, userID int, encryptedSecret []byte, recoveryCodeHashes [][]byte) error {
+	return m.updateUser(ctx, userID, func(row *memoryUser) {
+		row.totpSecret = slices.Clone(encryptedSecret)
+		row.user.TwoFactor = false
+		row.totpLastStep = nil
+		row.recoveryCodes = nil
+		for _, hash := range recoveryCodeHashes {
+			row.recoveryCodes = append(row.recoveryCodes, memoryRecoveryCode{hash: slices.Clone(hash)})
+		}
+	})
+}
+
+// GetTOTPSecret returns the encrypted TOTP secret of the user, or nil when
+// they never started enrollment. It returns ErrNotFound for unknown users.
+func (m *memoryUserStore) GetTOTPSecret(ctx context.Context, userID int) ([]byte, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.users[userID]
+	if !ok {
+		return nil, notFound("user")
+	}
+	return slices.Clone(row.totpSecret), nil
+}
+
+// EnableTOTP turns on two-factor authentication once the user proved they
+// can generate codes; step is the time step of that first code.
+func (m *memoryUserStore) EnableTOTP(ctx context.Context, userID int, step int64) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.users[userID]
+	if !ok || row.totpSecret == nil {
+		return notFound("user")
+	}
+	row.user.TwoFactor = true
+	row.totpLastStep = &step
+	row.user.UpdatedAt = m.db.now()
+	return nil
+}
+
+func (m *memoryUserStore) DisableTOTP(ctx context.Context, userID int) error {
+	err := m.updateUser(ctx, userID, func(row *memoryUser) {
+		row.totpSecret = nil
+		row.user.TwoFactor = false
+		row.totpLastStep = nil
+		row.recoveryCodes = nil
+	})
+	// like the UPDATE it mirrors, disabling for an unknown user does nothing
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// AdvanceTOTPStep records step as the last accepted TOTP time step. It
+// returns false when a code from this or a later step was already used, so
+// every code can be used only once.
+func (m *memoryUserStore) AdvanceTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.users[userID]
+	if !ok || (row.totpLastStep != nil && *row.totpLastStep >= step) {
+		return false, nil
+	}
+	row.totpLastStep = &step
+	return true, nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used and reports whether
+// there was one.
+func (m *memoryUserStore) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return false, err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.users[userID]
+	if !ok {
+		return false, nil
+	}
+	for i, code := range row.recoveryCodes {
+		if !code.used && bytes.Equal(code.hash, codeHash) {
+			row.recoveryCodes[i].used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
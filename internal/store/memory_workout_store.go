@@ -0,0 +1,272 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errUnknownUser mirrors the foreign key on user_id: rows can only belong to
+// existing users.
+var errUnknownUser = errors.New("user does not exist")
+
+// errUnknownExercise mirrors the foreign key on workout_entries.exercise_id.
+var errUnknownExercise = errors.New("exercise does not exist")
+
+// errInvalidEntry mirrors the valid_workout_entry check constraint.
+var errInvalidEntry = errors.New("workout entry needs either reps or a duration and/or distance")
+
+type memoryWorkoutStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryWorkoutStore(db *MemoryDB) *memoryWorkoutStore {
+	return &memoryWorkoutStore{db: db}
+}
+
+func copyWorkout(w *Workout) *Workout {
+	c := *w
+	c.Entries = nil
+	for _, entry := range w.Entries {
+		entry.ExerciseID = copyPointer(entry.ExerciseID)
+		entry.Reps = copyPointer(entry.Reps)
+		entry.DurationSeconds = copyPointer(entry.DurationSeconds)
+		entry.DistanceMeters = copyPointer(entry.DistanceMeters)
+		entry.Weight = copyPointer(entry.Weight)
+		c.Entries = append(c.Entries, entry)
+	}
+	// entries are read back ordered by order_index
+	slices.SortStableFunc(c.Entries, func(a, b WorkoutEntry) int {
+		return cmp.Compare(a.OrderIndex, b.OrderIndex)
+	})
+	return &c
+}
+
+// setEntries assigns new IDs to the entries of workout, like inserting them
+// again, after checking every one of them.
+func (m *memoryWorkoutStore) setEntries(workout *Workout) error {
+	for _, entry := range workout.Entries {
+		timed := entry.DurationSeconds != nil || entry.DistanceMeters != nil
+		if (entry.Reps == nil) != timed {
+			return errInvalidEntry
+		}
+		if entry.ExerciseID != nil && m.db.exercises[*entry.ExerciseID] == nil {
+			return errUnknownExercise
+		}
+	}
+	for i := range workout.Entries {
+		workout.Entries[i].ID = int(m.db.nextID("workout_entries"))
+	}
+	return nil
+}
+
+func (m *memoryWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.users[workout.UserID]; !ok {
+		return nil, errUnknownUser
+	}
+	if workout.PerformedAt.IsZero() {
+		workout.PerformedAt = time.Now()
+	}
+	if err := m.setEntries(workout); err != nil {
+		return nil, err
+	}
+	now := m.db.now()
+	workout.ID = int(m.db.nextID("workouts"))
+	workout.CreatedAt, workout.UpdatedAt = now, now
+
+	row := copyWorkout(workout)
+	row.PerformedAt = dbTime(row.PerformedAt)
+	m.db.workouts[row.ID] = row
+	return workout, nil
+}
+
+func (m *memoryWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (*Workout, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.workouts[int(id)]
+	if !ok {
+		return nil, notFound("workout")
+	}
+	return copyWorkout(row), nil
+}
+
+func (m *memoryWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.workouts[workout.ID]
+	if !ok {
+		return notFound("workout")
+	}
+	if err := m.setEntries(workout); err != nil {
+		return err
+	}
+	workout.UpdatedAt = m.db.now()
+
+	// the owner and creation time are never changed by an update
+	updated := copyWorkout(workout)
+	updated.UserID, updated.CreatedAt = row.UserID, row.CreatedAt
+	updated.PerformedAt = dbTime(updated.PerformedAt)
+	m.db.workouts[workout.ID] = updated
+	return nil
+}
+
+func (m *memoryWorkoutStore) DeleteWorkout(ctx context.Context, id int64) error {
+	if err := m.db.lock(ctx); err != nil {
+		return err
+	}
+	defer m.db.mu.Unlock()
+
+	if _, ok := m.db.workouts[int(id)]; !ok {
+		return notFound("workout")
+	}
+	delete(m.db.workouts, int(id))
+	return nil
+}
+
+func (m *memoryWorkoutStore) GetWorkoutOwnerID(ctx context.Context, id int64) (int, error) {
+	if err := m.db.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer m.db.mu.Unlock()
+
+	row, ok := m.db.workouts[int(id)]
+	if !ok {
+		return 0, notFound("workout")
+	}
+	return row.UserID, nil
+}
+
+// compareWorkouts orders workouts by the sort field of ListWorkouts and then
+// by id, ascending.
+func compareWorkouts(sortBy string, a, b *Workout) int {
+	var c int
+	switch sortBy {
+	case WorkoutSortDuration:
+		c = cmp.Compare(a.DurationMinutes, b.DurationMinutes)
+	case WorkoutSortCalories:
+		c = cmp.Compare(a.CaloriesBurned, b.CaloriesBurned)
+	default:
+		c = a.PerformedAt.Compare(b.PerformedAt)
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func (m *memoryWorkoutStore) matches(w *Workout, filter WorkoutFilter) bool {
+	switch {
+	case w.UserID != filter.UserID:
+		return false
+	case filter.Title != "" && !containsFold(w.Title, filter.Title):
+		return false
+	case filter.Exercise != "" && !slices.ContainsFunc(w.Entries, func(e WorkoutEntry) bool {
+		return containsFold(e.ExerciseName, filter.Exercise)
+	}):
+		return false
+	case filter.From != nil && w.PerformedAt.Before(*filter.From):
+		return false
+	case filter.To != nil && !w.PerformedAt.Before(*filter.To):
+		return false
+	case filter.MinDuration != nil && w.DurationMinutes < *filter.MinDuration:
+		return false
+	case filter.MaxDuration != nil && w.DurationMinutes > *filter.MaxDuration:
+		return false
+	}
+	return true
+}
+
+// ListWorkouts returns one page of workouts matching filter together with
+// the cursor of the next page, which is empty when there are no more rows.
+func (m *memoryWorkoutStore) ListWorkouts(ctx context.Context, filter WorkoutFilter) ([]*Workout, string, error) {
+	if _, err := workoutSortColumn(filter.SortBy); err != nil {
+		return nil, "", err
+	}
+	// the position after which the page starts, as a workout that compares
+	// like the last row of the previous page
+	var after *Workout
+	if filter.Cursor != "" {
+		value, id, err := decodeWorkoutCursor(filter.Cursor, filter.SortBy)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &Workout{ID: id}
+		switch v := value.(type) {
+		case time.Time:
+			after.PerformedAt = v
+		case int64:
+			after.DurationMinutes, after.CaloriesBurned = int(v), int(v)
+		default:
+			return nil, "", fmt.Errorf("unexpected cursor value %T", value)
+		}
+	}
+
+	if err := m.db.lock(ctx); err != nil {
+		return nil, "", err
+	}
+	defer m.db.mu.Unlock()
+
+	compare := func(a, b *Workout) int {
+		c := compareWorkouts(filter.SortBy, a, b)
+		if filter.SortDesc {
+			return -c
+		}
+		return c
+	}
+
+	var workouts []*Workout
+	for _, row := range m.db.workouts {
+		if !m.matches(row, filter) {
+			continue
+		}
+		if after != nil && compare(row, after) <= 0 {
+			continue
+		}
+		workouts = append(workouts, row)
+	}
+	slices.SortFunc(workouts, compare)
+
+	var nextCursor string
+	if len(workouts) > filter.Limit {
+		workouts = workouts[:filter.Limit]
+		last := workouts[len(workouts)-1]
+		var value any
+		switch filter.SortBy {
+		case WorkoutSortDuration:
+			value = last.DurationMinutes
+		case WorkoutSortCalories:
+			value = last.CaloriesBurned
+		default:
+			value = last.PerformedAt
+		}
+		var err error
+		nextCursor, err = encodeWorkoutCursor(value, last.ID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	for i, row := range workouts {
+		workouts[i] = copyWorkout(row)
+	}
+	return workouts, nextCursor, nil
+}
@@ -0,0 +1,42 @@
+package store_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/syafae/femProject/internal/config"
+	"github.com/syafae/femProject/internal/migrations"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/store/storetest"
+)
+
+// TestPostgresStores runs against the database in TEST_DB_DSN, normally the
+// test-db service of docker-compose.yml:
+//
+//	TEST_DB_DSN="host=localhost user=postgres password=postgres dbname=postgres port=5433 sslmode=disable" go test ./internal/store
+func TestPostgresStores(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+	db, err := store.Open(config.DBConfig{DSN: dsn, MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := store.MigrateFS(db, migrations.FS, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("catalog", func(t *testing.T) {
+		testCatalog(t, store.NewPostgresExerciseStore(db, queryTimeout))
+	})
+	storetest.Run(t, storetest.Stores{
+		Workouts:   store.NewPostgresWorkoutStore(db, queryTimeout),
+		Users:      store.NewPostgresUserStore(db, queryTimeout),
+		Tokens:     store.NewPostgresTokenStore(db, queryTimeout),
+		Exercises:  store.NewPostgresExerciseStore(db, queryTimeout),
+		APIKeys:    store.NewPostgresAPIKeyStore(db, queryTimeout),
+		LoginAudit: store.NewPostgresLoginAuditStore(db, queryTimeout),
+	})
+}
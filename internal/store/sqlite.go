@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"modernc.org/sqlite"
+)
+
+// sqliteOptions are applied to every connection: foreign keys are off by
+// default in SQLite, WAL lets readers run while a write is in progress and
+// immediate transactions take the write lock up front, which serializes
+// read-modify-write transactions like SELECT ... FOR UPDATE does in
+// postgres. Writers wait up to busy_timeout milliseconds for the lock.
+const sqliteOptions = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+// OpenSQLite opens the SQLite database file at path, creating it when it
+// does not exist.
+func OpenSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?"+sqliteOptions)
+	if err != nil {
+		return nil, fmt.Errorf("db: open %w", err)
+	}
+	logger.Info("opened sqlite database", "path", path)
+	return db, nil
+}
+
+// sqliteTimeFormat stores times as fixed width UTC text, so comparing them
+// as strings orders them in time. The driver parses it back for columns
+// declared as TIMESTAMP.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000Z"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteNow is the current time as bound in place of CURRENT_TIMESTAMP.
+// SQLite itself only knows the time to the millisecond, too coarse to order
+// rows written in quick succession.
+func sqliteNow() string {
+	return sqliteTime(time.Now())
+}
+
+// sqliteNullTime is sqliteTime for nullable columns.
+func sqliteNullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return sqliteTime(*t)
+}
+
+// gooseDialect returns the goose dialect of the database behind db.
+func gooseDialect(db *sql.DB) string {
+	if _, ok := db.Driver().(*sqlite.Driver); ok {
+		return "sqlite3"
+	}
+	return "postgres"
+}
+
+// startSQLiteCall is startCall for the sqlite stores.
+func startSQLiteCall(ctx context.Context, timeout time.Duration, name string) (context.Context, func(error)) {
+	return startSystemCall(ctx, semconv.DBSystemSqlite, timeout, name)
+}
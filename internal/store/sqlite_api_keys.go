@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+type SQLiteAPIKeyStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLiteAPIKeyStore(db *sql.DB, timeout time.Duration) *SQLiteAPIKeyStore {
+	return &SQLiteAPIKeyStore{db: db, timeout: timeout}
+}
+
+func (s *SQLiteAPIKeyStore) CreateAPIKey(ctx context.Context, key *tokens.APIKey) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteAPIKeyStore.CreateAPIKey")
+	defer func() { end(err) }()
+
+	query := `INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
+			  RETURNING id, created_at`
+	return s.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, key.Hash, strings.Join(key.Scopes, " "), sqliteNullTime(key.ExpiresAt),
+		sqliteNow()).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (s *SQLiteAPIKeyStore) ListAPIKeys(ctx context.Context, userID int) (_ []*tokens.APIKey, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteAPIKeyStore.ListAPIKeys")
+	defer func() { end(err) }()
+
+	query := `SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+	          FROM api_keys
+			  WHERE user_id = $1
+			  ORDER BY created_at DESC, id DESC`
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*tokens.APIKey{}
+	for rows.Next() {
+		key := &tokens.APIKey{UserID: userID}
+		var scopes string
+		err = rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Fields(scopes)
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes one of the user's keys. It returns ErrNotFound when
+// the user has no key with that id.
+func (s *SQLiteAPIKeyStore) DeleteAPIKey(ctx context.Context, userID int, id int64) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteAPIKeyStore.DeleteAPIKey")
+	defer func() { end(err) }()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("api key")
+	}
+	return nil
+}
+
+// GetUserForAPIKey resolves an API key to its owner. It returns ErrNotFound
+// when the key is unknown or expired. Each successful lookup records the
+// time of use.
+func (s *SQLiteAPIKeyStore) GetUserForAPIKey(ctx context.Context, plaintext string) (_ *User, _ *tokens.APIKey, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteAPIKeyStore.GetUserForAPIKey")
+	defer func() { end(err) }()
+
+	// unlike postgres, RETURNING cannot read the users table joined by
+	// UPDATE ... FROM, so the owner is loaded in a second query
+	hash := tokens.HashPlaintext(plaintext)
+	query := `UPDATE api_keys
+	          SET last_used_at = $2
+			  WHERE hash = $1 AND (expires_at IS NULL OR expires_at > $2)
+			  RETURNING id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at`
+	key := &tokens.APIKey{Hash: hash}
+	var scopes string
+	err = s.db.QueryRowContext(ctx, query, hash, sqliteNow()).
+		Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, notFound("api key")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+
+	user, err := scanUser(s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users AS u WHERE u.id = $1`, key.UserID))
+	if err == sql.ErrNoRows {
+		return nil, nil, notFound("api key")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, key, nil
+}
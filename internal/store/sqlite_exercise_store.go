@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqliteExerciseStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+// NewSQLiteExerciseStore returns an exercise store on a database opened with
+// OpenSQLite.
+func NewSQLiteExerciseStore(db *sql.DB, timeout time.Duration) *sqliteExerciseStore {
+	return &sqliteExerciseStore{db: db, timeout: timeout}
+}
+
+func (s *sqliteExerciseStore) ListExercises(ctx context.Context, filter ExerciseFilter) (_ []*Exercise, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteExerciseStore.ListExercises")
+	defer func() { end(err) }()
+
+	return listExercises(ctx, s.db, filter, "LIKE")
+}
+
+func (s *sqliteExerciseStore) GetExercise(ctx context.Context, userID int, id int64) (_ *Exercise, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteExerciseStore.GetExercise")
+	defer func() { end(err) }()
+
+	return getExercise(ctx, s.db, userID, id)
+}
+
+func (s *sqliteExerciseStore) FindExercise(ctx context.Context, userID int, name string) (_ *Exercise, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteExerciseStore.FindExercise")
+	defer func() { end(err) }()
+
+	return findExercise(ctx, s.db, userID, name)
+}
+
+func (s *sqliteExerciseStore) CreateExercise(ctx context.Context, exercise *Exercise) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteExerciseStore.CreateExercise")
+	defer func() { end(err) }()
+
+	return createExercise(ctx, s.db, exercise, sqliteNow())
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SQLiteLoginAuditStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLiteLoginAuditStore(db *sql.DB, timeout time.Duration) *SQLiteLoginAuditStore {
+	return &SQLiteLoginAuditStore{db: db, timeout: timeout}
+}
+
+func (s *SQLiteLoginAuditStore) RecordFailedLogin(ctx context.Context, attempt *FailedLogin) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteLoginAuditStore.RecordFailedLogin")
+	defer func() { end(err) }()
+
+	query := `INSERT INTO failed_logins (username, user_id, ip, user_agent, reason, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+			  RETURNING id, created_at`
+	return s.db.QueryRowContext(ctx, query, attempt.UserName, attempt.UserID, attempt.IP, attempt.UserAgent, attempt.Reason, sqliteNow()).
+		Scan(&attempt.ID, &attempt.CreatedAt)
+}
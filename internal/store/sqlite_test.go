@@ -0,0 +1,44 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/syafae/femProject/internal/migrations"
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/store/storetest"
+)
+
+func TestSQLiteStores(t *testing.T) {
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "workouts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := store.MigrateFS(db, migrations.SQLite, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("catalog", func(t *testing.T) {
+		testCatalog(t, store.NewSQLiteExerciseStore(db, queryTimeout))
+	})
+	t.Run("query timeout", func(t *testing.T) {
+		// the timeout passed to the constructor bounds every call
+		exercises := store.NewSQLiteExerciseStore(db, time.Nanosecond)
+		_, err := exercises.ListExercises(t.Context(), store.ExerciseFilter{})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("ListExercises with a 1ns timeout = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+	storetest.Run(t, storetest.Stores{
+		Workouts:   store.NewSQLiteWorkoutStore(db, queryTimeout),
+		Users:      store.NewSQLiteUserStore(db, queryTimeout),
+		Tokens:     store.NewSQLiteTokenStore(db, queryTimeout),
+		Exercises:  store.NewSQLiteExerciseStore(db, queryTimeout),
+		APIKeys:    store.NewSQLiteAPIKeyStore(db, queryTimeout),
+		LoginAudit: store.NewSQLiteLoginAuditStore(db, queryTimeout),
+	})
+}
@@ -0,0 +1,277 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+type SQLiteTokenStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+func NewSQLiteTokenStore(db *sql.DB, timeout time.Duration) *SQLiteTokenStore {
+	return &SQLiteTokenStore{db: db, timeout: timeout}
+}
+
+// insertSQLiteToken stores token with its expiry rounded to the second, as
+// the TIMESTAMP(0) column of postgres does.
+func insertSQLiteToken(ctx context.Context, db execer, token *tokens.Token) error {
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope, family, user_agent, ip, device_label, created_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	family := sql.NullString{String: token.Family, Valid: token.Family != ""}
+	_, err := db.ExecContext(ctx, query, token.Hash, token.UserID, sqliteTime(token.Expiry.Round(time.Second)), token.Scope, family,
+		token.UserAgent, token.IP, token.DeviceLabel, sqliteNow())
+	return err
+}
+
+func (s *SQLiteTokenStore) InsertToken(ctx context.Context, token *tokens.Token) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.InsertToken")
+	defer func() { end(err) }()
+
+	return insertSQLiteToken(ctx, s.db, token)
+}
+
+func (s *SQLiteTokenStore) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	token, err := tokens.GenerateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	err = s.InsertToken(ctx, token)
+	return token, err
+}
+
+// CreateTokenPair starts a new token family for a fresh login and returns its
+// authentication and refresh tokens.
+func (s *SQLiteTokenStore) CreateTokenPair(ctx context.Context, userID int, authTTL, refreshTTL time.Duration, client tokens.Client) (_, _ *tokens.Token, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.CreateTokenPair")
+	defer func() { end(err) }()
+
+	family, err := tokens.GenerateFamily()
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, refresh, err := generateTokenPair(userID, family, authTTL, refreshTTL, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if err = insertSQLiteToken(ctx, tx, auth); err != nil {
+		return nil, nil, err
+	}
+	if err = insertSQLiteToken(ctx, tx, refresh); err != nil {
+		return nil, nil, err
+	}
+	return auth, refresh, tx.Commit()
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair in the
+// same family, with the reuse detection of PostgresTokenStore. The
+// transaction holds the write lock from its start, so two rotations of the
+// same token cannot both succeed.
+func (s *SQLiteTokenStore) RotateRefreshToken(ctx context.Context, plaintext string, authTTL, refreshTTL time.Duration, client tokens.Client) (_, _ *tokens.Token, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.RotateRefreshToken")
+	defer func() { end(err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	current := &tokens.Token{Hash: tokens.HashPlaintext(plaintext)}
+	var family sql.NullString
+	query := `SELECT user_id, expiry, scope, family, used_at, device_label FROM tokens WHERE hash = $1 AND scope = $2`
+	err = tx.QueryRowContext(ctx, query, current.Hash, tokens.ScopeRefresh).
+		Scan(&current.UserID, &current.Expiry, &current.Scope, &family, &current.UsedAt, &current.DeviceLabel)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	current.Family = family.String
+
+	if current.UsedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, current.Family)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+	if !current.Expiry.After(time.Now()) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = $1 WHERE hash = $2`, sqliteNow(), current.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1 AND scope = $2`, current.Family, tokens.ScopeAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if client.DeviceLabel == "" {
+		client.DeviceLabel = current.DeviceLabel
+	}
+	auth, refresh, err := generateTokenPair(current.UserID, current.Family, authTTL, refreshTTL, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = insertSQLiteToken(ctx, tx, auth); err != nil {
+		return nil, nil, err
+	}
+	if err = insertSQLiteToken(ctx, tx, refresh); err != nil {
+		return nil, nil, err
+	}
+	return auth, refresh, tx.Commit()
+}
+
+func (s *SQLiteTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int, scope string) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.DeleteAllTokensForUser")
+	defer func() { end(err) }()
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = $1 AND scope = $2`, userID, scope)
+	return err
+}
+
+func (s *SQLiteTokenStore) DeleteToken(ctx context.Context, token *tokens.Token) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.DeleteToken")
+	defer func() { end(err) }()
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM tokens WHERE hash = $1`, token.Hash)
+	return err
+}
+
+func (s *SQLiteTokenStore) DeleteTokenFamily(ctx context.Context, family string) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.DeleteTokenFamily")
+	defer func() { end(err) }()
+
+	_, err = s.db.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, family)
+	return err
+}
+
+// DeleteExpiredTokens purges tokens past their expiry and returns how many
+// were removed.
+func (s *SQLiteTokenStore) DeleteExpiredTokens(ctx context.Context) (_ int64, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.DeleteExpiredTokens")
+	defer func() { end(err) }()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM tokens WHERE expiry < $1`, sqliteNow())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLiteTokenStore) GetTokenByHash(ctx context.Context, hash []byte) (_ *tokens.Token, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.GetTokenByHash")
+	defer func() { end(err) }()
+
+	query := `SELECT id, user_id, expiry, scope, family, used_at, created_at, last_used_at, user_agent, ip, device_label
+	          FROM tokens WHERE hash = $1`
+	token := &tokens.Token{}
+	var family sql.NullString
+	err = s.db.QueryRowContext(ctx, query, hash).Scan(&token.ID, &token.UserID, &token.Expiry, &token.Scope, &family, &token.UsedAt,
+		&token.CreatedAt, &token.LastUsedAt, &token.UserAgent, &token.IP, &token.DeviceLabel)
+	if err == sql.ErrNoRows {
+		return nil, notFound("token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.Hash = hash
+	token.Family = family.String
+	return token, nil
+}
+
+// TouchToken records that a token was just used from client, skipping the
+// write like PostgresTokenStore does when nothing changed within a minute.
+func (s *SQLiteTokenStore) TouchToken(ctx context.Context, hash []byte, client tokens.Client) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.TouchToken")
+	defer func() { end(err) }()
+
+	now := time.Now()
+	query := `UPDATE tokens
+	          SET last_used_at = $5, user_agent = $2, ip = $3,
+			      device_label = CASE WHEN $4 = '' THEN device_label ELSE $4 END
+			  WHERE hash = $1 AND (
+			      last_used_at IS NULL OR last_used_at < $6
+			      OR user_agent <> $2 OR ip <> $3 OR ($4 <> '' AND device_label <> $4))`
+	_, err = s.db.ExecContext(ctx, query, hash, client.UserAgent, client.IP, client.DeviceLabel, sqliteTime(now), sqliteTime(now.Add(-time.Minute)))
+	return err
+}
+
+// ListSessions returns the user's live authentication tokens, most recently
+// used first.
+func (s *SQLiteTokenStore) ListSessions(ctx context.Context, userID int) (_ []*Session, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.ListSessions")
+	defer func() { end(err) }()
+
+	query := `SELECT id, device_label, user_agent, ip, created_at, last_used_at, expiry
+	          FROM tokens
+			  WHERE user_id = $1 AND scope = $2 AND expiry > $3
+			  ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC`
+	rows, err := s.db.QueryContext(ctx, query, userID, tokens.ScopeAuth, sqliteNow())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session := &Session{}
+		err = rows.Scan(
+			&session.ID,
+			&session.DeviceLabel,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes the user's authentication token with the given id
+// along with every other token of its family. It returns ErrNotFound when
+// the user has no such session.
+func (s *SQLiteTokenStore) DeleteSession(ctx context.Context, userID int, id int64) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "SQLiteTokenStore.DeleteSession")
+	defer func() { end(err) }()
+
+	query := `DELETE FROM tokens
+	          WHERE user_id = $1 AND (
+			      (id = $2 AND scope = $3) OR family = (SELECT family FROM tokens WHERE id = $2 AND user_id = $1 AND scope = $3))`
+	result, err := s.db.ExecContext(ctx, query, userID, id, tokens.ScopeAuth)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("session")
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"time"
+
+	"github.com/syafae/femProject/internal/roles"
+)
+
+type sqliteUserStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+// NewSQLiteUserStore returns a user store on a database opened with
+// OpenSQLite.
+func NewSQLiteUserStore(db *sql.DB, timeout time.Duration) *sqliteUserStore {
+	return &sqliteUserStore{db: db, timeout: timeout}
+}
+
+func (s *sqliteUserStore) CreateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.CreateUser")
+	defer func() { end(err) }()
+
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	if user.Role == "" {
+		user.Role = roles.User
+	}
+	query := `INSERT INTO users (username, email, password_hash, bio, timezone, activated, role, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+			  RETURNING id, created_at, updated_at`
+	err = s.db.QueryRowContext(ctx, query, user.UserName, user.Email, user.PasswordHash.hash, user.Bio, user.Timezone, user.Activated, user.Role,
+		sqliteNow()).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return conflictError(err)
+	}
+	return nil
+}
+
+func (s *sqliteUserStore) getUser(ctx context.Context, query string, args ...any) (*User, error) {
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *sqliteUserStore) GetUserByID(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.GetUserByID")
+	defer func() { end(err) }()
+
+	return s.getUser(ctx, `SELECT `+userColumns+` FROM users AS u WHERE u.id = $1`, id)
+}
+
+func (s *sqliteUserStore) GetUserByName(ctx context.Context, username string) (_ *User, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.GetUserByName")
+	defer func() { end(err) }()
+
+	return s.getUser(ctx, `SELECT `+userColumns+` FROM users AS u WHERE u.username = $1`, username)
+}
+
+func (s *sqliteUserStore) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.GetUserByEmail")
+	defer func() { end(err) }()
+
+	return s.getUser(ctx, `SELECT `+userColumns+` FROM users AS u WHERE u.email = $1`, email)
+}
+
+// ListUsers returns users ordered by id.
+func (s *sqliteUserStore) ListUsers(ctx context.Context, limit, offset int) (_ []*User, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.ListUsers")
+	defer func() { end(err) }()
+
+	query := `SELECT ` + userColumns + `
+	          FROM users AS u
+			  ORDER BY u.id
+			  LIMIT $1 OFFSET $2`
+	rows, err := s.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// execOne runs a statement that changes one row of resource and returns
+// ErrNotFound when there was none.
+func (s *sqliteUserStore) execOne(ctx context.Context, resource, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return conflictError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound(resource)
+	}
+	return nil
+}
+
+func (s *sqliteUserStore) UpdateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.UpdateUser")
+	defer func() { end(err) }()
+
+	query := `UPDATE users
+	          SET username = $1, email = $2, bio = $3, timezone = $4, activated = $5, updated_at = $6
+			  WHERE id = $7`
+	return s.execOne(ctx, "user", query, user.UserName, user.Email, user.Bio, user.Timezone, user.Activated, sqliteNow(), user.ID)
+}
+
+// UpdatePassword stores the hash most recently set on user.PasswordHash.
+func (s *sqliteUserStore) UpdatePassword(ctx context.Context, user *User) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.UpdatePassword")
+	defer func() { end(err) }()
+
+	query := `UPDATE users
+	          SET password_hash = $1, updated_at = $2
+			  WHERE id = $3
+			  RETURNING updated_at`
+	err = s.db.QueryRowContext(ctx, query, user.PasswordHash.hash, sqliteNow(), user.ID).Scan(&user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("user")
+	}
+	return err
+}
+
+func (s *sqliteUserStore) GetUserToken(ctx context.Context, scope, tokenPlainText string) (_ *User, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.GetUserToken")
+	defer func() { end(err) }()
+
+	tokenHash := sha256.Sum256([]byte(tokenPlainText))
+	query := `SELECT ` + userColumns + `
+	          FROM users AS u
+			  JOIN tokens AS t ON t.user_id = u.id
+			  WHERE t.scope = $1 AND t.hash = $2 AND t.expiry > $3`
+	return s.getUser(ctx, query, scope, tokenHash[:], sqliteNow())
+}
+
+func (s *sqliteUserStore) SetUserRole(ctx context.Context, userID int, role string) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.SetUserRole")
+	defer func() { end(err) }()
+
+	query := `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`
+	return s.execOne(ctx, "user", query, role, sqliteNow(), userID)
+}
+
+func (s *sqliteUserStore) SetUserDisabled(ctx context.Context, userID int, disabled bool) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.SetUserDisabled")
+	defer func() { end(err) }()
+
+	query := `UPDATE users SET disabled = $1, updated_at = $2 WHERE id = $3`
+	return s.execOne(ctx, "user", query, disabled, sqliteNow(), userID)
+}
+
+// BeginTOTPEnrollment stores a new, not yet enabled TOTP secret and replaces
+// the user's recovery codes.
+func (s *sqliteUserStore) BeginTOTPEnrollment(ctx context.Context, userID int, encryptedSecret []byte, recoveryCodeHashes [][]byte) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.BeginTOTPEnrollment")
+	defer func() { end(err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users
+	          SET totp_secret = $1, totp_enabled = false, totp_last_step = NULL, updated_at = $2
+			  WHERE id = $3`
+	result, err := tx.ExecContext(ctx, query, encryptedSecret, sqliteNow(), userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("user")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTOTPSecret returns the encrypted TOTP secret of the user, or nil when
+// they never started enrollment. It returns ErrNotFound for unknown users.
+func (s *sqliteUserStore) GetTOTPSecret(ctx context.Context, userID int) (_ []byte, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.GetTOTPSecret")
+	defer func() { end(err) }()
+
+	var secret []byte
+	err = s.db.QueryRowContext(ctx, `SELECT totp_secret FROM users WHERE id = $1`, userID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EnableTOTP turns on two-factor authentication once the user proved they
+// can generate codes; step is the time step of that first code.
+func (s *sqliteUserStore) EnableTOTP(ctx context.Context, userID int, step int64) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.EnableTOTP")
+	defer func() { end(err) }()
+
+	query := `UPDATE users
+	          SET totp_enabled = true, totp_last_step = $1, updated_at = $2
+			  WHERE id = $3 AND totp_secret IS NOT NULL`
+	return s.execOne(ctx, "user", query, step, sqliteNow(), userID)
+}
+
+func (s *sqliteUserStore) DisableTOTP(ctx context.Context, userID int) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.DisableTOTP")
+	defer func() { end(err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users
+	          SET totp_secret = NULL, totp_enabled = false, totp_last_step = NULL, updated_at = $2
+			  WHERE id = $1`
+	if _, err = tx.ExecContext(ctx, query, userID, sqliteNow()); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdvanceTOTPStep records step as the last accepted TOTP time step. It
+// returns false when a code from this or a later step was already used, so
+// every code can be used only once.
+func (s *sqliteUserStore) AdvanceTOTPStep(ctx context.Context, userID int, step int64) (_ bool, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.AdvanceTOTPStep")
+	defer func() { end(err) }()
+
+	query := `UPDATE users
+	          SET totp_last_step = $1
+			  WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+	result, err := s.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used and reports whether
+// there was one.
+func (s *sqliteUserStore) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (_ bool, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteUserStore.UseRecoveryCode")
+	defer func() { end(err) }()
+
+	query := `UPDATE recovery_codes
+	          SET used_at = $3
+			  WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := s.db.ExecContext(ctx, query, userID, codeHash, sqliteNow())
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqliteWorkoutStore struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+// NewSQLiteWorkoutStore returns a workout store on a database opened with
+// OpenSQLite.
+func NewSQLiteWorkoutStore(db *sql.DB, timeout time.Duration) *sqliteWorkoutStore {
+	return &sqliteWorkoutStore{db: db, timeout: timeout}
+}
+
+func (s *sqliteWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (_ *Workout, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteWorkoutStore.CreateWorkout")
+	defer func() { end(err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if workout.PerformedAt.IsZero() {
+		workout.PerformedAt = time.Now()
+	}
+	query := `INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, performed_at, created_at, updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+			  RETURNING id, created_at, updated_at`
+	err = tx.QueryRowContext(ctx, query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned,
+		sqliteTime(workout.PerformedAt), sqliteNow()).Scan(&workout.ID, &workout.CreatedAt, &workout.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err = insertWorkoutEntries(ctx, tx, workout); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+func (s *sqliteWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (_ *Workout, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteWorkoutStore.GetWorkoutByID")
+	defer func() { end(err) }()
+
+	workout := &Workout{}
+	query := `SELECT id, user_id, title, description, duration_minutes, calories_burned, performed_at, created_at, updated_at
+	          FROM workouts
+			  WHERE id = $1`
+	err = s.db.QueryRowContext(ctx, query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes,
+		&workout.CaloriesBurned, &workout.PerformedAt, &workout.CreatedAt, &workout.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, notFound("workout")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	workout.Entries, err = getWorkoutEntries(ctx, s.db, int64(workout.ID))
+	if err != nil {
+		return nil, err
+	}
+	return workout, nil
+}
+
+func (s *sqliteWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteWorkoutStore.UpdateWorkout")
+	defer func() { end(err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE workouts
+	          SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, performed_at = $5, updated_at = $6
+			  WHERE id = $7
+			  RETURNING updated_at`
+	err = tx.QueryRowContext(ctx, query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned,
+		sqliteTime(workout.PerformedAt), sqliteNow(), workout.ID).Scan(&workout.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("workout")
+	}
+	if err != nil {
+		return err
+	}
+
+	// the entries are replaced wholesale
+	if _, err = tx.ExecContext(ctx, `DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID); err != nil {
+		return err
+	}
+	if err = insertWorkoutEntries(ctx, tx, workout); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteWorkoutStore) DeleteWorkout(ctx context.Context, id int64) (err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteWorkoutStore.DeleteWorkout")
+	defer func() { end(err) }()
+
+	result, err := s.db.ExecContext(ctx, `DELETE FROM workouts WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("workout")
+	}
+	return nil
+}
+
+func (s *sqliteWorkoutStore) GetWorkoutOwnerID(ctx context.Context, workoutID int64) (_ int, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteWorkoutStore.GetWorkoutOwnerID")
+	defer func() { end(err) }()
+
+	var userID int
+	err = s.db.QueryRowContext(ctx, `SELECT user_id FROM workouts WHERE id = $1`, workoutID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, notFound("workout")
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// ListWorkouts returns one page of workouts matching filter together with
+// the cursor of the next page, which is empty when there are no more rows.
+// LIKE ignores case in SQLite, though only for ASCII letters.
+func (s *sqliteWorkoutStore) ListWorkouts(ctx context.Context, filter WorkoutFilter) (_ []*Workout, _ string, err error) {
+	ctx, end := startSQLiteCall(ctx, s.timeout, "sqliteWorkoutStore.ListWorkouts")
+	defer func() { end(err) }()
+
+	return listWorkouts(ctx, s.db, filter, "LIKE", func(t time.Time) any { return sqliteTime(t) })
+}
@@ -0,0 +1,126 @@
+package storetest
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+func (su *suite) newAPIKey(userID int, name string, expiresAt *time.Time) (*tokens.APIKey, error) {
+	key, err := tokens.GenerateAPIKey(userID, name, []string{tokens.APIScopeWorkoutsRead, tokens.APIScopeProfileRead}, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := su.APIKeys.CreateAPIKey(su.ctx, key); err != nil {
+		return nil, fmt.Errorf("CreateAPIKey: %w", err)
+	}
+	return key, nil
+}
+
+func checkAPIKeyCreateAndUse(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(time.Hour)
+	key, err := su.newAPIKey(user.ID, "backup script", &expiresAt)
+	if err != nil {
+		return err
+	}
+	if key.ID == 0 || key.CreatedAt.IsZero() {
+		return fmt.Errorf("CreateAPIKey did not set the id and creation time: %+v", key)
+	}
+
+	keys, err := su.APIKeys.ListAPIKeys(su.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("ListAPIKeys: %w", err)
+	}
+	// expiry is stored with second precision
+	if len(keys) != 1 || keys[0].ID != key.ID || keys[0].Name != "backup script" || keys[0].Prefix != key.Prefix ||
+		!slices.Equal(keys[0].Scopes, key.Scopes) || keys[0].ExpiresAt == nil || !sameTime(*keys[0].ExpiresAt, expiresAt, time.Second) ||
+		keys[0].LastUsedAt != nil || keys[0].Plaintext != "" || keys[0].Hash != nil {
+		return fmt.Errorf("ListAPIKeys = %+v, want the new key without its secret", keys)
+	}
+
+	got, gotKey, err := su.APIKeys.GetUserForAPIKey(su.ctx, key.Plaintext)
+	if err != nil {
+		return fmt.Errorf("GetUserForAPIKey: %w", err)
+	}
+	if got.ID != user.ID || gotKey.ID != key.ID || gotKey.UserID != user.ID || !slices.Equal(gotKey.Scopes, key.Scopes) {
+		return fmt.Errorf("GetUserForAPIKey = %+v, %+v, want the key's owner and the key", got, gotKey)
+	}
+	keys, err = su.APIKeys.ListAPIKeys(su.ctx, user.ID)
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt == nil {
+		return fmt.Errorf("after GetUserForAPIKey the key is %+v, %v, want its time of use recorded", keys, err)
+	}
+
+	_, _, err = su.APIKeys.GetUserForAPIKey(su.ctx, tokens.APIKeyPrefix+su.prefix)
+	return expectErr("GetUserForAPIKey with an unknown key", err, store.ErrNotFound)
+}
+
+func checkAPIKeyExpired(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(-time.Minute)
+	key, err := su.newAPIKey(user.ID, "old", &expiresAt)
+	if err != nil {
+		return err
+	}
+	_, _, err = su.APIKeys.GetUserForAPIKey(su.ctx, key.Plaintext)
+	if err := expectErr("GetUserForAPIKey with an expired key", err, store.ErrNotFound); err != nil {
+		return err
+	}
+
+	forever, err := su.newAPIKey(user.ID, "forever", nil)
+	if err != nil {
+		return err
+	}
+	if _, _, err := su.APIKeys.GetUserForAPIKey(su.ctx, forever.Plaintext); err != nil {
+		return fmt.Errorf("GetUserForAPIKey with a key that does not expire: %w", err)
+	}
+	return nil
+}
+
+func checkAPIKeyDelete(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	other, err := su.newUser("bob")
+	if err != nil {
+		return err
+	}
+	key, err := su.newAPIKey(user.ID, "first", nil)
+	if err != nil {
+		return err
+	}
+	kept, err := su.newAPIKey(user.ID, "second", nil)
+	if err != nil {
+		return err
+	}
+
+	if err := expectErr("DeleteAPIKey of another user", su.APIKeys.DeleteAPIKey(su.ctx, other.ID, key.ID), store.ErrNotFound); err != nil {
+		return err
+	}
+	if err := su.APIKeys.DeleteAPIKey(su.ctx, user.ID, key.ID); err != nil {
+		return fmt.Errorf("DeleteAPIKey: %w", err)
+	}
+	_, _, err = su.APIKeys.GetUserForAPIKey(su.ctx, key.Plaintext)
+	if err := expectErr("GetUserForAPIKey with a deleted key", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	if err := expectErr("second DeleteAPIKey", su.APIKeys.DeleteAPIKey(su.ctx, user.ID, key.ID), store.ErrNotFound); err != nil {
+		return err
+	}
+
+	keys, err := su.APIKeys.ListAPIKeys(su.ctx, user.ID)
+	if err != nil || len(keys) != 1 || keys[0].ID != kept.ID {
+		return fmt.Errorf("ListAPIKeys after DeleteAPIKey = %+v, %v, want only the other key", keys, err)
+	}
+	return nil
+}
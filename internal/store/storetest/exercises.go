@@ -0,0 +1,223 @@
+package storetest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/syafae/femProject/internal/store"
+)
+
+func exerciseNames(exercises []*store.Exercise) []string {
+	var names []string
+	for _, exercise := range exercises {
+		names = append(names, exercise.Name)
+	}
+	return names
+}
+
+func checkExerciseCatalog(su *suite) error {
+	user, err := su.newUser("lifter")
+	if err != nil {
+		return err
+	}
+	all, err := su.Exercises.ListExercises(su.ctx, store.ExerciseFilter{UserID: user.ID})
+	if err != nil {
+		return fmt.Errorf("ListExercises: %w", err)
+	}
+	i := slices.IndexFunc(all, func(e *store.Exercise) bool { return e.Name == "Back Squat" })
+	if i < 0 {
+		return fmt.Errorf("ListExercises = %v, want the built-in Back Squat", exerciseNames(all))
+	}
+	squat := all[i]
+	if squat.UserID != nil || squat.Category != store.ExerciseCategoryStrength || squat.Measurement != store.MeasurementReps ||
+		!slices.Equal(squat.Aliases, []string{"Squat", "Squats", "Barbell Squat"}) ||
+		!slices.Equal(squat.PrimaryMuscles, []string{"quadriceps", "glutes"}) || !slices.Equal(squat.Equipment, []string{"barbell", "rack"}) {
+		return fmt.Errorf("Back Squat = %+v, want the catalog entry", squat)
+	}
+	if !slices.IsSortedFunc(all, func(a, b *store.Exercise) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	}) {
+		return fmt.Errorf("ListExercises = %v, want them ordered by name", exerciseNames(all))
+	}
+
+	found, err := su.Exercises.FindExercise(su.ctx, user.ID, " squats ")
+	if err != nil || found.ID != squat.ID {
+		return fmt.Errorf("FindExercise by alias = %+v, %v, want Back Squat", found, err)
+	}
+	found, err = su.Exercises.FindExercise(su.ctx, user.ID, "BENCH PRESS")
+	if err != nil || found.Name != "Bench Press" {
+		return fmt.Errorf("FindExercise by name = %+v, %v, want Bench Press", found, err)
+	}
+	_, err = su.Exercises.FindExercise(su.ctx, user.ID, "no such exercise")
+	if err := expectErr("FindExercise", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	got, err := su.Exercises.GetExercise(su.ctx, user.ID, int64(squat.ID))
+	if err != nil || got.Name != "Back Squat" || len(got.Aliases) != 3 {
+		return fmt.Errorf("GetExercise = %+v, %v, want Back Squat with its aliases", got, err)
+	}
+	_, err = su.Exercises.GetExercise(su.ctx, user.ID, missingID)
+	if err := expectErr("GetExercise", err, store.ErrNotFound); err != nil {
+		return err
+	}
+
+	cardio, err := su.Exercises.ListExercises(su.ctx, store.ExerciseFilter{UserID: user.ID, Category: store.ExerciseCategoryCardio})
+	if err != nil {
+		return fmt.Errorf("ListExercises: %w", err)
+	}
+	if len(cardio) == 0 || slices.ContainsFunc(cardio, func(e *store.Exercise) bool { return e.Category != store.ExerciseCategoryCardio }) {
+		return fmt.Errorf("category filter returned %v", exerciseNames(cardio))
+	}
+	calves, err := su.Exercises.ListExercises(su.ctx, store.ExerciseFilter{UserID: user.ID, Muscle: "calves"})
+	if err != nil {
+		return fmt.Errorf("ListExercises: %w", err)
+	}
+	if !slices.Contains(exerciseNames(calves), "Calf Raise") || !slices.Contains(exerciseNames(calves), "Running") ||
+		slices.Contains(exerciseNames(calves), "Bench Press") {
+		return fmt.Errorf("muscle filter returned %v, want primary and secondary matches", exerciseNames(calves))
+	}
+	erg, err := su.Exercises.ListExercises(su.ctx, store.ExerciseFilter{UserID: user.ID, Query: "ERG"})
+	if err != nil {
+		return fmt.Errorf("ListExercises: %w", err)
+	}
+	if !slices.Equal(exerciseNames(erg), []string{"Rowing"}) {
+		return fmt.Errorf("query filter returned %v, want Rowing by its alias", exerciseNames(erg))
+	}
+	return nil
+}
+
+func checkExerciseCustom(su *suite) error {
+	owner, err := su.newUser("owner")
+	if err != nil {
+		return err
+	}
+	other, err := su.newUser("other")
+	if err != nil {
+		return err
+	}
+	custom := &store.Exercise{
+		UserID:         &owner.ID,
+		Name:           "Sled Push",
+		Aliases:        []string{"Prowler"},
+		Category:       store.ExerciseCategoryStrength,
+		PrimaryMuscles: []string{"quadriceps", "glutes"},
+		Measurement:    store.MeasurementDistance,
+	}
+	if err := su.Exercises.CreateExercise(su.ctx, custom); err != nil {
+		return fmt.Errorf("CreateExercise: %w", err)
+	}
+	if custom.ID == 0 || custom.CreatedAt.IsZero() {
+		return fmt.Errorf("CreateExercise did not set the id and creation time: %+v", custom)
+	}
+
+	got, err := su.Exercises.GetExercise(su.ctx, owner.ID, int64(custom.ID))
+	if err != nil {
+		return fmt.Errorf("GetExercise: %w", err)
+	}
+	if got.UserID == nil || *got.UserID != owner.ID || !slices.Equal(got.Aliases, []string{"Prowler"}) ||
+		got.SecondaryMuscles == nil || len(got.SecondaryMuscles) != 0 || got.Measurement != store.MeasurementDistance {
+		return fmt.Errorf("GetExercise = %+v, want the created exercise", got)
+	}
+	_, err = su.Exercises.GetExercise(su.ctx, other.ID, int64(custom.ID))
+	if err := expectErr("GetExercise of another user", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	_, err = su.Exercises.FindExercise(su.ctx, other.ID, "prowler")
+	if err := expectErr("FindExercise of another user", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	mine, err := su.Exercises.ListExercises(su.ctx, store.ExerciseFilter{UserID: owner.ID, Query: "sled"})
+	if err != nil || !slices.Equal(exerciseNames(mine), []string{"Sled Push"}) {
+		return fmt.Errorf("ListExercises of the owner = %v, %v, want Sled Push", exerciseNames(mine), err)
+	}
+	theirs, err := su.Exercises.ListExercises(su.ctx, store.ExerciseFilter{UserID: other.ID, Query: "sled"})
+	if err != nil || len(theirs) != 0 {
+		return fmt.Errorf("ListExercises of another user = %v, %v, want none", exerciseNames(theirs), err)
+	}
+
+	duplicate := &store.Exercise{UserID: &owner.ID, Name: "sled push", Category: store.ExerciseCategoryStrength, Measurement: store.MeasurementReps}
+	if err := expectConflict("CreateExercise with a taken name", su.Exercises.CreateExercise(su.ctx, duplicate), "name"); err != nil {
+		return err
+	}
+	builtIn := &store.Exercise{UserID: &owner.ID, Name: "Bench Press", Category: store.ExerciseCategoryStrength, Measurement: store.MeasurementReps}
+	if err := expectConflict("CreateExercise with a built-in name", su.Exercises.CreateExercise(su.ctx, builtIn), "name"); err != nil {
+		return err
+	}
+	same := &store.Exercise{UserID: &other.ID, Name: "Sled Push", Category: store.ExerciseCategoryStrength, Measurement: store.MeasurementDistance}
+	if err := su.Exercises.CreateExercise(su.ctx, same); err != nil {
+		return fmt.Errorf("CreateExercise with the name of another user's exercise: %w", err)
+	}
+
+	// a custom exercise named like a built-in alias wins for its owner only
+	squats := &store.Exercise{UserID: &owner.ID, Name: "Squats", Category: store.ExerciseCategoryStrength, Measurement: store.MeasurementReps}
+	if err := su.Exercises.CreateExercise(su.ctx, squats); err != nil {
+		return fmt.Errorf("CreateExercise: %w", err)
+	}
+	found, err := su.Exercises.FindExercise(su.ctx, owner.ID, "squats")
+	if err != nil || found.ID != squats.ID {
+		return fmt.Errorf("FindExercise of the owner = %+v, %v, want their own Squats", found, err)
+	}
+	found, err = su.Exercises.FindExercise(su.ctx, other.ID, "squats")
+	if err != nil || found.Name != "Back Squat" {
+		return fmt.Errorf("FindExercise of another user = %+v, %v, want Back Squat", found, err)
+	}
+	return nil
+}
+
+// checkExerciseQueryWildcards makes sure the query filter matches names and
+// aliases literally, including the wildcards of SQL LIKE patterns.
+func checkExerciseQueryWildcards(su *suite) error {
+	user, err := su.newUser("lifter")
+	if err != nil {
+		return err
+	}
+	for _, e := range []*store.Exercise{
+		{Name: "Hold 50%", Aliases: []string{"Side_Plank"}},
+		{Name: "Hold 500", Aliases: []string{"Side-Plank"}},
+	} {
+		e.UserID, e.Category, e.PrimaryMuscles, e.Measurement = &user.ID, store.ExerciseCategoryStrength, []string{"core"}, store.MeasurementDuration
+		if err := su.Exercises.CreateExercise(su.ctx, e); err != nil {
+			return fmt.Errorf("CreateExercise: %w", err)
+		}
+	}
+
+	for query, want := range map[string]string{"50%": "Hold 50%", "e_p": "Hold 50%"} {
+		got, err := su.Exercises.ListExercises(su.ctx, store.ExerciseFilter{UserID: user.ID, Query: query})
+		if err != nil {
+			return fmt.Errorf("ListExercises: %w", err)
+		}
+		if !slices.Equal(exerciseNames(got), []string{want}) {
+			return fmt.Errorf("query filter %q returned %v, want %s", query, exerciseNames(got), want)
+		}
+	}
+	return nil
+}
+
+func checkExerciseEntries(su *suite) error {
+	user, err := su.newUser("linked")
+	if err != nil {
+		return err
+	}
+	deadlift, err := su.Exercises.FindExercise(su.ctx, user.ID, "Deadlift")
+	if err != nil {
+		return fmt.Errorf("FindExercise: %w", err)
+	}
+	workout := newWorkout(user.ID, "Linked", baseTime)
+	workout.Entries[0].ExerciseID = &deadlift.ID
+	created, err := su.Workouts.CreateWorkout(su.ctx, workout)
+	if err != nil {
+		return fmt.Errorf("CreateWorkout: %w", err)
+	}
+	got, err := su.Workouts.GetWorkoutByID(su.ctx, int64(created.ID))
+	if err != nil {
+		return fmt.Errorf("GetWorkoutByID: %w", err)
+	}
+	for _, entry := range got.Entries {
+		linked := entry.ExerciseID != nil && *entry.ExerciseID == deadlift.ID
+		if linked != (entry.ExerciseName == "Deadlift") {
+			return fmt.Errorf("entry %q has exercise id %v, want only Deadlift linked to %d", entry.ExerciseName, entry.ExerciseID, deadlift.ID)
+		}
+	}
+	return nil
+}
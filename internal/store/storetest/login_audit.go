@@ -0,0 +1,42 @@
+package storetest
+
+import (
+	"fmt"
+
+	"github.com/syafae/femProject/internal/store"
+)
+
+func checkFailedLogins(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	known := &store.FailedLogin{
+		UserName:  user.UserName,
+		UserID:    &user.ID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Reason:    store.LoginFailureInvalidPassword,
+	}
+	if err := su.LoginAudit.RecordFailedLogin(su.ctx, known); err != nil {
+		return fmt.Errorf("RecordFailedLogin: %w", err)
+	}
+	if known.ID == 0 || known.CreatedAt.IsZero() {
+		return fmt.Errorf("RecordFailedLogin did not set the id and creation time: %+v", known)
+	}
+
+	// attempts for unknown usernames are recorded without a user
+	unknown := &store.FailedLogin{
+		UserName:  su.prefix + "_nobody",
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Reason:    store.LoginFailureUnknownUser,
+	}
+	if err := su.LoginAudit.RecordFailedLogin(su.ctx, unknown); err != nil {
+		return fmt.Errorf("RecordFailedLogin without a user: %w", err)
+	}
+	if unknown.ID == 0 || unknown.ID == known.ID || unknown.CreatedAt.IsZero() {
+		return fmt.Errorf("RecordFailedLogin without a user = %+v, want a new record", unknown)
+	}
+	return nil
+}
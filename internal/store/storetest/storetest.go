@@ -0,0 +1,154 @@
+// Package storetest checks that a store backend behaves like the others.
+// Every backend must pass Run, called from the backend's tests. The checks
+// only touch rows they create themselves, under random usernames, so they
+// can run against a database that is already in use.
+package storetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/syafae/femProject/internal/store"
+)
+
+// Stores are the stores of one backend under test. They must share their
+// data, like stores opened on the same database do.
+type Stores struct {
+	Workouts   store.WorkoutStore
+	Users      store.UserStore
+	Tokens     store.TokenStore
+	Exercises  store.ExerciseStore
+	APIKeys    store.APIKeyStore
+	LoginAudit store.LoginAuditStore
+}
+
+type check struct {
+	name string
+	run  func(*suite) error
+}
+
+var checks = []check{
+	{"workouts/create and get", checkWorkoutCreateAndGet},
+	{"workouts/not found", checkWorkoutNotFound},
+	{"workouts/ownership", checkWorkoutOwnership},
+	{"workouts/update", checkWorkoutUpdate},
+	{"workouts/delete", checkWorkoutDelete},
+	{"workouts/list filters", checkWorkoutListFilters},
+	{"workouts/list wildcards", checkWorkoutListWildcards},
+	{"workouts/list pages", checkWorkoutListPages},
+
+	{"exercises/catalog", checkExerciseCatalog},
+	{"exercises/custom", checkExerciseCustom},
+	{"exercises/query wildcards", checkExerciseQueryWildcards},
+	{"exercises/workout entries", checkExerciseEntries},
+
+	{"users/create and get", checkUserCreateAndGet},
+	{"users/unique", checkUserUnique},
+	{"users/not found", checkUserNotFound},
+	{"users/update", checkUserUpdate},
+	{"users/administration", checkUserAdministration},
+	{"users/list", checkUserList},
+	{"users/two-factor", checkUserTwoFactor},
+
+	{"tokens/user token", checkUserToken},
+	{"tokens/get by hash", checkTokenGetByHash},
+	{"tokens/rotate", checkTokenRotate},
+	{"tokens/expired refresh", checkTokenExpiredRefresh},
+	{"tokens/sessions", checkTokenSessions},
+	{"tokens/delete", checkTokenDelete},
+	{"tokens/purge expired", checkTokenPurgeExpired},
+
+	{"api keys/create and use", checkAPIKeyCreateAndUse},
+	{"api keys/expired", checkAPIKeyExpired},
+	{"api keys/delete", checkAPIKeyDelete},
+
+	{"login audit/failed logins", checkFailedLogins},
+}
+
+// Run runs every check against s as a subtest of t. A failing check does
+// not stop the others.
+func Run(t *testing.T, s Stores) {
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			su, err := newSuite(t.Context(), s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.run(su); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// suite is the state of one check.
+type suite struct {
+	ctx context.Context
+	Stores
+	// prefix makes the usernames and emails of this check unique.
+	prefix string
+}
+
+func newSuite(ctx context.Context, s Stores) (*suite, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &suite{ctx: ctx, Stores: s, prefix: "st_" + hex.EncodeToString(b)}, nil
+}
+
+// userInput returns an unsaved user whose password is "password-"+name.
+func (su *suite) userInput(name string) (*store.User, error) {
+	user := &store.User{
+		UserName: su.prefix + "_" + name,
+		Email:    su.prefix + "_" + name + "@example.com",
+		Bio:      "created by storetest",
+	}
+	if _, err := user.PasswordHash.Set("password-" + name); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// newUser creates the user of userInput.
+func (su *suite) newUser(name string) (*store.User, error) {
+	user, err := su.userInput(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := su.Users.CreateUser(su.ctx, user); err != nil {
+		return nil, fmt.Errorf("CreateUser: %w", err)
+	}
+	return user, nil
+}
+
+// expectErr reports an error unless err matches target.
+func expectErr(call string, err, target error) error {
+	if !errors.Is(err, target) {
+		return fmt.Errorf("%s: got error %v, want %v", call, err, target)
+	}
+	return nil
+}
+
+// sameTime compares times that went through the store, which may have
+// rounded them to within precision.
+func sameTime(got, want time.Time, precision time.Duration) bool {
+	d := got.Sub(want)
+	return d > -precision && d < precision
+}
+
+// missingID is an id no check ever creates.
+const missingID = 2147483000
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,288 @@
+package storetest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/syafae/femProject/internal/store"
+	"github.com/syafae/femProject/internal/tokens"
+)
+
+var client = tokens.Client{UserAgent: "storetest", IP: "192.0.2.1", DeviceLabel: "laptop"}
+
+func checkUserToken(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	token, err := su.Tokens.CreateNewToken(su.ctx, user.ID, time.Hour, tokens.ScopeActivation)
+	if err != nil {
+		return fmt.Errorf("CreateNewToken: %w", err)
+	}
+	got, err := su.Users.GetUserToken(su.ctx, tokens.ScopeActivation, token.Plaintext)
+	if err != nil {
+		return fmt.Errorf("GetUserToken: %w", err)
+	}
+	if got.ID != user.ID {
+		return fmt.Errorf("GetUserToken returned user %d, want %d", got.ID, user.ID)
+	}
+	_, err = su.Users.GetUserToken(su.ctx, tokens.ScopeAuth, token.Plaintext)
+	if err := expectErr("GetUserToken with another scope", err, store.ErrNotFound); err != nil {
+		return err
+	}
+
+	expired, err := tokens.GenerateToken(user.ID, -time.Hour, tokens.ScopeActivation)
+	if err != nil {
+		return err
+	}
+	if err := su.Tokens.InsertToken(su.ctx, expired); err != nil {
+		return fmt.Errorf("InsertToken: %w", err)
+	}
+	_, err = su.Users.GetUserToken(su.ctx, tokens.ScopeActivation, expired.Plaintext)
+	return expectErr("GetUserToken with an expired token", err, store.ErrNotFound)
+}
+
+func checkTokenGetByHash(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	auth, refresh, err := su.Tokens.CreateTokenPair(su.ctx, user.ID, time.Hour, 24*time.Hour, client)
+	if err != nil {
+		return fmt.Errorf("CreateTokenPair: %w", err)
+	}
+	if auth.Family == "" || auth.Family != refresh.Family {
+		return fmt.Errorf("CreateTokenPair families %q and %q, want one shared family", auth.Family, refresh.Family)
+	}
+
+	got, err := su.Tokens.GetTokenByHash(su.ctx, refresh.Hash)
+	if err != nil {
+		return fmt.Errorf("GetTokenByHash: %w", err)
+	}
+	// expiry is stored with second precision
+	if got.UserID != user.ID || got.Scope != tokens.ScopeRefresh || got.Family != refresh.Family ||
+		got.Client != client || got.UsedAt != nil || !sameTime(got.Expiry, refresh.Expiry, time.Second) {
+		return fmt.Errorf("GetTokenByHash = %+v, want the refresh token", got)
+	}
+
+	if err := su.Tokens.TouchToken(su.ctx, auth.Hash, tokens.Client{UserAgent: "phone", IP: "192.0.2.2"}); err != nil {
+		return fmt.Errorf("TouchToken: %w", err)
+	}
+	got, err = su.Tokens.GetTokenByHash(su.ctx, auth.Hash)
+	if err != nil {
+		return fmt.Errorf("GetTokenByHash: %w", err)
+	}
+	if got.LastUsedAt == nil || got.UserAgent != "phone" || got.IP != "192.0.2.2" || got.DeviceLabel != "laptop" {
+		return fmt.Errorf("after TouchToken the token is %+v, want the new client with the old device label", got)
+	}
+
+	_, err = su.Tokens.GetTokenByHash(su.ctx, tokens.HashPlaintext(su.prefix))
+	return expectErr("GetTokenByHash with an unknown hash", err, store.ErrNotFound)
+}
+
+func checkTokenRotate(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	auth, refresh, err := su.Tokens.CreateTokenPair(su.ctx, user.ID, time.Hour, 24*time.Hour, client)
+	if err != nil {
+		return fmt.Errorf("CreateTokenPair: %w", err)
+	}
+
+	newAuth, newRefresh, err := su.Tokens.RotateRefreshToken(su.ctx, refresh.Plaintext, time.Hour, 24*time.Hour, tokens.Client{UserAgent: "storetest"})
+	if err != nil {
+		return fmt.Errorf("RotateRefreshToken: %w", err)
+	}
+	if newAuth.Family != refresh.Family || newRefresh.Family != refresh.Family || newAuth.DeviceLabel != "laptop" {
+		return fmt.Errorf("rotated tokens %+v and %+v, want the same family and device label", newAuth, newRefresh)
+	}
+	_, err = su.Tokens.GetTokenByHash(su.ctx, auth.Hash)
+	if err := expectErr("GetTokenByHash of the replaced authentication token", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	used, err := su.Tokens.GetTokenByHash(su.ctx, refresh.Hash)
+	if err != nil || used.UsedAt == nil {
+		return fmt.Errorf("the rotated refresh token is not marked as used: %v", err)
+	}
+
+	_, _, err = su.Tokens.RotateRefreshToken(su.ctx, refresh.Plaintext, time.Hour, 24*time.Hour, client)
+	if err := expectErr("RotateRefreshToken with a used token", err, store.ErrTokenReused); err != nil {
+		return err
+	}
+	_, err = su.Tokens.GetTokenByHash(su.ctx, newRefresh.Hash)
+	if err := expectErr("GetTokenByHash after reuse revoked the family", err, store.ErrNotFound); err != nil {
+		return err
+	}
+
+	_, _, err = su.Tokens.RotateRefreshToken(su.ctx, su.prefix, time.Hour, 24*time.Hour, client)
+	if err := expectErr("RotateRefreshToken with an unknown token", err, store.ErrInvalidToken); err != nil {
+		return err
+	}
+	other, _, err := su.Tokens.CreateTokenPair(su.ctx, user.ID, time.Hour, 24*time.Hour, client)
+	if err != nil {
+		return fmt.Errorf("CreateTokenPair: %w", err)
+	}
+	_, _, err = su.Tokens.RotateRefreshToken(su.ctx, other.Plaintext, time.Hour, 24*time.Hour, client)
+	return expectErr("RotateRefreshToken with an authentication token", err, store.ErrInvalidToken)
+}
+
+func checkTokenExpiredRefresh(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	refresh, err := tokens.GenerateToken(user.ID, -time.Hour, tokens.ScopeRefresh)
+	if err != nil {
+		return err
+	}
+	if refresh.Family, err = tokens.GenerateFamily(); err != nil {
+		return err
+	}
+	if err := su.Tokens.InsertToken(su.ctx, refresh); err != nil {
+		return fmt.Errorf("InsertToken: %w", err)
+	}
+	_, _, err = su.Tokens.RotateRefreshToken(su.ctx, refresh.Plaintext, time.Hour, 24*time.Hour, client)
+	return expectErr("RotateRefreshToken with an expired token", err, store.ErrInvalidToken)
+}
+
+func checkTokenSessions(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	other, err := su.newUser("bob")
+	if err != nil {
+		return err
+	}
+	first, firstRefresh, err := su.Tokens.CreateTokenPair(su.ctx, user.ID, time.Hour, 24*time.Hour, client)
+	if err != nil {
+		return fmt.Errorf("CreateTokenPair: %w", err)
+	}
+	second, _, err := su.Tokens.CreateTokenPair(su.ctx, user.ID, time.Hour, 24*time.Hour, tokens.Client{DeviceLabel: "phone"})
+	if err != nil {
+		return fmt.Errorf("CreateTokenPair: %w", err)
+	}
+	// using the first session makes it the most recent one
+	if err := su.Tokens.TouchToken(su.ctx, first.Hash, client); err != nil {
+		return fmt.Errorf("TouchToken: %w", err)
+	}
+
+	sessions, err := su.Tokens.ListSessions(su.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("ListSessions: %w", err)
+	}
+	if len(sessions) != 2 || sessions[0].DeviceLabel != "laptop" || sessions[1].DeviceLabel != "phone" || sessions[0].LastUsedAt == nil {
+		return fmt.Errorf("ListSessions = %+v, want the laptop then the phone session", sessions)
+	}
+
+	if err := expectErr("DeleteSession of another user", su.Tokens.DeleteSession(su.ctx, other.ID, sessions[0].ID), store.ErrNotFound); err != nil {
+		return err
+	}
+	// only sessions can be revoked through DeleteSession
+	activation, err := su.Tokens.CreateNewToken(su.ctx, user.ID, time.Hour, tokens.ScopeActivation)
+	if err != nil {
+		return fmt.Errorf("CreateNewToken: %w", err)
+	}
+	if activation, err = su.Tokens.GetTokenByHash(su.ctx, activation.Hash); err != nil {
+		return fmt.Errorf("GetTokenByHash: %w", err)
+	}
+	if err := expectErr("DeleteSession of an activation token", su.Tokens.DeleteSession(su.ctx, user.ID, activation.ID), store.ErrNotFound); err != nil {
+		return err
+	}
+	refresh, err := su.Tokens.GetTokenByHash(su.ctx, firstRefresh.Hash)
+	if err != nil {
+		return fmt.Errorf("GetTokenByHash: %w", err)
+	}
+	if err := expectErr("DeleteSession of a refresh token", su.Tokens.DeleteSession(su.ctx, user.ID, refresh.ID), store.ErrNotFound); err != nil {
+		return err
+	}
+	if err := su.Tokens.DeleteSession(su.ctx, user.ID, sessions[0].ID); err != nil {
+		return fmt.Errorf("DeleteSession: %w", err)
+	}
+	_, err = su.Tokens.GetTokenByHash(su.ctx, firstRefresh.Hash)
+	if err := expectErr("GetTokenByHash of the deleted session's refresh token", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	if err := expectErr("second DeleteSession", su.Tokens.DeleteSession(su.ctx, user.ID, sessions[0].ID), store.ErrNotFound); err != nil {
+		return err
+	}
+	if _, err := su.Tokens.GetTokenByHash(su.ctx, second.Hash); err != nil {
+		return fmt.Errorf("DeleteSession removed another session: %w", err)
+	}
+	return nil
+}
+
+func checkTokenDelete(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	auth, refresh, err := su.Tokens.CreateTokenPair(su.ctx, user.ID, time.Hour, 24*time.Hour, client)
+	if err != nil {
+		return fmt.Errorf("CreateTokenPair: %w", err)
+	}
+	if err := su.Tokens.DeleteAllTokensForUser(su.ctx, user.ID, tokens.ScopeAuth); err != nil {
+		return fmt.Errorf("DeleteAllTokensForUser: %w", err)
+	}
+	_, err = su.Tokens.GetTokenByHash(su.ctx, auth.Hash)
+	if err := expectErr("GetTokenByHash after DeleteAllTokensForUser", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	if _, err := su.Tokens.GetTokenByHash(su.ctx, refresh.Hash); err != nil {
+		return fmt.Errorf("DeleteAllTokensForUser removed a token of another scope: %w", err)
+	}
+
+	if err := su.Tokens.DeleteTokenFamily(su.ctx, refresh.Family); err != nil {
+		return fmt.Errorf("DeleteTokenFamily: %w", err)
+	}
+	_, err = su.Tokens.GetTokenByHash(su.ctx, refresh.Hash)
+	if err := expectErr("GetTokenByHash after DeleteTokenFamily", err, store.ErrNotFound); err != nil {
+		return err
+	}
+
+	single, err := su.Tokens.CreateNewToken(su.ctx, user.ID, time.Hour, tokens.ScopePasswordReset)
+	if err != nil {
+		return fmt.Errorf("CreateNewToken: %w", err)
+	}
+	if err := su.Tokens.DeleteToken(su.ctx, single); err != nil {
+		return fmt.Errorf("DeleteToken: %w", err)
+	}
+	_, err = su.Tokens.GetTokenByHash(su.ctx, single.Hash)
+	return expectErr("GetTokenByHash after DeleteToken", err, store.ErrNotFound)
+}
+
+func checkTokenPurgeExpired(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	expired, err := tokens.GenerateToken(user.ID, -time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		return err
+	}
+	if err := su.Tokens.InsertToken(su.ctx, expired); err != nil {
+		return fmt.Errorf("InsertToken: %w", err)
+	}
+	live, err := su.Tokens.CreateNewToken(su.ctx, user.ID, time.Hour, tokens.ScopeAuth)
+	if err != nil {
+		return fmt.Errorf("CreateNewToken: %w", err)
+	}
+
+	sessions, err := su.Tokens.ListSessions(su.ctx, user.ID)
+	if err != nil || len(sessions) != 1 {
+		return fmt.Errorf("ListSessions = %d sessions, %v, want only the live one", len(sessions), err)
+	}
+	n, err := su.Tokens.DeleteExpiredTokens(su.ctx)
+	if err != nil || n < 1 {
+		return fmt.Errorf("DeleteExpiredTokens = %d, %v, want at least the expired token", n, err)
+	}
+	_, err = su.Tokens.GetTokenByHash(su.ctx, expired.Hash)
+	if err := expectErr("GetTokenByHash of a purged token", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	if _, err := su.Tokens.GetTokenByHash(su.ctx, live.Hash); err != nil {
+		return fmt.Errorf("DeleteExpiredTokens removed a live token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/syafae/femProject/internal/roles"
+	"github.com/syafae/femProject/internal/store"
+)
+
+func checkUserCreateAndGet(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	if user.ID == 0 || user.CreatedAt.IsZero() {
+		return fmt.Errorf("CreateUser did not set the id and creation time: %+v", user)
+	}
+	if user.Timezone != "UTC" || user.Role != roles.User {
+		return fmt.Errorf("CreateUser defaults: timezone %q and role %q, want UTC and %s", user.Timezone, user.Role, roles.User)
+	}
+
+	byID, err := su.Users.GetUserByID(su.ctx, int64(user.ID))
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %w", err)
+	}
+	byName, err := su.Users.GetUserByName(su.ctx, user.UserName)
+	if err != nil {
+		return fmt.Errorf("GetUserByName: %w", err)
+	}
+	byEmail, err := su.Users.GetUserByEmail(su.ctx, user.Email)
+	if err != nil {
+		return fmt.Errorf("GetUserByEmail: %w", err)
+	}
+	for _, got := range []*store.User{byID, byName, byEmail} {
+		if got.ID != user.ID || got.UserName != user.UserName || got.Email != user.Email || got.Bio != user.Bio ||
+			got.Activated || got.TwoFactor || got.Disabled || got.Role != roles.User {
+			return fmt.Errorf("got user %+v, want %+v", got, user)
+		}
+	}
+	ok, err := byName.PasswordHash.Matches("password-alice")
+	if err != nil || !ok {
+		return fmt.Errorf("stored password does not match: %v", err)
+	}
+	return nil
+}
+
+func expectConflict(call string, err error, field string) error {
+	var conflict *store.ConflictError
+	if !errors.As(err, &conflict) || conflict.Field != field || !errors.Is(err, store.ErrConflict) {
+		return fmt.Errorf("%s: got error %v, want a conflict on %s", call, err, field)
+	}
+	return nil
+}
+
+func checkUserUnique(su *suite) error {
+	alice, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	bob, err := su.newUser("bob")
+	if err != nil {
+		return err
+	}
+
+	user, err := su.userInput("carol")
+	if err != nil {
+		return err
+	}
+	user.UserName = alice.UserName
+	err = su.Users.CreateUser(su.ctx, user)
+	if err := expectConflict("CreateUser with a taken username", err, "username"); err != nil {
+		return err
+	}
+	user, err = su.userInput("carol")
+	if err != nil {
+		return err
+	}
+	user.Email = alice.Email
+	err = su.Users.CreateUser(su.ctx, user)
+	if err := expectConflict("CreateUser with a taken email", err, "email"); err != nil {
+		return err
+	}
+	bob.UserName = alice.UserName
+	err = su.Users.UpdateUser(su.ctx, bob)
+	return expectConflict("UpdateUser to a taken username", err, "username")
+}
+
+func checkUserNotFound(su *suite) error {
+	_, err := su.Users.GetUserByID(su.ctx, missingID)
+	if err := expectErr("GetUserByID", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	_, err = su.Users.GetUserByName(su.ctx, su.prefix+"_nobody")
+	if err := expectErr("GetUserByName", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	_, err = su.Users.GetUserByEmail(su.ctx, su.prefix+"_nobody@example.com")
+	if err := expectErr("GetUserByEmail", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	err = su.Users.UpdateUser(su.ctx, &store.User{ID: missingID, UserName: su.prefix + "_nobody", Email: su.prefix + "_nobody@example.com"})
+	if err := expectErr("UpdateUser", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	if err := expectErr("SetUserRole", su.Users.SetUserRole(su.ctx, missingID, roles.Admin), store.ErrNotFound); err != nil {
+		return err
+	}
+	if err := expectErr("SetUserDisabled", su.Users.SetUserDisabled(su.ctx, missingID, true), store.ErrNotFound); err != nil {
+		return err
+	}
+	_, err = su.Users.GetTOTPSecret(su.ctx, missingID)
+	return expectErr("GetTOTPSecret", err, store.ErrNotFound)
+}
+
+func checkUserUpdate(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	user.UserName = su.prefix + "_renamed"
+	user.Bio = "new bio"
+	user.Timezone = "Europe/Berlin"
+	user.Activated = true
+	if err := su.Users.UpdateUser(su.ctx, user); err != nil {
+		return fmt.Errorf("UpdateUser: %w", err)
+	}
+	if _, err := user.PasswordHash.Set("a new password"); err != nil {
+		return err
+	}
+	if err := su.Users.UpdatePassword(su.ctx, user); err != nil {
+		return fmt.Errorf("UpdatePassword: %w", err)
+	}
+
+	got, err := su.Users.GetUserByName(su.ctx, su.prefix+"_renamed")
+	if err != nil {
+		return fmt.Errorf("GetUserByName: %w", err)
+	}
+	if got.ID != user.ID || got.Bio != "new bio" || got.Timezone != "Europe/Berlin" || !got.Activated {
+		return fmt.Errorf("GetUserByName = %+v, want the updated fields", got)
+	}
+	ok, err := got.PasswordHash.Matches("a new password")
+	if err != nil || !ok {
+		return fmt.Errorf("updated password does not match: %v", err)
+	}
+	return nil
+}
+
+func checkUserAdministration(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	if err := su.Users.SetUserRole(su.ctx, user.ID, roles.Coach); err != nil {
+		return fmt.Errorf("SetUserRole: %w", err)
+	}
+	if err := su.Users.SetUserDisabled(su.ctx, user.ID, true); err != nil {
+		return fmt.Errorf("SetUserDisabled: %w", err)
+	}
+	got, err := su.Users.GetUserByID(su.ctx, int64(user.ID))
+	if err != nil {
+		return fmt.Errorf("GetUserByID: %w", err)
+	}
+	if got.Role != roles.Coach || !got.Disabled {
+		return fmt.Errorf("role %q and disabled %v, want %s and true", got.Role, got.Disabled, roles.Coach)
+	}
+	return nil
+}
+
+func checkUserList(su *suite) error {
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := su.newUser(name); err != nil {
+			return err
+		}
+	}
+	all, err := su.Users.ListUsers(su.ctx, 1000, 0)
+	if err != nil {
+		return fmt.Errorf("ListUsers: %w", err)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].ID >= all[i].ID {
+			return fmt.Errorf("ListUsers is not ordered by id: %d before %d", all[i-1].ID, all[i].ID)
+		}
+	}
+	page, err := su.Users.ListUsers(su.ctx, 2, 1)
+	if err != nil {
+		return fmt.Errorf("ListUsers: %w", err)
+	}
+	if len(page) != 2 || page[0].ID != all[1].ID || page[1].ID != all[2].ID {
+		return fmt.Errorf("ListUsers(2, 1) does not return the second and third user")
+	}
+	return nil
+}
+
+func checkUserTwoFactor(su *suite) error {
+	user, err := su.newUser("alice")
+	if err != nil {
+		return err
+	}
+	secret, err := su.Users.GetTOTPSecret(su.ctx, user.ID)
+	if err != nil || secret != nil {
+		return fmt.Errorf("GetTOTPSecret before enrollment = %v, %v, want nil", secret, err)
+	}
+	if err := expectErr("EnableTOTP before enrollment", su.Users.EnableTOTP(su.ctx, user.ID, 1), store.ErrNotFound); err != nil {
+		return err
+	}
+
+	codeA, codeB := []byte("recovery code a"), []byte("recovery code b")
+	if err := su.Users.BeginTOTPEnrollment(su.ctx, user.ID, []byte("encrypted"), [][]byte{codeA, codeB}); err != nil {
+		return fmt.Errorf("BeginTOTPEnrollment: %w", err)
+	}
+	secret, err = su.Users.GetTOTPSecret(su.ctx, user.ID)
+	if err != nil || !bytes.Equal(secret, []byte("encrypted")) {
+		return fmt.Errorf("GetTOTPSecret = %q, %v, want the stored secret", secret, err)
+	}
+	if err := su.Users.EnableTOTP(su.ctx, user.ID, 10); err != nil {
+		return fmt.Errorf("EnableTOTP: %w", err)
+	}
+	got, err := su.Users.GetUserByID(su.ctx, int64(user.ID))
+	if err != nil || !got.TwoFactor {
+		return fmt.Errorf("two-factor is not enabled after EnableTOTP: %v", err)
+	}
+
+	for _, step := range []struct {
+		step int64
+		want bool
+	}{{10, false}, {9, false}, {11, true}, {11, false}} {
+		ok, err := su.Users.AdvanceTOTPStep(su.ctx, user.ID, step.step)
+		if err != nil || ok != step.want {
+			return fmt.Errorf("AdvanceTOTPStep(%d) = %v, %v, want %v", step.step, ok, err, step.want)
+		}
+	}
+	for _, use := range []struct {
+		code []byte
+		want bool
+	}{{codeA, true}, {codeA, false}, {[]byte("unknown"), false}} {
+		ok, err := su.Users.UseRecoveryCode(su.ctx, user.ID, use.code)
+		if err != nil || ok != use.want {
+			return fmt.Errorf("UseRecoveryCode(%q) = %v, %v, want %v", use.code, ok, err, use.want)
+		}
+	}
+
+	if err := su.Users.DisableTOTP(su.ctx, user.ID); err != nil {
+		return fmt.Errorf("DisableTOTP: %w", err)
+	}
+	got, err = su.Users.GetUserByID(su.ctx, int64(user.ID))
+	if err != nil || got.TwoFactor {
+		return fmt.Errorf("two-factor is still enabled after DisableTOTP: %v", err)
+	}
+	secret, err = su.Users.GetTOTPSecret(su.ctx, user.ID)
+	if err != nil || secret != nil {
+		return fmt.Errorf("GetTOTPSecret after DisableTOTP = %v, %v, want nil", secret, err)
+	}
+	ok, err := su.Users.UseRecoveryCode(su.ctx, user.ID, codeB)
+	if err != nil || ok {
+		return fmt.Errorf("recovery codes survived DisableTOTP: %v", err)
+	}
+	return nil
+}
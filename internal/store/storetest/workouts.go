@@ -0,0 +1,349 @@
+package storetest
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/syafae/femProject/internal/store"
+)
+
+// baseTime is a whole second so performed_at survives any rounding.
+var baseTime = time.Date(2025, time.March, 10, 7, 30, 0, 0, time.UTC)
+
+func newWorkout(userID int, title string, performedAt time.Time) *store.Workout {
+	return &store.Workout{
+		UserID:          userID,
+		Title:           title,
+		Description:     "morning session",
+		DurationMinutes: 45,
+		CaloriesBurned:  300,
+		PerformedAt:     performedAt,
+		Entries: []store.WorkoutEntry{
+			{ExerciseName: "Deadlift", Sets: 3, Reps: intPtr(5), Weight: floatPtr(140.5), OrderIndex: 2},
+			{ExerciseName: "Squat", Sets: 5, Reps: intPtr(5), Weight: floatPtr(100), Notes: "felt strong", OrderIndex: 0},
+			{ExerciseName: "Plank", Sets: 3, DurationSeconds: intPtr(60), OrderIndex: 1},
+		},
+	}
+}
+
+func checkWorkoutCreateAndGet(su *suite) error {
+	user, err := su.newUser("athlete")
+	if err != nil {
+		return err
+	}
+	workout := newWorkout(user.ID, "Strength", baseTime)
+	workout.Entries = append(workout.Entries, store.WorkoutEntry{
+		ExerciseName: "Rowing", Sets: 1, DurationSeconds: intPtr(480), DistanceMeters: floatPtr(2000.5), OrderIndex: 3,
+	})
+	created, err := su.Workouts.CreateWorkout(su.ctx, workout)
+	if err != nil {
+		return fmt.Errorf("CreateWorkout: %w", err)
+	}
+	if created.ID == 0 || created.CreatedAt.IsZero() {
+		return fmt.Errorf("CreateWorkout did not set the id and creation time: %+v", created)
+	}
+	for _, entry := range created.Entries {
+		if entry.ID == 0 {
+			return fmt.Errorf("CreateWorkout did not set the id of entry %q", entry.ExerciseName)
+		}
+	}
+
+	got, err := su.Workouts.GetWorkoutByID(su.ctx, int64(created.ID))
+	if err != nil {
+		return fmt.Errorf("GetWorkoutByID: %w", err)
+	}
+	if got.UserID != user.ID || got.Title != "Strength" || got.Description != "morning session" ||
+		got.DurationMinutes != 45 || got.CaloriesBurned != 300 || !got.PerformedAt.Equal(baseTime) {
+		return fmt.Errorf("GetWorkoutByID = %+v, want the created workout", got)
+	}
+	var names []string
+	for _, entry := range got.Entries {
+		names = append(names, entry.ExerciseName)
+	}
+	if want := []string{"Squat", "Plank", "Deadlift", "Rowing"}; !slices.Equal(names, want) {
+		return fmt.Errorf("entries are %v, want %v ordered by order_index", names, want)
+	}
+	squat, plank, rowing := got.Entries[0], got.Entries[1], got.Entries[3]
+	if squat.Reps == nil || *squat.Reps != 5 || squat.Weight == nil || *squat.Weight != 100 || squat.Notes != "felt strong" {
+		return fmt.Errorf("squat entry = %+v, want 5 reps at 100 with notes", squat)
+	}
+	if plank.Reps != nil || plank.Weight != nil || plank.DistanceMeters != nil || plank.DurationSeconds == nil || *plank.DurationSeconds != 60 {
+		return fmt.Errorf("plank entry = %+v, want a timed entry of 60 seconds", plank)
+	}
+	if rowing.DistanceMeters == nil || *rowing.DistanceMeters != 2000.5 || rowing.DurationSeconds == nil || *rowing.DurationSeconds != 480 {
+		return fmt.Errorf("rowing entry = %+v, want 2000.5 meters in 480 seconds", rowing)
+	}
+	return nil
+}
+
+func checkWorkoutNotFound(su *suite) error {
+	_, err := su.Workouts.GetWorkoutByID(su.ctx, missingID)
+	if err := expectErr("GetWorkoutByID", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	_, err = su.Workouts.GetWorkoutOwnerID(su.ctx, missingID)
+	if err := expectErr("GetWorkoutOwnerID", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	err = su.Workouts.UpdateWorkout(su.ctx, &store.Workout{ID: missingID, Title: "missing", DurationMinutes: 1})
+	if err := expectErr("UpdateWorkout", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	return expectErr("DeleteWorkout", su.Workouts.DeleteWorkout(su.ctx, missingID), store.ErrNotFound)
+}
+
+func checkWorkoutOwnership(su *suite) error {
+	owner, err := su.newUser("owner")
+	if err != nil {
+		return err
+	}
+	other, err := su.newUser("other")
+	if err != nil {
+		return err
+	}
+	workout, err := su.Workouts.CreateWorkout(su.ctx, newWorkout(owner.ID, "Mine", baseTime))
+	if err != nil {
+		return fmt.Errorf("CreateWorkout: %w", err)
+	}
+
+	ownerID, err := su.Workouts.GetWorkoutOwnerID(su.ctx, int64(workout.ID))
+	if err != nil {
+		return fmt.Errorf("GetWorkoutOwnerID: %w", err)
+	}
+	if ownerID != owner.ID {
+		return fmt.Errorf("GetWorkoutOwnerID = %d, want %d", ownerID, owner.ID)
+	}
+	workouts, _, err := su.Workouts.ListWorkouts(su.ctx, store.WorkoutFilter{UserID: other.ID, Limit: 10})
+	if err != nil {
+		return fmt.Errorf("ListWorkouts: %w", err)
+	}
+	if len(workouts) != 0 {
+		return fmt.Errorf("ListWorkouts for another user returned %d workouts", len(workouts))
+	}
+	return nil
+}
+
+func checkWorkoutUpdate(su *suite) error {
+	owner, err := su.newUser("owner")
+	if err != nil {
+		return err
+	}
+	other, err := su.newUser("other")
+	if err != nil {
+		return err
+	}
+	workout, err := su.Workouts.CreateWorkout(su.ctx, newWorkout(owner.ID, "Before", baseTime))
+	if err != nil {
+		return fmt.Errorf("CreateWorkout: %w", err)
+	}
+	oldEntryID := workout.Entries[0].ID
+
+	workout.Title = "After"
+	workout.DurationMinutes = 30
+	workout.PerformedAt = baseTime.Add(time.Hour)
+	// an update never changes the owner
+	workout.UserID = other.ID
+	workout.Entries = []store.WorkoutEntry{{ExerciseName: "Row", Sets: 1, DurationSeconds: intPtr(600), OrderIndex: 0}}
+	if err := su.Workouts.UpdateWorkout(su.ctx, workout); err != nil {
+		return fmt.Errorf("UpdateWorkout: %w", err)
+	}
+
+	got, err := su.Workouts.GetWorkoutByID(su.ctx, int64(workout.ID))
+	if err != nil {
+		return fmt.Errorf("GetWorkoutByID: %w", err)
+	}
+	if got.Title != "After" || got.DurationMinutes != 30 || !got.PerformedAt.Equal(baseTime.Add(time.Hour)) {
+		return fmt.Errorf("GetWorkoutByID = %+v, want the updated fields", got)
+	}
+	if got.UserID != owner.ID {
+		return fmt.Errorf("owner changed to %d by an update, want %d", got.UserID, owner.ID)
+	}
+	if len(got.Entries) != 1 || got.Entries[0].ExerciseName != "Row" || got.Entries[0].ID == oldEntryID {
+		return fmt.Errorf("entries = %+v, want only the new Row entry", got.Entries)
+	}
+	return nil
+}
+
+func checkWorkoutDelete(su *suite) error {
+	user, err := su.newUser("athlete")
+	if err != nil {
+		return err
+	}
+	workout, err := su.Workouts.CreateWorkout(su.ctx, newWorkout(user.ID, "Gone", baseTime))
+	if err != nil {
+		return fmt.Errorf("CreateWorkout: %w", err)
+	}
+	if err := su.Workouts.DeleteWorkout(su.ctx, int64(workout.ID)); err != nil {
+		return fmt.Errorf("DeleteWorkout: %w", err)
+	}
+	_, err = su.Workouts.GetWorkoutByID(su.ctx, int64(workout.ID))
+	if err := expectErr("GetWorkoutByID after DeleteWorkout", err, store.ErrNotFound); err != nil {
+		return err
+	}
+	return expectErr("second DeleteWorkout", su.Workouts.DeleteWorkout(su.ctx, int64(workout.ID)), store.ErrNotFound)
+}
+
+// createSeries creates five workouts a day apart with durations 10 to 50
+// minutes and returns their ids in that order.
+func (su *suite) createSeries(userID int) ([]int, error) {
+	var ids []int
+	for i := range 5 {
+		workout := newWorkout(userID, fmt.Sprintf("Session %d", i), baseTime.AddDate(0, 0, i))
+		if i%2 == 0 {
+			workout.Title = fmt.Sprintf("Easy RUN %d", i)
+			workout.Entries = []store.WorkoutEntry{{ExerciseName: "Running", Sets: 1, DurationSeconds: intPtr(600), OrderIndex: 0}}
+		}
+		workout.DurationMinutes = (i + 1) * 10
+		workout.CaloriesBurned = 500 - i*100
+		created, err := su.Workouts.CreateWorkout(su.ctx, workout)
+		if err != nil {
+			return nil, fmt.Errorf("CreateWorkout: %w", err)
+		}
+		ids = append(ids, created.ID)
+	}
+	return ids, nil
+}
+
+func workoutIDs(workouts []*store.Workout) []int {
+	ids := make([]int, len(workouts))
+	for i, w := range workouts {
+		ids[i] = w.ID
+	}
+	return ids
+}
+
+func checkWorkoutListFilters(su *suite) error {
+	user, err := su.newUser("athlete")
+	if err != nil {
+		return err
+	}
+	ids, err := su.createSeries(user.ID)
+	if err != nil {
+		return err
+	}
+	from, to := baseTime.AddDate(0, 0, 1), baseTime.AddDate(0, 0, 3)
+
+	for _, tc := range []struct {
+		name   string
+		filter store.WorkoutFilter
+		want   []int
+	}{
+		{"no filter", store.WorkoutFilter{}, ids},
+		{"title ignores case", store.WorkoutFilter{Title: "run"}, []int{ids[0], ids[2], ids[4]}},
+		{"exercise", store.WorkoutFilter{Exercise: "squat"}, []int{ids[1], ids[3]}},
+		{"from is inclusive, to exclusive", store.WorkoutFilter{From: &from, To: &to}, []int{ids[1], ids[2]}},
+		{"duration range", store.WorkoutFilter{MinDuration: intPtr(20), MaxDuration: intPtr(40)}, []int{ids[1], ids[2], ids[3]}},
+		{"by calories", store.WorkoutFilter{SortBy: store.WorkoutSortCalories}, []int{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+		{"newest first", store.WorkoutFilter{SortBy: store.WorkoutSortDate, SortDesc: true}, []int{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+	} {
+		filter := tc.filter
+		filter.UserID, filter.Limit = user.ID, 10
+		workouts, cursor, err := su.Workouts.ListWorkouts(su.ctx, filter)
+		if err != nil {
+			return fmt.Errorf("%s: ListWorkouts: %w", tc.name, err)
+		}
+		if got := workoutIDs(workouts); !slices.Equal(got, tc.want) || cursor != "" {
+			return fmt.Errorf("%s: ListWorkouts = %v with cursor %q, want %v and no cursor", tc.name, got, cursor, tc.want)
+		}
+		// the entries are loaded for the whole page at once
+		for _, listed := range workouts {
+			got, err := su.Workouts.GetWorkoutByID(su.ctx, int64(listed.ID))
+			if err != nil {
+				return fmt.Errorf("GetWorkoutByID: %w", err)
+			}
+			if !reflect.DeepEqual(listed.Entries, got.Entries) {
+				return fmt.Errorf("%s: workout %d is listed with entries %+v, want %+v", tc.name, listed.ID, listed.Entries, got.Entries)
+			}
+		}
+	}
+	return nil
+}
+
+// checkWorkoutListWildcards makes sure the text filters match their text
+// literally, including the wildcards of SQL LIKE patterns.
+func checkWorkoutListWildcards(su *suite) error {
+	user, err := su.newUser("athlete")
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for i, title := range []string{"100% effort", "1000 effort", "leg_day", "leg-day", `back\slash`, "backslash"} {
+		workout := newWorkout(user.ID, title, baseTime.AddDate(0, 0, i))
+		workout.Entries[0].ExerciseName = title + " drill"
+		created, err := su.Workouts.CreateWorkout(su.ctx, workout)
+		if err != nil {
+			return fmt.Errorf("CreateWorkout: %w", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter store.WorkoutFilter
+		want   []int
+	}{
+		{"title with %", store.WorkoutFilter{Title: "100%"}, []int{ids[0]}},
+		{"title with _", store.WorkoutFilter{Title: "leg_"}, []int{ids[2]}},
+		{`title with \`, store.WorkoutFilter{Title: `k\s`}, []int{ids[4]}},
+		{"exercise with %", store.WorkoutFilter{Exercise: "0% e"}, []int{ids[0]}},
+		{"exercise with _", store.WorkoutFilter{Exercise: "g_d"}, []int{ids[2]}},
+	} {
+		filter := tc.filter
+		filter.UserID, filter.Limit = user.ID, 10
+		workouts, _, err := su.Workouts.ListWorkouts(su.ctx, filter)
+		if err != nil {
+			return fmt.Errorf("%s: ListWorkouts: %w", tc.name, err)
+		}
+		if got := workoutIDs(workouts); !slices.Equal(got, tc.want) {
+			return fmt.Errorf("%s: ListWorkouts = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	return nil
+}
+
+func checkWorkoutListPages(su *suite) error {
+	user, err := su.newUser("athlete")
+	if err != nil {
+		return err
+	}
+	ids, err := su.createSeries(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, desc := range []bool{false, true} {
+		want := slices.Clone(ids)
+		if desc {
+			slices.Reverse(want)
+		}
+		filter := store.WorkoutFilter{UserID: user.ID, SortBy: store.WorkoutSortDuration, SortDesc: desc, Limit: 2}
+		var got []int
+		for page := 0; ; page++ {
+			if page > len(ids) {
+				return fmt.Errorf("ListWorkouts keeps returning a next cursor")
+			}
+			workouts, cursor, err := su.Workouts.ListWorkouts(su.ctx, filter)
+			if err != nil {
+				return fmt.Errorf("ListWorkouts page %d: %w", page, err)
+			}
+			for _, w := range workouts {
+				if len(w.Entries) == 0 {
+					return fmt.Errorf("ListWorkouts returned workout %d without its entries", w.ID)
+				}
+			}
+			got = append(got, workoutIDs(workouts)...)
+			if cursor == "" {
+				break
+			}
+			filter.Cursor = cursor
+		}
+		if !slices.Equal(got, want) {
+			return fmt.Errorf("pages by duration (descending %v) = %v, want %v", desc, got, want)
+		}
+	}
+
+	_, _, err = su.Workouts.ListWorkouts(su.ctx, store.WorkoutFilter{UserID: user.ID, Limit: 2, Cursor: "not a cursor"})
+	return expectErr("ListWorkouts with a bad cursor", err, store.ErrInvalidCursor)
+}
@@ -1,67 +1,340 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/syafae/femProject/internal/tokens"
 )
 
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrTokenReused is returned when an already rotated refresh token is
+	// presented again; the whole token family has been revoked by then.
+	ErrTokenReused = errors.New("refresh token reuse detected")
+)
+
+// Session is the user-facing view of an authentication token. It never
+// carries the token hash.
+type Session struct {
+	ID          int64      `json:"id"`
+	DeviceLabel string     `json:"device_label"`
+	UserAgent   string     `json:"user_agent"`
+	IP          string     `json:"ip"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	Expiry      time.Time  `json:"expiry"`
+	Current     bool       `json:"current"`
+}
+
 type PostgresTokenStore struct {
-	db *sql.DB
+	db      *sql.DB
+	timeout time.Duration
 }
 
-func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
+func NewPostgresTokenStore(db *sql.DB, timeout time.Duration) *PostgresTokenStore {
 	return &PostgresTokenStore{
-		db: db,
+		db:      db,
+		timeout: timeout,
 	}
 }
 
 type TokenStore interface {
-	InsertToken(token *tokens.Token) error
-	CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error)
-	DeleteAllTokensForUser(userID int, scope string) error
-	DeleteToken(token *tokens.Token) error
-	GetTokenByHash(hash []byte) (*tokens.Token, error)
+	InsertToken(ctx context.Context, token *tokens.Token) error
+	CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error)
+	CreateTokenPair(ctx context.Context, userID int, authTTL, refreshTTL time.Duration, client tokens.Client) (*tokens.Token, *tokens.Token, error)
+	RotateRefreshToken(ctx context.Context, plaintext string, authTTL, refreshTTL time.Duration, client tokens.Client) (*tokens.Token, *tokens.Token, error)
+	DeleteAllTokensForUser(ctx context.Context, userID int, scope string) error
+	DeleteToken(ctx context.Context, token *tokens.Token) error
+	DeleteTokenFamily(ctx context.Context, family string) error
+	GetTokenByHash(ctx context.Context, hash []byte) (*tokens.Token, error)
+	TouchToken(ctx context.Context, hash []byte, client tokens.Client) error
+	ListSessions(ctx context.Context, userID int) ([]*Session, error)
+	DeleteSession(ctx context.Context, userID int, id int64) error
+	DeleteExpiredTokens(ctx context.Context) (int64, error)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 }
 
-func (p *PostgresTokenStore) InsertToken(token *tokens.Token) error {
-	query := `INSERT INTO tokens (hash, user_id, expiry, scope) VALUES ($1, $2, $3, $4)`
-	_, err := p.db.Exec(query, token.Hash, token.UserID, token.Expiry, token.Scope)
+func insertToken(ctx context.Context, db execer, token *tokens.Token) error {
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope, family, user_agent, ip, device_label)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	family := sql.NullString{String: token.Family, Valid: token.Family != ""}
+	_, err := db.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope, family,
+		token.UserAgent, token.IP, token.DeviceLabel)
 	return err
 }
 
-func (p *PostgresTokenStore) CreateNewToken(userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
+func (p *PostgresTokenStore) InsertToken(ctx context.Context, token *tokens.Token) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.InsertToken")
+	defer func() { end(err) }()
+
+	return insertToken(ctx, p.db, token)
+}
+
+func (p *PostgresTokenStore) CreateNewToken(ctx context.Context, userID int, ttl time.Duration, scope string) (*tokens.Token, error) {
 	token, err := tokens.GenerateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = p.InsertToken(token)
+	err = p.InsertToken(ctx, token)
 	return token, err
 }
 
-func (p *PostgresTokenStore) DeleteAllTokensForUser(userID int, scope string) error {
+// generateTokenPair creates an authentication and a refresh token belonging
+// to family without storing them.
+func generateTokenPair(userID int, family string, authTTL, refreshTTL time.Duration, client tokens.Client) (*tokens.Token, *tokens.Token, error) {
+	auth, err := tokens.GenerateToken(userID, authTTL, tokens.ScopeAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh, err := tokens.GenerateToken(userID, refreshTTL, tokens.ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth.Family, auth.Client = family, client
+	refresh.Family, refresh.Client = family, client
+	return auth, refresh, nil
+}
+
+// CreateTokenPair starts a new token family for a fresh login and returns its
+// authentication and refresh tokens.
+func (p *PostgresTokenStore) CreateTokenPair(ctx context.Context, userID int, authTTL, refreshTTL time.Duration, client tokens.Client) (_, _ *tokens.Token, err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.CreateTokenPair")
+	defer func() { end(err) }()
+
+	family, err := tokens.GenerateFamily()
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, refresh, err := generateTokenPair(userID, family, authTTL, refreshTTL, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if err = insertToken(ctx, tx, auth); err != nil {
+		return nil, nil, err
+	}
+	if err = insertToken(ctx, tx, refresh); err != nil {
+		return nil, nil, err
+	}
+	return auth, refresh, tx.Commit()
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair in the
+// same family. The presented token is marked as used rather than deleted so
+// that presenting it a second time can be detected, in which case the family
+// is revoked and ErrTokenReused is returned. Authentication tokens issued
+// earlier in the family are revoked as well, so a session keeps exactly one
+// live authentication token.
+func (p *PostgresTokenStore) RotateRefreshToken(ctx context.Context, plaintext string, authTTL, refreshTTL time.Duration, client tokens.Client) (_, _ *tokens.Token, err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.RotateRefreshToken")
+	defer func() { end(err) }()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	current := &tokens.Token{Hash: tokens.HashPlaintext(plaintext)}
+	var family sql.NullString
+	query := `SELECT user_id, expiry, scope, family, used_at, device_label FROM tokens WHERE hash = $1 AND scope = $2 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, current.Hash, tokens.ScopeRefresh).
+		Scan(&current.UserID, &current.Expiry, &current.Scope, &family, &current.UsedAt, &current.DeviceLabel)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	current.Family = family.String
+
+	if current.UsedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, current.Family)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+	if !current.Expiry.After(time.Now()) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = $1 WHERE hash = $2`, time.Now(), current.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1 AND scope = $2`, current.Family, tokens.ScopeAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if client.DeviceLabel == "" {
+		client.DeviceLabel = current.DeviceLabel
+	}
+	auth, refresh, err := generateTokenPair(current.UserID, current.Family, authTTL, refreshTTL, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = insertToken(ctx, tx, auth); err != nil {
+		return nil, nil, err
+	}
+	if err = insertToken(ctx, tx, refresh); err != nil {
+		return nil, nil, err
+	}
+	return auth, refresh, tx.Commit()
+}
+
+func (p *PostgresTokenStore) DeleteAllTokensForUser(ctx context.Context, userID int, scope string) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.DeleteAllTokensForUser")
+	defer func() { end(err) }()
+
 	query := `DELETE FROM tokens WHERE user_id = $1 AND scope = $2`
-	_, err := p.db.Exec(query, userID, scope)
+	_, err = p.db.ExecContext(ctx, query, userID, scope)
 	return err
 }
 
-func (p *PostgresTokenStore) DeleteToken(token *tokens.Token) error {
+func (p *PostgresTokenStore) DeleteToken(ctx context.Context, token *tokens.Token) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.DeleteToken")
+	defer func() { end(err) }()
+
 	query := `DELETE FROM tokens WHERE hash = $1`
-	_, err := p.db.Exec(query, token.Hash)
+	_, err = p.db.ExecContext(ctx, query, token.Hash)
+	return err
+}
+
+func (p *PostgresTokenStore) DeleteTokenFamily(ctx context.Context, family string) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.DeleteTokenFamily")
+	defer func() { end(err) }()
+
+	query := `DELETE FROM tokens WHERE family = $1`
+	_, err = p.db.ExecContext(ctx, query, family)
 	return err
 }
 
-func (p *PostgresTokenStore) GetTokenByHash(hash []byte) (*tokens.Token, error) {
-	query := `SELECT user_id, expiry, scope FROM tokens WHERE hash = $1`
+// DeleteExpiredTokens purges tokens past their expiry and returns how many
+// were removed. Expired tokens are already rejected on lookup, so this only
+// keeps the table small.
+func (p *PostgresTokenStore) DeleteExpiredTokens(ctx context.Context) (_ int64, err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.DeleteExpiredTokens")
+	defer func() { end(err) }()
+
+	result, err := p.db.ExecContext(ctx, `DELETE FROM tokens WHERE expiry < $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (p *PostgresTokenStore) GetTokenByHash(ctx context.Context, hash []byte) (_ *tokens.Token, err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.GetTokenByHash")
+	defer func() { end(err) }()
+
+	query := `SELECT id, user_id, expiry, scope, family, used_at, created_at, last_used_at, user_agent, ip, device_label
+	          FROM tokens WHERE hash = $1`
 	token := &tokens.Token{}
-	err := p.db.QueryRow(query, hash).Scan(&token.UserID, &token.Expiry, &token.Scope)
+	var family sql.NullString
+	err = p.db.QueryRowContext(ctx, query, hash).Scan(&token.ID, &token.UserID, &token.Expiry, &token.Scope, &family, &token.UsedAt,
+		&token.CreatedAt, &token.LastUsedAt, &token.UserAgent, &token.IP, &token.DeviceLabel)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, notFound("token")
 	}
 	if err != nil {
 		return nil, err
 	}
 	token.Hash = hash
+	token.Family = family.String
 	return token, nil
 }
+
+// TouchToken records that a token was just used from client. To avoid a
+// write on every request the row is only updated when the client changed or
+// the last recorded use is more than a minute old.
+func (p *PostgresTokenStore) TouchToken(ctx context.Context, hash []byte, client tokens.Client) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.TouchToken")
+	defer func() { end(err) }()
+
+	query := `UPDATE tokens
+	          SET last_used_at = CURRENT_TIMESTAMP, user_agent = $2, ip = $3,
+			      device_label = CASE WHEN $4 = '' THEN device_label ELSE $4 END
+			  WHERE hash = $1 AND (
+			      last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'
+			      OR user_agent <> $2 OR ip <> $3 OR ($4 <> '' AND device_label <> $4))`
+	_, err = p.db.ExecContext(ctx, query, hash, client.UserAgent, client.IP, client.DeviceLabel)
+	return err
+}
+
+// ListSessions returns the user's live authentication tokens, most recently
+// used first.
+func (p *PostgresTokenStore) ListSessions(ctx context.Context, userID int) (_ []*Session, err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.ListSessions")
+	defer func() { end(err) }()
+
+	query := `SELECT id, device_label, user_agent, ip, created_at, last_used_at, expiry
+	          FROM tokens
+			  WHERE user_id = $1 AND scope = $2 AND expiry > $3
+			  ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC`
+	rows, err := p.db.QueryContext(ctx, query, userID, tokens.ScopeAuth, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session := &Session{}
+		err = rows.Scan(
+			&session.ID,
+			&session.DeviceLabel,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession revokes the user's authentication token with the given id
+// along with every other token of its family. It returns ErrNotFound when
+// the user has no such session.
+func (p *PostgresTokenStore) DeleteSession(ctx context.Context, userID int, id int64) (err error) {
+	ctx, end := startCall(ctx, p.timeout, "PostgresTokenStore.DeleteSession")
+	defer func() { end(err) }()
+
+	query := `DELETE FROM tokens
+	          WHERE user_id = $1 AND (
+			      (id = $2 AND scope = $3) OR family = (SELECT family FROM tokens WHERE id = $2 AND user_id = $1 AND scope = $3))`
+	result, err := p.db.ExecContext(ctx, query, userID, id, tokens.ScopeAuth)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("session")
+	}
+	return nil
+}
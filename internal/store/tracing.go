@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/syafae/femProject/internal/store")
+
+// startSpan starts a span for a store call or for one step of a
+// transaction on the database system given by system, such as
+// semconv.DBSystemPostgreSQL. It is a child of the span in ctx, normally the
+// request span.
+func startSpan(ctx context.Context, system attribute.KeyValue, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append([]attribute.KeyValue{system, semconv.DBOperationName(name)}, attrs...)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// startCall starts the span of a postgres store call and bounds the call by
+// timeout, the query timeout the store was created with. The returned
+// function logs a failed call, ends the span and releases the timeout; it
+// must be deferred with the error the call returns.
+func startCall(ctx context.Context, timeout time.Duration, name string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	return startSystemCall(ctx, semconv.DBSystemPostgreSQL, timeout, name, attrs...)
+}
+
+// startSystemCall is startCall for a store on another database system.
+func startSystemCall(ctx context.Context, system attribute.KeyValue, timeout time.Duration, name string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, span := startSpan(ctx, system, name, attrs...)
+	return ctx, func(err error) {
+		// a client that hangs up cancels its calls, which is not an error
+		// of the store
+		if failed(err) && !errors.Is(err, context.Canceled) {
+			logger.ErrorContext(ctx, name, "error", err)
+		}
+		endSpan(span, err)
+		cancel()
+	}
+}
+
+// endSpan ends span, marking it failed when the call failed.
+func endSpan(span trace.Span, err error) {
+	if failed(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// failed reports whether err is a failure of a store call. Not found
+// results are expected and are not treated as failures.
+func failed(err error) bool {
+	return err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, ErrNotFound)
+}
@@ -1,11 +1,14 @@
 package store
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"sync"
 	"time"
 
+	"github.com/syafae/femProject/internal/roles"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,6 +24,11 @@ type User struct {
 	Email        string    `json:"email"`
 	PasswordHash password  `json:"-"`
 	Bio          string    `json:"bio"`
+	Timezone     string    `json:"timezone"`
+	Activated    bool      `json:"activated"`
+	TwoFactor    bool      `json:"two_factor_enabled"`
+	Role         string    `json:"role"`
+	Disabled     bool      `json:"disabled"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -31,8 +39,36 @@ func (u *User) IsAnonymous() bool {
 	return u == nil || u == AnonymousUser
 }
 
+// Location returns the user's IANA time zone, falling back to UTC when it is
+// unset or unknown.
+func (u *User) Location() *time.Location {
+	if u == nil || u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Can reports whether the user's role grants permission.
+func (u *User) Can(permission roles.Permission) bool {
+	return !u.IsAnonymous() && roles.Has(u.Role, permission)
+}
+
+// bcryptCost is the work factor for new password hashes. Existing hashes
+// keep the cost they were created with.
+var bcryptCost = 12
+
+// SetBcryptCost changes the work factor used by password.Set. It must be
+// called before the stores are used.
+func SetBcryptCost(cost int) {
+	bcryptCost = cost
+}
+
 func (p *password) Set(password string) ([]byte, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +77,21 @@ func (p *password) Set(password string) ([]byte, error) {
 	return hash, nil
 }
 
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// SimulatePasswordCheck spends the same time as comparing a password
+// against a real hash. Login handlers call it for unknown usernames so the
+// response time does not reveal whether an account exists.
+func SimulatePasswordCheck(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcryptCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
 func (p *password) Matches(password string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(password))
 	if err != nil {
@@ -55,55 +106,94 @@ func (p *password) Matches(password string) (bool, error) {
 
 }
 
-// UserStore provides an interface for user-related DB operations.
+// UserStore provides an interface for user-related DB operations. Missing
+// users are reported with ErrNotFound and taken usernames or emails with a
+// ConflictError.
 type UserStore interface {
-	CreateUser(user *User) error
-	GetUserByName(username string) (*User, error)
-	UpdateUser(user *User) error
-	GetUserToken(scope, tokenPlainText string) (*User, error)
+	CreateUser(ctx context.Context, user *User) error
+	GetUserByID(ctx context.Context, id int64) (*User, error)
+	GetUserByName(ctx context.Context, username string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	ListUsers(ctx context.Context, limit, offset int) ([]*User, error)
+	UpdateUser(ctx context.Context, user *User) error
+	UpdatePassword(ctx context.Context, user *User) error
+	GetUserToken(ctx context.Context, scope, tokenPlainText string) (*User, error)
+
+	// administration
+	SetUserRole(ctx context.Context, userID int, role string) error
+	SetUserDisabled(ctx context.Context, userID int, disabled bool) error
+
+	// two-factor authentication
+	BeginTOTPEnrollment(ctx context.Context, userID int, encryptedSecret []byte, recoveryCodeHashes [][]byte) error
+	GetTOTPSecret(ctx context.Context, userID int) ([]byte, error)
+	EnableTOTP(ctx context.Context, userID int, step int64) error
+	DisableTOTP(ctx context.Context, userID int) error
+	AdvanceTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (bool, error)
 }
 
 type postgresUserStore struct {
-	db *sql.DB
+	db      *sql.DB
+	timeout time.Duration
 }
 
 // NewPostgresUserStore returns a new instance of the Postgres based user store.
-func NewPostgresUserStore(db *sql.DB) *postgresUserStore {
-	return &postgresUserStore{db: db}
+func NewPostgresUserStore(db *sql.DB, timeout time.Duration) *postgresUserStore {
+	return &postgresUserStore{db: db, timeout: timeout}
 }
 
-func (pg *postgresUserStore) CreateUser(user *User) error {
-	query := `INSERT INTO users (username, email, password_hash, bio)
-	          VALUES($1, $2, $3, $4)
+func (pg *postgresUserStore) CreateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.CreateUser")
+	defer func() { end(err) }()
+
+	if user.Timezone == "" {
+		user.Timezone = "UTC"
+	}
+	if user.Role == "" {
+		user.Role = roles.User
+	}
+	query := `INSERT INTO users (username, email, password_hash, bio, timezone, activated, role)
+	          VALUES($1, $2, $3, $4, $5, $6, $7)
 			  RETURNING id, created_at, updated_at`
-	err := pg.db.QueryRow(query, user.UserName, user.Email, user.PasswordHash.hash, user.Bio).
+	err = pg.db.QueryRowContext(ctx, query, user.UserName, user.Email, user.PasswordHash.hash, user.Bio, user.Timezone, user.Activated, user.Role).
 		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
-		return err
+		return conflictError(err)
 	}
 	return nil
 }
 
-func (pg *postgresUserStore) GetUserByName(username string) (*User, error) {
-	query := `SELECT id, username, email, password_hash, bio, created_at, updated_at
-	          FROM users
-			  WHERE username = $1`
+// userColumns lists the columns scanUser expects, for queries that alias
+// the users table as u.
+const userColumns = `u.id, u.username, u.email, u.password_hash, u.bio, u.timezone, u.activated,
+	u.totp_enabled, u.role, u.disabled, u.created_at, u.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser reads a row starting with userColumns; extra receives any
+// columns selected after them.
+func scanUser(row rowScanner, extra ...any) (*User, error) {
 	user := &User{
 		PasswordHash: password{},
 	}
 	var hash []byte
-	err := pg.db.QueryRow(query, username).Scan(
+	dest := []any{
 		&user.ID,
 		&user.UserName,
 		&user.Email,
 		&hash,
 		&user.Bio,
+		&user.Timezone,
+		&user.Activated,
+		&user.TwoFactor,
+		&user.Role,
+		&user.Disabled,
 		&user.CreatedAt,
 		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
 	}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -111,50 +201,294 @@ func (pg *postgresUserStore) GetUserByName(username string) (*User, error) {
 	return user, nil
 }
 
-func (pg *postgresUserStore) UpdateUser(user *User) error {
+func (pg *postgresUserStore) getUser(ctx context.Context, query string, args ...any) (*User, error) {
+	user, err := scanUser(pg.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, notFound("user")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (pg *postgresUserStore) GetUserByID(ctx context.Context, id int64) (_ *User, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.GetUserByID")
+	defer func() { end(err) }()
+
+	return pg.getUser(ctx, `SELECT `+userColumns+` FROM users AS u WHERE u.id = $1`, id)
+}
+
+func (pg *postgresUserStore) GetUserByName(ctx context.Context, username string) (_ *User, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.GetUserByName")
+	defer func() { end(err) }()
+
+	return pg.getUser(ctx, `SELECT `+userColumns+` FROM users AS u WHERE u.username = $1`, username)
+}
+
+func (pg *postgresUserStore) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.GetUserByEmail")
+	defer func() { end(err) }()
+
+	return pg.getUser(ctx, `SELECT `+userColumns+` FROM users AS u WHERE u.email = $1`, email)
+}
+
+// ListUsers returns users ordered by id.
+func (pg *postgresUserStore) ListUsers(ctx context.Context, limit, offset int) (_ []*User, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.ListUsers")
+	defer func() { end(err) }()
+
+	query := `SELECT ` + userColumns + `
+	          FROM users AS u
+			  ORDER BY u.id
+			  LIMIT $1 OFFSET $2`
+	rows, err := pg.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (pg *postgresUserStore) UpdateUser(ctx context.Context, user *User) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.UpdateUser")
+	defer func() { end(err) }()
+
 	query := `UPDATE users 
-	          SET username = $1, email = $2, bio = $3, updated_at = CURRENT_TIMESTAMP 
-			  WHERE id = $4
+	          SET username = $1, email = $2, bio = $3, timezone = $4, activated = $5, updated_at = CURRENT_TIMESTAMP 
+			  WHERE id = $6
 			  RETURNING updated_at`
-	result, err := pg.db.Exec(query, user.UserName, user.Email, user.Bio, user.ID)
+	result, err := pg.db.ExecContext(ctx, query, user.UserName, user.Email, user.Bio, user.Timezone, user.Activated, user.ID)
 	if err != nil {
-		return err
+		return conflictError(err)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return notFound("user")
+	}
+	return nil
+}
+
+// UpdatePassword stores the hash most recently set on user.PasswordHash.
+func (pg *postgresUserStore) UpdatePassword(ctx context.Context, user *User) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.UpdatePassword")
+	defer func() { end(err) }()
+
+	query := `UPDATE users
+	          SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $2
+			  RETURNING updated_at`
+	err = pg.db.QueryRowContext(ctx, query, user.PasswordHash.hash, user.ID).Scan(&user.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("user")
+	}
+	if err != nil {
+		return err
 	}
 	return nil
 }
 
-func (pg *postgresUserStore) GetUserToken(scope, tokenPlainText string) (*User, error) {
+func (pg *postgresUserStore) GetUserToken(ctx context.Context, scope, tokenPlainText string) (_ *User, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.GetUserToken")
+	defer func() { end(err) }()
+
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
-	query := `SELECT u.id, u.username, u.email, u.password_hash, u.bio, u.created_at, u.updated_at
+	query := `SELECT ` + userColumns + `
 	          FROM users AS u
 			  JOIN tokens AS t ON t.user_id = u.id
 			  WHERE t.scope = $1 AND t.hash = $2 AND t.expiry > $3`
-	user := &User{
-		PasswordHash: password{},
+	return pg.getUser(ctx, query, scope, tokenHash[:], time.Now())
+}
+
+func (pg *postgresUserStore) SetUserRole(ctx context.Context, userID int, role string) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.SetUserRole")
+	defer func() { end(err) }()
+
+	query := `UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	result, err := pg.db.ExecContext(ctx, query, role, userID)
+	if err != nil {
+		return err
 	}
-	var hash []byte
-	err := pg.db.QueryRow(query, scope, tokenHash, time.Now()).Scan(
-		&user.ID,
-		&user.UserName,
-		&user.Email,
-		&hash,
-		&user.Bio,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("user")
+	}
+	return nil
+}
+
+func (pg *postgresUserStore) SetUserDisabled(ctx context.Context, userID int, disabled bool) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.SetUserDisabled")
+	defer func() { end(err) }()
+
+	query := `UPDATE users SET disabled = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
+	result, err := pg.db.ExecContext(ctx, query, disabled, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("user")
+	}
+	return nil
+}
+
+// BeginTOTPEnrollment stores a new, not yet enabled TOTP secret and replaces
+// the user's recovery codes.
+func (pg *postgresUserStore) BeginTOTPEnrollment(ctx context.Context, userID int, encryptedSecret []byte, recoveryCodeHashes [][]byte) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.BeginTOTPEnrollment")
+	defer func() { end(err) }()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users
+	          SET totp_secret = $1, totp_enabled = false, totp_last_step = NULL, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $2`
+	result, err := tx.ExecContext(ctx, query, encryptedSecret, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("user")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTOTPSecret returns the encrypted TOTP secret of the user, or nil when
+// they never started enrollment. It returns ErrNotFound for unknown users.
+func (pg *postgresUserStore) GetTOTPSecret(ctx context.Context, userID int) (_ []byte, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.GetTOTPSecret")
+	defer func() { end(err) }()
+
+	var secret []byte
+	err = pg.db.QueryRowContext(ctx, `SELECT totp_secret FROM users WHERE id = $1`, userID).Scan(&secret)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, notFound("user")
 	}
 	if err != nil {
 		return nil, err
 	}
-	user.PasswordHash.hash = hash
-	return user, nil
+	return secret, nil
+}
+
+// EnableTOTP turns on two-factor authentication once the user proved they
+// can generate codes; step is the time step of that first code.
+func (pg *postgresUserStore) EnableTOTP(ctx context.Context, userID int, step int64) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.EnableTOTP")
+	defer func() { end(err) }()
+
+	query := `UPDATE users
+	          SET totp_enabled = true, totp_last_step = $1, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $2 AND totp_secret IS NOT NULL`
+	result, err := pg.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return notFound("user")
+	}
+	return nil
+}
+
+func (pg *postgresUserStore) DisableTOTP(ctx context.Context, userID int) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.DisableTOTP")
+	defer func() { end(err) }()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE users
+	          SET totp_secret = NULL, totp_enabled = false, totp_last_step = NULL, updated_at = CURRENT_TIMESTAMP
+			  WHERE id = $1`
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdvanceTOTPStep records step as the last accepted TOTP time step. It
+// returns false when a code from this or a later step was already used, so
+// every code can be used only once.
+func (pg *postgresUserStore) AdvanceTOTPStep(ctx context.Context, userID int, step int64) (_ bool, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.AdvanceTOTPStep")
+	defer func() { end(err) }()
+
+	query := `UPDATE users
+	          SET totp_last_step = $1
+			  WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+	result, err := pg.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used and reports whether
+// there was one.
+func (pg *postgresUserStore) UseRecoveryCode(ctx context.Context, userID int, codeHash []byte) (_ bool, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresUserStore.UseRecoveryCode")
+	defer func() { end(err) }()
+
+	query := `UPDATE recovery_codes
+	          SET used_at = CURRENT_TIMESTAMP
+			  WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := pg.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
 }
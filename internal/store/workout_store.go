@@ -1,8 +1,17 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type Workout struct {
@@ -12,34 +21,75 @@ type Workout struct {
 	Description     string         `json:"description"`
 	DurationMinutes int            `json:"duration_minutes"`
 	CaloriesBurned  int            `json:"calories_burned"`
+	PerformedAt     time.Time      `json:"performed_at"`
 	Entries         []WorkoutEntry `json:"entries"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
 }
 
+// WorkoutEntry links to the exercise catalog through ExerciseID when the
+// exercise is known; ExerciseName is kept as it was logged, for display.
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"`
 	ExerciseName    string   `json:"exercise_name"`
 	Sets            int      `json:"sets"`
 	Reps            *int     `json:"reps"`
 	DurationSeconds *int     `json:"duration_seconds"`
+	DistanceMeters  *float64 `json:"distance_meters"`
 	Weight          *float64 `json:"weight"`
 	Notes           string   `json:"notes"`
 	OrderIndex      int      `json:"order_index"`
 }
 
+// WorkoutStore reports missing workouts with ErrNotFound.
 type WorkoutStore interface {
-	GetWorkoutByID(id int64) (*Workout, error)
-	CreateWorkout(workout *Workout) (*Workout, error)
-	UpdateWorkout(*Workout) error
-	DeleteWorkout(int64) error
-	GetWorkoutOwnerID(id int64) (int, error)
+	GetWorkoutByID(ctx context.Context, id int64) (*Workout, error)
+	CreateWorkout(ctx context.Context, workout *Workout) (*Workout, error)
+	UpdateWorkout(ctx context.Context, workout *Workout) error
+	DeleteWorkout(ctx context.Context, id int64) error
+	GetWorkoutOwnerID(ctx context.Context, id int64) (int, error)
+	ListWorkouts(ctx context.Context, filter WorkoutFilter) ([]*Workout, string, error)
+}
+
+const (
+	WorkoutSortDate     = "date"
+	WorkoutSortDuration = "duration"
+	WorkoutSortCalories = "calories"
+)
+
+// WorkoutFilter narrows and orders the result of ListWorkouts. Zero values
+// mean "no filter"; Cursor is the opaque value returned by a previous call.
+type WorkoutFilter struct {
+	UserID      int
+	Title       string
+	Exercise    string
+	From        *time.Time
+	To          *time.Time
+	MinDuration *int
+	MaxDuration *int
+	SortBy      string
+	SortDesc    bool
+	Limit       int
+	Cursor      string
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// workoutCursor is the position of the last row of a page, encoded as
+// base64 JSON so clients treat it as opaque.
+type workoutCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"id"`
 }
 
 type postgresWorkoutStore struct {
-	db *sql.DB
+	db      *sql.DB
+	timeout time.Duration
 }
 
-func NewPostgresWorkoutStore(db *sql.DB) *postgresWorkoutStore {
-	return &postgresWorkoutStore{db: db}
+func NewPostgresWorkoutStore(db *sql.DB, timeout time.Duration) *postgresWorkoutStore {
+	return &postgresWorkoutStore{db: db, timeout: timeout}
 }
 
 //implement the functions of the interface for the postgress database
@@ -47,33 +97,33 @@ func NewPostgresWorkoutStore(db *sql.DB) *postgresWorkoutStore {
 //later on we can swap postgres with any relational database system and app does not care as
 // he knows only the interface
 
-func (pg *postgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error) {
-	tx, err := pg.db.Begin()
+func (pg *postgresWorkoutStore) CreateWorkout(ctx context.Context, workout *Workout) (_ *Workout, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresWorkoutStore.CreateWorkout")
+	defer func() { end(err) }()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
-	query := `INSERT INTO workouts (user_id,title, description, duration_minutes, calories_burned)
-	 VALUES($1,$2,$3,$4, $5)
-	 returning id
+	if workout.PerformedAt.IsZero() {
+		workout.PerformedAt = time.Now()
+	}
+	query := `INSERT INTO workouts (user_id,title, description, duration_minutes, calories_burned, performed_at)
+	 VALUES($1,$2,$3,$4, $5, $6)
+	 returning id, created_at, updated_at
 	 `
-	err = tx.QueryRow(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	err = tx.QueryRowContext(ctx, query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.PerformedAt).
+		Scan(&workout.ID, &workout.CreatedAt, &workout.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-	// at this point we need to insert the entries
-	for _, entry := range workout.Entries {
-
-		query := `INSERT INTO workout_entries (workout_id , exercise_name, sets, 
-				reps, duration_seconds, 
-				weight, notes, order_index)
-				VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-				returning id`
-		err = tx.QueryRow(query, workout.UserID, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
-		if err != nil {
-			return nil, err
-		}
-
+	_, insertSpan := startSpan(ctx, semconv.DBSystemPostgreSQL, "postgresWorkoutStore.CreateWorkout.insertEntries",
+		attribute.Int("workout.entries.inserted", len(workout.Entries)))
+	err = insertWorkoutEntries(ctx, tx, workout)
+	endSpan(insertSpan, err)
+	if err != nil {
+		return nil, err
 	}
 	err = tx.Commit()
 	if err != nil {
@@ -82,45 +132,98 @@ func (pg *postgresWorkoutStore) CreateWorkout(workout *Workout) (*Workout, error
 	return workout, nil
 }
 
-func (pg *postgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
+// insertWorkoutEntries inserts the entries of workout within tx and sets
+// their IDs.
+func insertWorkoutEntries(ctx context.Context, tx *sql.Tx, workout *Workout) error {
+	query := `INSERT INTO workout_entries (workout_id, exercise_id, exercise_name, sets, reps, duration_seconds, distance_meters, weight, notes, order_index)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			  RETURNING id`
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		err := tx.QueryRowContext(ctx, query, workout.ID, entry.ExerciseID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds,
+			entry.DistanceMeters, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pg *postgresWorkoutStore) GetWorkoutByID(ctx context.Context, id int64) (_ *Workout, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresWorkoutStore.GetWorkoutByID")
+	defer func() { end(err) }()
+
 	workout := &Workout{}
-	query := `SELECT id, title, description, duration_minutes, calories_burned
+	query := `SELECT id, user_id, title, description, duration_minutes, calories_burned, performed_at, created_at, updated_at
 				FROM workouts
 				WHERE id = $1
 			`
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	err = pg.db.QueryRowContext(ctx, query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes,
+		&workout.CaloriesBurned, &workout.PerformedAt, &workout.CreatedAt, &workout.UpdatedAt)
 
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, notFound("workout")
 	}
 
 	if err != nil {
-		fmt.Println("Mohammed")
 		return nil, err
 	}
 
 	// let's get the entries
-	entryQuery := `SELECT id, exercise_name,sets, reps, duration_seconds,weight, notes, order_index
+	workout.Entries, err = getWorkoutEntries(ctx, pg.db, int64(workout.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return workout, nil
+}
+
+func getWorkoutEntries(ctx context.Context, db *sql.DB, workoutID int64) ([]WorkoutEntry, error) {
+	entries, err := getEntriesByWorkout(ctx, db, []int64{workoutID})
+	if err != nil {
+		return nil, err
+	}
+	return entries[workoutID], nil
+}
+
+// getEntriesByWorkout loads the entries of every workout in workoutIDs with a
+// single query, grouped by workout and in order. The placeholders are listed
+// one by one since SQLite has no arrays to bind.
+func getEntriesByWorkout(ctx context.Context, db *sql.DB, workoutIDs []int64) (map[int64][]WorkoutEntry, error) {
+	entries := make(map[int64][]WorkoutEntry, len(workoutIDs))
+	if len(workoutIDs) == 0 {
+		return entries, nil
+	}
+	placeholders := make([]string, len(workoutIDs))
+	args := make([]any, len(workoutIDs))
+	for i, id := range workoutIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	entryQuery := `SELECT workout_id, id, exercise_id, exercise_name, sets, reps, duration_seconds, distance_meters, weight, notes, order_index
 		FROM workout_entries
-		WHERE workout_id = $1
-		ORDER BY order_index
+		WHERE workout_id IN (` + strings.Join(placeholders, ", ") + `)
+		ORDER BY workout_id, order_index
 	`
 
-	rows, err := pg.db.Query(entryQuery, id)
-
+	rows, err := db.QueryContext(ctx, entryQuery, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
+		var workoutID int64
 		var entry WorkoutEntry
 		err = rows.Scan(
+			&workoutID,
 			&entry.ID,
+			&entry.ExerciseID,
 			&entry.ExerciseName,
 			&entry.Sets,
 			&entry.Reps,
 			&entry.DurationSeconds,
+			&entry.DistanceMeters,
 			&entry.Weight,
 			&entry.Notes,
 			&entry.OrderIndex,
@@ -129,74 +232,71 @@ func (pg *postgresWorkoutStore) GetWorkoutByID(id int64) (*Workout, error) {
 			return nil, err
 		}
 
-		workout.Entries = append(workout.Entries, entry)
+		entries[workoutID] = append(entries[workoutID], entry)
 	}
 
-	return workout, nil
+	return entries, rows.Err()
 }
 
-func (pg *postgresWorkoutStore) UpdateWorkout(workout *Workout) error {
-	tx, err := pg.db.Begin()
+func (pg *postgresWorkoutStore) UpdateWorkout(ctx context.Context, workout *Workout) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresWorkoutStore.UpdateWorkout")
+	defer func() { end(err) }()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	query := `UPDATE workouts
-	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
-	WHERE id = $5
+	SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, performed_at = $5, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $6
+	RETURNING updated_at
 	`
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
-	if err != nil {
-		return err
+	err = tx.QueryRowContext(ctx, query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.PerformedAt, workout.ID).
+		Scan(&workout.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return notFound("workout")
 	}
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
 
-	//update the entries
-	_, err = tx.Exec(`DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID)
+	// the entries are replaced wholesale; each step gets its own span since
+	// this is the slow part for workouts with many entries
+	_, deleteSpan := startSpan(ctx, semconv.DBSystemPostgreSQL, "postgresWorkoutStore.UpdateWorkout.deleteEntries")
+	result, err := tx.ExecContext(ctx, `DELETE FROM workout_entries WHERE workout_id = $1`, workout.ID)
+	if err == nil {
+		deleted, _ := result.RowsAffected()
+		deleteSpan.SetAttributes(attribute.Int64("workout.entries.deleted", deleted))
+	}
+	endSpan(deleteSpan, err)
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range workout.Entries {
-		query := `
-    INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-    `
-
-		_, err := tx.Exec(query,
-			workout.ID,
-			entry.ExerciseName,
-			entry.Sets,
-			entry.Reps,
-			entry.DurationSeconds,
-			entry.Weight,
-			entry.Notes,
-			entry.OrderIndex,
-		)
-
-		if err != nil {
-			return err
-		}
+	_, insertSpan := startSpan(ctx, semconv.DBSystemPostgreSQL, "postgresWorkoutStore.UpdateWorkout.insertEntries",
+		attribute.Int("workout.entries.inserted", len(workout.Entries)))
+	err = insertWorkoutEntries(ctx, tx, workout)
+	endSpan(insertSpan, err)
+	if err != nil {
+		return err
 	}
 
 	return tx.Commit()
 }
 
-func (pg *postgresWorkoutStore) DeleteWorkout(id int64) error {
-	tx, err := pg.db.Begin()
+func (pg *postgresWorkoutStore) DeleteWorkout(ctx context.Context, id int64) (err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresWorkoutStore.DeleteWorkout")
+	defer func() { end(err) }()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 	query := `DELETE from workouts WHERE id = $1`
-	result, err := pg.db.Exec(query, id)
+	result, err := tx.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -205,22 +305,218 @@ func (pg *postgresWorkoutStore) DeleteWorkout(id int64) error {
 		return err
 	}
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return notFound("workout")
 	}
 
 	return tx.Commit()
 
 }
 
-func (pg *postgresWorkoutStore) GetWorkoutOwnerID(workoutID int64) (int, error) {
+func (pg *postgresWorkoutStore) GetWorkoutOwnerID(ctx context.Context, workoutID int64) (_ int, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresWorkoutStore.GetWorkoutOwnerID")
+	defer func() { end(err) }()
+
 	var userID int
 	query := `SELECT user_id FROM workouts WHERE id = $1`
-	err := pg.db.QueryRow(query, workoutID).Scan(&userID)
+	err = pg.db.QueryRowContext(ctx, query, workoutID).Scan(&userID)
 	if err == sql.ErrNoRows {
-		return 0, nil
+		return 0, notFound("workout")
 	}
 	if err != nil {
 		return 0, err
 	}
 	return userID, nil
 }
+
+func workoutSortColumn(sortBy string) (string, error) {
+	switch sortBy {
+	case "", WorkoutSortDate:
+		return "w.performed_at", nil
+	case WorkoutSortDuration:
+		return "w.duration_minutes", nil
+	case WorkoutSortCalories:
+		return "COALESCE(w.calories_burned, 0)", nil
+	default:
+		return "", fmt.Errorf("unknown sort field %q", sortBy)
+	}
+}
+
+func encodeWorkoutCursor(value any, id int) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(workoutCursor{Value: raw, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeWorkoutCursor(cursor, sortBy string) (any, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	var c workoutCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	if sortBy == "" || sortBy == WorkoutSortDate {
+		var t time.Time
+		if err := json.Unmarshal(c.Value, &t); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return t, c.ID, nil
+	}
+	var n int64
+	if err := json.Unmarshal(c.Value, &n); err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	return n, c.ID, nil
+}
+
+// ListWorkouts returns one page of workouts matching filter together with
+// the cursor of the next page, which is empty when there are no more rows.
+func (pg *postgresWorkoutStore) ListWorkouts(ctx context.Context, filter WorkoutFilter) (_ []*Workout, _ string, err error) {
+	ctx, end := startCall(ctx, pg.timeout, "postgresWorkoutStore.ListWorkouts")
+	defer func() { end(err) }()
+
+	return listWorkouts(ctx, pg.db, filter, "ILIKE", func(t time.Time) any { return t })
+}
+
+// likeEscape ends every LIKE condition built from a containsPattern.
+const likeEscape = ` ESCAPE '\'`
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern returns the LIKE pattern matching text that contains s.
+// Wildcards in s are escaped so they match themselves.
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// listWorkouts implements ListWorkouts for the SQL stores, which only differ
+// in the operator for case-insensitive matches and in how times are bound.
+func listWorkouts(ctx context.Context, db *sql.DB, filter WorkoutFilter, ilike string, bindTime func(time.Time) any) ([]*Workout, string, error) {
+	sortColumn, err := workoutSortColumn(filter.SortBy)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var conditions []string
+	var args []any
+	addArg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions = append(conditions, "w.user_id = "+addArg(filter.UserID))
+	if filter.Title != "" {
+		conditions = append(conditions, "w.title "+ilike+" "+addArg(containsPattern(filter.Title))+likeEscape)
+	}
+	if filter.Exercise != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM workout_entries e
+			WHERE e.workout_id = w.id AND e.exercise_name `+ilike+` `+addArg(containsPattern(filter.Exercise))+likeEscape+`)`)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "w.performed_at >= "+addArg(bindTime(*filter.From)))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "w.performed_at < "+addArg(bindTime(*filter.To)))
+	}
+	if filter.MinDuration != nil {
+		conditions = append(conditions, "w.duration_minutes >= "+addArg(*filter.MinDuration))
+	}
+	if filter.MaxDuration != nil {
+		conditions = append(conditions, "w.duration_minutes <= "+addArg(*filter.MaxDuration))
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		value, id, err := decodeWorkoutCursor(filter.Cursor, filter.SortBy)
+		if err != nil {
+			return nil, "", err
+		}
+		if t, ok := value.(time.Time); ok {
+			value = bindTime(t)
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, w.id) %s (%s, %s)", sortColumn, comparison, addArg(value), addArg(id)))
+	}
+
+	// fetch one extra row so we know whether there is a next page
+	query := fmt.Sprintf(`SELECT w.id, w.user_id, w.title, w.description, w.duration_minutes,
+			COALESCE(w.calories_burned, 0), w.performed_at, w.created_at, w.updated_at
+		FROM workouts AS w
+		WHERE %s
+		ORDER BY %s %s, w.id %s
+		LIMIT %s`,
+		strings.Join(conditions, " AND "), sortColumn, direction, direction, addArg(filter.Limit+1))
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var workouts []*Workout
+	for rows.Next() {
+		workout := &Workout{}
+		var description sql.NullString
+		err = rows.Scan(
+			&workout.ID,
+			&workout.UserID,
+			&workout.Title,
+			&description,
+			&workout.DurationMinutes,
+			&workout.CaloriesBurned,
+			&workout.PerformedAt,
+			&workout.CreatedAt,
+			&workout.UpdatedAt,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		workout.Description = description.String
+		workouts = append(workouts, workout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var nextCursor string
+	if len(workouts) > filter.Limit {
+		workouts = workouts[:filter.Limit]
+		last := workouts[len(workouts)-1]
+		var value any
+		switch filter.SortBy {
+		case WorkoutSortDuration:
+			value = last.DurationMinutes
+		case WorkoutSortCalories:
+			value = last.CaloriesBurned
+		default:
+			value = last.PerformedAt
+		}
+		nextCursor, err = encodeWorkoutCursor(value, last.ID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	ids := make([]int64, len(workouts))
+	for i, workout := range workouts {
+		ids[i] = int64(workout.ID)
+	}
+	entries, err := getEntriesByWorkout(ctx, db, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, workout := range workouts {
+		workout.Entries = entries[int64(workout.ID)]
+	}
+
+	return workouts, nextCursor, nil
+}
@@ -0,0 +1,80 @@
+package tokens
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key so that keys are easy to recognise, both
+// by the authentication middleware and by secret scanners.
+const APIKeyPrefix = "fem_"
+
+// API key scopes grant access to a group of routes.
+const (
+	APIScopeWorkoutsRead  = "workouts:read"
+	APIScopeWorkoutsWrite = "workouts:write"
+	APIScopeProfileRead   = "profile:read"
+	APIScopeProfileWrite  = "profile:write"
+)
+
+var APIScopes = []string{
+	APIScopeWorkoutsRead,
+	APIScopeWorkoutsWrite,
+	APIScopeProfileRead,
+	APIScopeProfileWrite,
+}
+
+// APIKey is a long-lived credential for scripts and integrations. Only
+// its hash is stored; Plaintext is set just once, when the key is created.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Plaintext  string     `json:"key,omitempty"`
+	Hash       []byte     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// GenerateAPIKey creates a key of the form fem_<prefix>_<secret>. The prefix
+// is stored in clear so users can tell their keys apart.
+func GenerateAPIKey(userID int, name string, scopes []string, expiresAt *time.Time) (*APIKey, error) {
+	prefix, err := randomString(5)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	prefix = strings.ToLower(prefix)
+
+	key := &APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    APIKeyPrefix + prefix,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	key.Plaintext = key.Prefix + "_" + secret
+	key.Hash = HashPlaintext(key.Plaintext)
+	return key, nil
+}
+
+// IsAPIKey reports whether a bearer credential is an API key rather than a
+// session token.
+func IsAPIKey(plaintext string) bool {
+	return strings.HasPrefix(plaintext, APIKeyPrefix)
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+func ValidAPIScope(scope string) bool {
+	return slices.Contains(APIScopes, scope)
+}
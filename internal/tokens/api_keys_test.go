@@ -0,0 +1,81 @@
+package tokens
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// apiKeyFormat is fem_, 5 random bytes in lower case base32 and 32 random
+// bytes in base32.
+var apiKeyFormat = regexp.MustCompile(`^fem_[a-z2-7]{8}_[A-Z2-7]{52}$`)
+
+func TestGenerateAPIKey(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	key, err := GenerateAPIKey(7, "backup script", []string{APIScopeWorkoutsRead}, &expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !apiKeyFormat.MatchString(key.Plaintext) {
+		t.Errorf("key %q does not match %s", key.Plaintext, apiKeyFormat)
+	}
+	if want := key.Prefix + "_"; key.Plaintext[:len(want)] != want {
+		t.Errorf("key %q does not start with its prefix %q", key.Plaintext, key.Prefix)
+	}
+	if !bytes.Equal(key.Hash, HashPlaintext(key.Plaintext)) {
+		t.Error("the hash is not the hash of the plaintext")
+	}
+	if key.UserID != 7 || key.Name != "backup script" || key.ExpiresAt != &expiresAt {
+		t.Errorf("key = %+v, want the given user, name and expiry", key)
+	}
+
+	other, err := GenerateAPIKey(7, "backup script", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Plaintext == key.Plaintext || other.Prefix == key.Prefix {
+		t.Error("two keys share their plaintext or prefix")
+	}
+}
+
+func TestIsAPIKey(t *testing.T) {
+	key, err := GenerateAPIKey(1, "test", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := GenerateToken(1, time.Hour, ScopeAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		credential string
+		want       bool
+	}{
+		{key.Plaintext, true},
+		{session.Plaintext, false},
+		{"", false},
+		{"FEM_abc", false},
+	}
+	for _, tt := range tests {
+		if got := IsAPIKey(tt.credential); got != tt.want {
+			t.Errorf("IsAPIKey(%q) = %t, want %t", tt.credential, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	key := &APIKey{Scopes: []string{APIScopeWorkoutsRead, APIScopeProfileRead}}
+	for _, scope := range APIScopes {
+		want := scope == APIScopeWorkoutsRead || scope == APIScopeProfileRead
+		if got := key.HasScope(scope); got != want {
+			t.Errorf("HasScope(%q) = %t, want %t", scope, got, want)
+		}
+		if !ValidAPIScope(scope) {
+			t.Errorf("ValidAPIScope(%q) = false", scope)
+		}
+	}
+	if ValidAPIScope("admin") {
+		t.Error(`ValidAPIScope("admin") = true`)
+	}
+}
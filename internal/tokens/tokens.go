@@ -8,7 +8,10 @@ import (
 )
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth          = "authentication"
+	ScopeRefresh       = "refresh"
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
 )
 
 type Token struct {
@@ -17,6 +20,22 @@ type Token struct {
 	UserID    int       `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// Family links a refresh token to every token rotated out of the same
+	// login, so that reusing an old refresh token can revoke all of them.
+	Family string     `json:"-"`
+	UsedAt *time.Time `json:"-"`
+
+	ID         int64      `json:"-"`
+	CreatedAt  time.Time  `json:"-"`
+	LastUsedAt *time.Time `json:"-"`
+	Client     `json:"-"`
+}
+
+// Client describes where a token is being used from.
+type Client struct {
+	UserAgent   string `json:"user_agent"`
+	IP          string `json:"ip"`
+	DeviceLabel string `json:"device_label"`
 }
 
 func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
@@ -26,14 +45,32 @@ func GenerateToken(userID int, ttl time.Duration, scope string) (*Token, error)
 		Scope:  scope,
 	}
 
-	emptyBytes := make([]byte, 32)
-	_, err := rand.Read(emptyBytes)
+	plaintext, err := randomString(32)
 	if err != nil {
 		return nil, err
 	}
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes)
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	token.Plaintext = plaintext
+	token.Hash = HashPlaintext(token.Plaintext)
 
 	return token, nil
 }
+
+// GenerateFamily returns a new random identifier for a refresh token family.
+func GenerateFamily() (string, error) {
+	return randomString(16)
+}
+
+// HashPlaintext returns the hash under which a token is stored.
+func HashPlaintext(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+func randomString(n int) (string, error) {
+	emptyBytes := make([]byte, n)
+	_, err := rand.Read(emptyBytes)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes), nil
+}
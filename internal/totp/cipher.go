@@ -0,0 +1,48 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Cipher encrypts TOTP secrets before they are written to the database,
+// using AES-GCM with a random nonce prepended to each ciphertext.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns a Cipher for a 16, 24 or 32 byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("totp: cipher %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("totp: cipher %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+func (c *Cipher) Encrypt(secret string) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, []byte(secret), nil), nil
+}
+
+func (c *Cipher) Decrypt(ciphertext []byte) (string, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return "", errors.New("totp: ciphertext too short")
+	}
+	plain, err := c.aead.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+	if err != nil {
+		return "", fmt.Errorf("totp: decrypt %w", err)
+	}
+	return string(plain), nil
+}
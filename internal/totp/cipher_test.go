@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, fill byte) *Cipher {
+	t.Helper()
+	c, err := NewCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	c := newTestCipher(t, 1)
+	first, err := c.Encrypt(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Encrypt(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("encrypting twice gave the same ciphertext, the nonce is not random")
+	}
+	for _, ciphertext := range [][]byte{first, second} {
+		secret, err := c.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != rfc6238Secret {
+			t.Errorf("Decrypt = %q, want %q", secret, rfc6238Secret)
+		}
+	}
+}
+
+func TestCipherRejectsTampering(t *testing.T) {
+	c := newTestCipher(t, 1)
+	ciphertext, err := c.Encrypt(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		cipher     *Cipher
+		ciphertext []byte
+	}{
+		{"flipped bit", c, flipLastBit(ciphertext)},
+		{"truncated", c, ciphertext[:len(ciphertext)-1]},
+		{"shorter than the nonce", c, ciphertext[:4]},
+		{"other key", newTestCipher(t, 2), ciphertext},
+	}
+	for _, tt := range tests {
+		if _, err := tt.cipher.Decrypt(tt.ciphertext); err == nil {
+			t.Errorf("%s: Decrypt succeeded", tt.name)
+		}
+	}
+}
+
+func flipLastBit(b []byte) []byte {
+	flipped := bytes.Clone(b)
+	flipped[len(flipped)-1] ^= 1
+	return flipped
+}
+
+func TestNewCipherKeySize(t *testing.T) {
+	if _, err := NewCipher(make([]byte, 31)); err == nil {
+		t.Error("NewCipher accepted a 31 byte key")
+	}
+}
@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors,
+// "12345678901234567890", in base32.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// TestValidateRFC6238 checks the SHA-1 test vectors of RFC 6238 appendix B.
+// The RFC lists 8 digit codes; ours are the last 6 digits.
+func TestValidateRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := Validate(rfc6238Secret, tt.code, at)
+		if !ok || step != Step(at) {
+			t.Errorf("Validate(%s at %d) = %d, %t, want %d, true", tt.code, tt.unix, step, ok, Step(at))
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	code, err := CodeAt(rfc6238Secret, Step(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		code string
+		at   time.Time
+		want bool
+	}{
+		{"current step", code, at, true},
+		{"one step late", code, at.Add(Period), true},
+		{"one step early", code, at.Add(-Period), true},
+		{"outside the skew", code, at.Add(time.Duration(Skew+1) * Period), false},
+		{"surrounding spaces", " " + code + " ", at, true},
+		{"too short", code[:Digits-1], at, false},
+		{"wrong code", "000000", at, false},
+	}
+	for _, tt := range tests {
+		if _, ok := Validate(rfc6238Secret, tt.code, tt.at); ok != tt.want {
+			t.Errorf("%s: Validate = %t, want %t", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("ABCDE-FGHIJ")
+	for _, code := range []string{"abcde-fghij", "ABCDEFGHIJ", "abcde fghij"} {
+		if string(HashRecoveryCode(code)) != string(want) {
+			t.Errorf("HashRecoveryCode(%q) differs from the canonical form", code)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/syafae/femProject/internal/config"
+)
+
+// newInMemory returns a provider for cfg that records its spans in the
+// returned exporter.
+func newInMemory(t *testing.T, cfg config.TracingConfig) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(cfg, sdktrace.NewSimpleSpanProcessor(exporter))
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return provider, exporter
+}
+
+func TestNewProviderSampling(t *testing.T) {
+	provider, exporter := newInMemory(t, config.TracingConfig{ServiceName: "femproject-test", SampleRatio: 0})
+	tracer := provider.Tracer("test")
+
+	_, root := tracer.Start(t.Context(), "unsampled root")
+	root.End()
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Fatalf("recorded %d spans with a sample ratio of 0, want none", len(spans))
+	}
+
+	// a caller that sampled the trace is followed regardless of the ratio
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := propagation.TraceContext{}.Extract(t.Context(), propagation.HeaderCarrier(header))
+	_, child := tracer.Start(ctx, "GET /workouts")
+	child.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans for a sampled parent, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /workouts" || span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span = %s in trace %s with parent %s, want it to continue the propagated trace",
+			span.Name, span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+	if got, ok := span.Resource.Set().Value(semconv.ServiceNameKey); !ok || got.AsString() != "femproject-test" {
+		t.Errorf("service.name = %v, want femproject-test", got)
+	}
+}
+
+func TestSetupExporters(t *testing.T) {
+	for _, exporter := range config.TracingExporters {
+		if exporter == config.TracingExporterOTLP {
+			// needs a collector to flush to
+			continue
+		}
+		stop, err := Setup(t.Context(), config.TracingConfig{Exporter: exporter, ServiceName: "femproject-test", SampleRatio: 1}, io.Discard)
+		if err != nil {
+			t.Fatalf("Setup(%s): %v", exporter, err)
+		}
+		if err := stop(t.Context()); err != nil {
+			t.Errorf("stopping %s: %v", exporter, err)
+		}
+	}
+	if _, err := Setup(t.Context(), config.TracingConfig{Exporter: "zipkin"}, io.Discard); err == nil {
+		t.Error("Setup(zipkin) succeeded, want an unknown exporter error")
+	}
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/syafae/femProject/internal/logging"
+	"github.com/syafae/femProject/internal/store"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// Error codes sent in the code member of every problem. Clients should
+// branch on these; the detail text is meant for humans and may change.
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidBody          = "invalid_body"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeInvalidToken         = "invalid_token"
+	CodeTwoFactorRequired    = "two_factor_required"
+	CodeInvalidTwoFactorCode = "invalid_two_factor_code"
+	CodeForbidden            = "forbidden"
+	CodeAccountDisabled      = "account_disabled"
+	CodeAccountNotActivated  = "account_not_activated"
+	CodeInsufficientScope    = "insufficient_scope"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeTooManyAttempts      = "too_many_attempts"
+	CodeTimeout              = "timeout"
+	CodeClientClosedRequest  = "client_closed_request"
+	CodeInternal             = "internal_error"
+)
+
+// StatusClientClosedRequest is the nginx convention for requests the client
+// gave up on before the response was written. Nobody reads the response, but
+// it keeps cancellations apart from server errors in logs and metrics.
+const StatusClientClosedRequest = 499
+
+// Problem is an RFC 7807 problem details object. Type is left as
+// about:blank, so Title is the HTTP status text; Code and Errors are
+// extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewProblem returns a problem for status with a stable code and a human
+// readable detail.
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// ValidationError collects every invalid field of a request so they can be
+// reported at once.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// NewFieldError returns a ValidationError for a single invalid field.
+func NewFieldError(field, code, message string) error {
+	return &ValidationError{Fields: []FieldError{{Field: field, Code: code, Message: message}}}
+}
+
+// Add records that field failed the check named by code.
+func (v *ValidationError) Add(field, code, message string) {
+	v.Fields = append(v.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Check records the failure when ok is false, so rules read as a list of
+// conditions the request must meet.
+func (v *ValidationError) Check(ok bool, field, code, message string) {
+	if !ok {
+		v.Add(field, code, message)
+	}
+}
+
+// Err returns v when any field was added and nil otherwise.
+func (v *ValidationError) Err() error {
+	if len(v.Fields) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (v *ValidationError) Error() string {
+	messages := make([]string, len(v.Fields))
+	for i, f := range v.Fields {
+		messages[i] = f.Field + ": " + f.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ProblemFor maps an error to the problem sent to clients. Body, validation
+// and store errors keep their message; anything unknown becomes a generic 500
+// so internal details never leak.
+func ProblemFor(err error) Problem {
+	var validation *ValidationError
+	var conflict *store.ConflictError
+	var notFound *store.NotFoundError
+	var body *BodyError
+	switch {
+	case errors.As(err, &body):
+		if body.Status == http.StatusRequestEntityTooLarge {
+			return NewProblem(body.Status, CodeBodyTooLarge, body.Detail)
+		}
+		return NewProblem(body.Status, CodeInvalidBody, body.Detail)
+	case errors.As(err, &validation):
+		p := NewProblem(http.StatusUnprocessableEntity, CodeValidationFailed, "the request contains invalid fields")
+		p.Errors = validation.Fields
+		return p
+	case errors.As(err, &conflict):
+		p := NewProblem(http.StatusConflict, CodeConflict, conflict.Error())
+		if conflict.Field != "" {
+			p.Errors = []FieldError{{Field: conflict.Field, Code: "taken", Message: conflict.Error()}}
+		}
+		return p
+	case errors.Is(err, store.ErrConflict):
+		return NewProblem(http.StatusConflict, CodeConflict, "resource already exists")
+	case errors.As(err, &notFound):
+		return NewProblem(http.StatusNotFound, CodeNotFound, notFound.Error())
+	case errors.Is(err, store.ErrNotFound):
+		return NewProblem(http.StatusNotFound, CodeNotFound, "resource not found")
+	case errors.Is(err, store.ErrForbidden):
+		return NewProblem(http.StatusForbidden, CodeForbidden, "you do not have permission to access this resource")
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewProblem(http.StatusServiceUnavailable, CodeTimeout, "the request took too long, try again later")
+	case errors.Is(err, context.Canceled):
+		p := NewProblem(StatusClientClosedRequest, CodeClientClosedRequest, "the client closed the request")
+		p.Title = "Client Closed Request"
+		return p
+	default:
+		return NewProblem(http.StatusInternalServerError, CodeInternal, "internal server error")
+	}
+}
+
+// WriteProblem writes p as application/problem+json, filling in the
+// request path and ID.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) error {
+	p.Instance = r.URL.Path
+	p.RequestID = logging.RequestID(r.Context())
+	body, err := json.MarshalIndent(p, "", "	")
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(body)
+	return nil
+}
+
+// WriteError answers with the problem err maps to. Callers still log
+// unexpected errors themselves.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) error {
+	return WriteProblem(w, r, ProblemFor(err))
+}
+
+// WriteErrorCode is a shorthand for errors that are decided by the handler
+// rather than returned by a store.
+func WriteErrorCode(w http.ResponseWriter, r *http.Request, status int, code, detail string) error {
+	return WriteProblem(w, r, NewProblem(status, code, detail))
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/syafae/femProject/internal/store"
+)
+
+func TestProblemFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"validation", NewFieldError("title", "required", "title is required"), http.StatusUnprocessableEntity, CodeValidationFailed},
+		{"not found", fmt.Errorf("GetWorkoutByID: %w", store.ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{"forbidden", store.ErrForbidden, http.StatusForbidden, CodeForbidden},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusServiceUnavailable, CodeTimeout},
+		{"canceled", fmt.Errorf("query: %w", context.Canceled), StatusClientClosedRequest, CodeClientClosedRequest},
+		{"unknown", errors.New("connection reset"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := ProblemFor(tt.err)
+			if p.Status != tt.status || p.Code != tt.code || p.Title == "" {
+				t.Errorf("ProblemFor(%v) = %d %s %q, want %d %s with a title", tt.err, p.Status, p.Code, p.Title, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -1,10 +1,16 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -23,6 +29,59 @@ func WriteJSON(w http.ResponseWriter, staus int, data Envelope) error {
 	return nil
 }
 
+// MaxBodyBytes limits request bodies read by ReadJSON.
+const MaxBodyBytes = 1 << 20
+
+// BodyError reports a request body that could not be decoded. Detail is
+// safe to show to clients.
+type BodyError struct {
+	Status int
+	Detail string
+}
+
+func (e *BodyError) Error() string {
+	return e.Detail
+}
+
+// ReadJSON strictly decodes the request body into dst: the body must be a
+// single JSON value of at most MaxBodyBytes without fields unknown to dst.
+// Failures are returned as a *BodyError.
+func ReadJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var typeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+		switch {
+		case errors.As(err, &syntaxError):
+			return &BodyError{http.StatusBadRequest, fmt.Sprintf("body contains malformed JSON at character %d", syntaxError.Offset)}
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return &BodyError{http.StatusBadRequest, "body contains malformed JSON"}
+		case errors.As(err, &typeError):
+			if typeError.Field != "" {
+				return &BodyError{http.StatusBadRequest, fmt.Sprintf("field %q must be of type %s", typeError.Field, typeError.Type)}
+			}
+			return &BodyError{http.StatusBadRequest, fmt.Sprintf("body must be a JSON %s", typeError.Type)}
+		case errors.Is(err, io.EOF):
+			return &BodyError{http.StatusBadRequest, "body must not be empty"}
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return &BodyError{http.StatusBadRequest, "body contains unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+		case errors.As(err, &maxBytesError):
+			return &BodyError{http.StatusRequestEntityTooLarge, fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit)}
+		default:
+			return &BodyError{http.StatusBadRequest, "body could not be decoded"}
+		}
+	}
+	if err = dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return &BodyError{http.StatusBadRequest, "body must only contain a single JSON value"}
+	}
+	return nil
+}
+
 func ReadIDParam(r *http.Request) (int64, error) {
 	paramsWorkoutID := chi.URLParam(r, "id")
 	if paramsWorkoutID == "" {
@@ -35,3 +94,56 @@ func ReadIDParam(r *http.Request) (int64, error) {
 
 	return workoutID, nil
 }
+
+// ReadIntQuery returns the integer value of the query parameter key, or nil
+// when it is not present.
+func ReadIntQuery(r *http.Request, key string) (*int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter", key)
+	}
+	return &value, nil
+}
+
+// ReadTimeQuery parses the query parameter key as either an RFC 3339
+// timestamp or a plain YYYY-MM-DD date, returning nil when it is absent.
+// Plain dates are taken as midnight in loc.
+func ReadTimeQuery(r *http.Request, key string, loc *time.Location) (*time.Time, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, raw, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter", key)
+	}
+	return &t, nil
+}
+
+type clientIPContextKey struct{}
+
+// SetClientIP records the address of the client behind any trusted proxies
+// for ClientIP.
+func SetClientIP(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPContextKey{}, ip))
+}
+
+// ClientIP returns the IP address the request came from: the one set by
+// SetClientIP, or else the peer address of the connection.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,40 +1,149 @@
+// Command femProject serves the workout API and manages its database
+// schema:
+//
+//	femProject [serve] [flags]
+//	femProject migrate [flags] up|down|redo|status|version
+//	femProject migrate create NAME
+//	femProject seed [flags]
+//
+// Every command takes the configuration flags, see -h.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/syafae/femProject/internal/app"
+	"github.com/syafae/femProject/internal/config"
 	"github.com/syafae/femProject/internal/routes"
 )
 
 func main() {
-	var port int
-	flag.IntVar(&port, "port", 8080, "server backend port")
-	flag.Parse()
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
 
-	app, err := app.NewApplication()
+	var err error
+	switch command {
+	case "serve":
+		err = serve(args)
+	case "migrate":
+		err = migrate(args)
+	case "seed":
+		err = seedDatabase(args)
+	default:
+		err = usageError{fmt.Errorf("unknown command %q, expected serve, migrate or seed", command)}
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		if errors.As(err, &usageError{}) {
+			os.Exit(2)
+		}
+		os.Exit(1)
 	}
-	
-	defer app.DB.Close()
+}
 
-	app.Logger.Printf("We are running on port %d", port)
-	r := routes.SetUpRoutes(app)
+// usageError is a mistake on the command line; it exits with status 2.
+type usageError struct {
+	error
+}
 
-	server := http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		Handler:      r,
+// loadConfig loads the configuration from args, parsed with the flags of
+// the command in flags, and returns the arguments after them.
+func loadConfig(flags *flag.FlagSet, args []string) (*config.Config, []string, error) {
+	cfg, rest, err := config.Load(flags, args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return nil, nil, usageError{err}
 	}
-	err = server.ListenAndServe()
+	return cfg, rest, err
+}
+
+// serve runs the API server until it receives SIGINT or SIGTERM.
+func serve(args []string) error {
+	cfg, rest, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError{fmt.Errorf("serve takes no arguments, got %q", rest)}
+	}
+
+	app, err := app.NewApplication(cfg)
 	if err != nil {
-		app.Logger.Fatal(err)
+		return err
+	}
+
+	r := routes.SetUpRoutes(app)
+	app.Logger.Info("server starting", "port", cfg.Port)
+
+	newServer := func(addr string, handler http.Handler) *http.Server {
+		return &http.Server{
+			Addr:         addr,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			Handler:      handler,
+			ErrorLog:     slog.NewLogLogger(app.Logger.Handler(), slog.LevelWarn),
+		}
+	}
+	servers := []*http.Server{newServer(fmt.Sprintf(":%d", cfg.Port), r)}
+	if cfg.Server.MetricsAddr != "" {
+		app.Logger.Info("metrics server starting", "addr", cfg.Server.MetricsAddr)
+		servers = append(servers, newServer(cfg.Server.MetricsAddr, routes.SetUpMetricsRoutes(app)))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			serverErr <- server.ListenAndServe()
+		}()
 	}
 
+	select {
+	case err = <-serverErr:
+		err = fmt.Errorf("server: %w", err)
+	case <-ctx.Done():
+		// a second signal kills the process instead of waiting for the drain
+		stop()
+		app.BeginDrain()
+		if cfg.Server.DrainDelay > 0 {
+			app.Logger.Info("shutting down, waiting for load balancers to stop sending traffic", "delay", cfg.Server.DrainDelay)
+			time.Sleep(cfg.Server.DrainDelay)
+		}
+		app.Logger.Info("shutting down, draining requests", "timeout", cfg.Server.ShutdownTimeout)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		for _, server := range servers {
+			if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+				err = errors.Join(err, fmt.Errorf("shutdown %s: %w", server.Addr, shutdownErr))
+			}
+		}
+	}
+
+	if closeErr := app.Close(); closeErr != nil {
+		app.Logger.Error("close", "error", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	app.Logger.Info("server stopped")
+	return nil
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/syafae/femProject/internal/app"
+	"github.com/syafae/femProject/internal/logging"
+	"github.com/syafae/femProject/internal/store"
+)
+
+// migrationDirs are the source directories of the embedded migrations,
+// relative to the repository root. Schema changes need a migration for
+// every store, so migrate create writes one to each.
+var migrationDirs = []string{"internal/migrations", "internal/migrations/sqlite"}
+
+const migrateUsage = "usage: migrate [flags] up|down|redo|status|version, or migrate create NAME"
+
+// migrate manages the schema of the database selected by the store flags,
+// using the migrations embedded in the binary.
+func migrate(args []string) error {
+	cfg, rest, err := loadConfig(flag.NewFlagSet("migrate", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return usageError{errors.New(migrateUsage)}
+	}
+	command, rest := rest[0], rest[1:]
+
+	if command == "create" {
+		if len(rest) != 1 {
+			return usageError{errors.New("usage: migrate create NAME")}
+		}
+		for _, dir := range migrationDirs {
+			file, err := store.CreateMigration(dir, rest[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println("created", file)
+		}
+		return nil
+	}
+
+	switch command {
+	case "up", "down", "redo", "status", "version":
+	default:
+		return usageError{fmt.Errorf("unknown migrate command %q; %s", command, migrateUsage)}
+	}
+	if len(rest) > 0 {
+		return usageError{fmt.Errorf("migrate %s takes no arguments, got %q", command, rest)}
+	}
+
+	// progress goes to stderr so status and version can be piped
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	store.SetLogger(logger)
+	db, migrationFS, err := app.OpenDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case "status":
+		statuses, err := store.MigrationStatuses(ctx, db, migrationFS, ".")
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED AT\tMIGRATION")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, appliedAt, status.Name)
+		}
+		return w.Flush()
+	case "version":
+		current, latest, err := store.MigrationVersions(ctx, db, migrationFS, ".")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d (latest %d)\n", current, latest)
+		return nil
+	}
+	return store.RunMigrationsFS(ctx, db, migrationFS, ".", command)
+}
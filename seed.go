@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/syafae/femProject/internal/app"
+	"github.com/syafae/femProject/internal/logging"
+	"github.com/syafae/femProject/internal/seed"
+	"github.com/syafae/femProject/internal/store"
+)
+
+// seedPassword is the password of every generated user. It passes the
+// registration rules so it can be typed into a client as is.
+const seedPassword = "Seed-pass1!"
+
+// seedDatabase fills the database of the configured store with generated
+// users and workouts, or with a fixture file.
+func seedDatabase(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	seedValue := flags.Uint64("seed", 1, "seed of the generated data; the same seed generates the same data")
+	size := flags.Int("size", 10, "number of users to generate, each with 5 to 40 workouts")
+	now := flags.String("now", seed.DefaultNow.Format(time.DateOnly), "date the generated workouts lead up to, as 2006-01-02")
+	fixture := flags.String("fixture", "", "YAML or JSON fixture file to load instead of generating data")
+	admin := flags.Bool("admin", false, "make the first generated user an admin")
+	cfg, rest, err := loadConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError{fmt.Errorf("seed takes no arguments, got %q", rest)}
+	}
+	if cfg.Environment == "production" {
+		return errors.New("seed refuses to write made-up data to a production environment; set APP_ENV or -env to development or test")
+	}
+	if cfg.Store == "memory" {
+		return usageError{errors.New("seed needs the postgres or sqlite store, the memory store starts empty every time")}
+	}
+	if *size < 1 {
+		return usageError{fmt.Errorf("size must be positive, got %d", *size)}
+	}
+	nowDate, err := time.Parse(time.DateOnly, *now)
+	if err != nil {
+		return usageError{fmt.Errorf("now must be a date such as 2025-06-01, got %q", *now)}
+	}
+
+	var data *seed.Fixture
+	if *fixture != "" {
+		raw, err := os.ReadFile(*fixture)
+		if err != nil {
+			return err
+		}
+		if data, err = seed.ParseFixture(*fixture, raw); err != nil {
+			return err
+		}
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	store.SetLogger(logger)
+	store.SetBcryptCost(cfg.BcryptCost)
+	opened, err := app.OpenStores(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer opened.DB.Close()
+	stores := seed.Stores{Users: opened.Users, Workouts: opened.Workouts, Exercises: opened.Exercises}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var result *seed.Result
+	if data != nil {
+		result, err = seed.Load(ctx, stores, data)
+	} else {
+		result, err = seed.Generate(ctx, stores, seed.Options{Seed: *seedValue, Users: *size, Password: seedPassword, Now: nowDate, Admin: *admin})
+	}
+	if result != nil && result.Users > 0 {
+		fmt.Printf("created %d users, %d workouts and %d entries\n", result.Users, result.Workouts, result.Entries)
+	}
+	var conflict *store.ConflictError
+	if errors.As(err, &conflict) {
+		return fmt.Errorf("%w; seed an empty database", err)
+	}
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		fmt.Printf("every user's password is %s\n", seedPassword)
+		if result.Admin != "" {
+			fmt.Printf("%s is an admin\n", result.Admin)
+		}
+	}
+	return nil
+}